@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// BackupFunc takes one backup, wherever the server is configured to keep them
+type BackupFunc func(ctx context.Context) (BackupInfo, error)
+
+type adminHandler struct {
+	svc       *Service
+	retention RetentionPolicy
+	backup    BackupFunc
+}
+
+type pruneResponse struct {
+	PruneReport
+	BytesFreed int64 `json:"bytes_freed"`
+}
+
+// NewAdminHandler serves maintenance endpoints under /api/admin/. Prune
+// runs with the given policy, the same one the background job uses, and
+// backup is only served when a BackupFunc is given.
+func NewAdminHandler(svc *Service, retention RetentionPolicy, backup BackupFunc) http.Handler {
+	return &adminHandler{svc: svc, retention: retention, backup: backup}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/admin"), "/") {
+	case "prune":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handlePrune(w, r)
+	case "backup":
+		if h.backup == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleBackup(w, r)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (h *adminHandler) handlePrune(w http.ResponseWriter, r *http.Request) {
+	report, err := h.svc.Prune(r.Context(), h.retention)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, pruneResponse{PruneReport: report, BytesFreed: report.Freed()})
+}
+
+func (h *adminHandler) handleBackup(w http.ResponseWriter, r *http.Request) {
+	info, err := h.backup(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, info)
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ArtifactDiff names the unified diff of the workspace changes a run made
+const ArtifactDiff = "diff"
+
+// Artifact describes content a run produced besides its output lines.
+// Truncated is set when the producer cut the content to a size limit.
+type Artifact struct {
+	RequestID int64  `json:"request_id"`
+	Name      string `json:"name"`
+	Size      int    `json:"size"`
+	Truncated bool   `json:"truncated"`
+	CreatedAt string `json:"created_at"`
+}
+
+// SaveArtifact stores content as the request's artifact a.Name, replacing
+// an earlier one. The content goes to the blobs table.
+func (s *Store) SaveArtifact(ctx context.Context, a Artifact, content []byte) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	hash := blobHash(content)
+	return retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := putBlob(ctx, tx, hash, content, now); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT INTO request_artifacts (request_id, name, blob_hash, size, truncated, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (request_id, name) DO UPDATE SET
+				blob_hash = excluded.blob_hash,
+				size = excluded.size,
+				truncated = excluded.truncated,
+				created_at = excluded.created_at`,
+			a.RequestID, a.Name, hash, len(content), a.Truncated, now,
+		)
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// GetArtifact returns a request's artifact and its content
+func (s *Store) GetArtifact(ctx context.Context, requestID int64, name string) (Artifact, []byte, bool, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT request_id, name, blob_hash, size, truncated, created_at FROM request_artifacts WHERE request_id = ? AND name = ?",
+		requestID, name,
+	)
+	var a Artifact
+	var hash string
+	if err := row.Scan(&a.RequestID, &a.Name, &hash, &a.Size, &a.Truncated, &a.CreatedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return Artifact{}, nil, false, nil
+		}
+		return Artifact{}, nil, false, err
+	}
+	content, ok, err := s.GetBlob(ctx, hash)
+	if err != nil || !ok {
+		return Artifact{}, nil, false, err
+	}
+	return a, content, true, nil
+}
+
+// ListArtifacts returns a request's artifacts by name, without content
+func (s *Store) ListArtifacts(ctx context.Context, requestID int64) ([]Artifact, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT request_id, name, size, truncated, created_at FROM request_artifacts WHERE request_id = ? ORDER BY name",
+		requestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	artifacts := []Artifact{}
+	for rows.Next() {
+		var a Artifact
+		if err := rows.Scan(&a.RequestID, &a.Name, &a.Size, &a.Truncated, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		artifacts = append(artifacts, a)
+	}
+	return artifacts, rows.Err()
+}
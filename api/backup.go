@@ -0,0 +1,212 @@
+package api
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupPrefix names the files written by BackupToDir so rotation only
+// ever touches its own backups
+const backupPrefix = "codex-launcher-"
+
+// BackupInfo describes a finished backup
+type BackupInfo struct {
+	Path          string `json:"path"`
+	Size          int64  `json:"size"`
+	SchemaVersion int    `json:"schema_version"`
+	CreatedAt     string `json:"created_at"`
+}
+
+// Backup writes a consistent snapshot of the live database to dest using
+// VACUUM INTO, optionally gzip-compressed. Writers are not blocked and the
+// file only appears at dest once it is complete.
+func (s *Store) Backup(ctx context.Context, dest string, compress bool) (BackupInfo, error) {
+	version, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	snapshot := dest + ".partial"
+	if compress {
+		snapshot = strings.TrimSuffix(dest, ".gz") + ".snapshot"
+	}
+	_ = os.Remove(snapshot)
+	defer os.Remove(snapshot)
+	if _, err := s.db.ExecContext(ctx, "VACUUM INTO ?", snapshot); err != nil {
+		return BackupInfo{}, fmt.Errorf("snapshot failed: %w", err)
+	}
+
+	if compress {
+		partial := dest + ".partial"
+		defer os.Remove(partial)
+		if err := gzipFile(snapshot, partial); err != nil {
+			return BackupInfo{}, err
+		}
+		snapshot = partial
+	}
+	if err := os.Rename(snapshot, dest); err != nil {
+		return BackupInfo{}, err
+	}
+	st, err := os.Stat(dest)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	return BackupInfo{
+		Path:          dest,
+		Size:          st.Size(),
+		SchemaVersion: version,
+		CreatedAt:     time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// BackupToDir writes a timestamped backup into dir and then deletes all
+// but the newest keep backups there. keep <= 0 disables rotation.
+func (s *Store) BackupToDir(ctx context.Context, dir string, compress bool, keep int) (BackupInfo, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return BackupInfo{}, err
+	}
+	name := backupPrefix + time.Now().UTC().Format("20060102-150405") + ".sqlite3"
+	if compress {
+		name += ".gz"
+	}
+	info, err := s.Backup(ctx, filepath.Join(dir, name), compress)
+	if err != nil {
+		return info, err
+	}
+	if keep > 0 {
+		if err := rotateBackups(dir, keep); err != nil {
+			return info, fmt.Errorf("rotation failed: %w", err)
+		}
+	}
+	return info, nil
+}
+
+// rotateBackups removes the oldest backups in dir beyond keep. Names embed
+// a sortable timestamp, so lexical order is age order.
+func rotateBackups(dir string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, backupPrefix) && !strings.HasSuffix(name, ".partial") && !strings.HasSuffix(name, ".snapshot") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// CheckBackup verifies that the backup file at path is intact and no newer
+// than this binary's schema, returning its schema version. Compressed
+// backups, recognised by their content whatever they are named, are
+// expanded to a temporary file next to path; the caller gets the path of
+// the plain SQLite file to restore and a cleanup func.
+func CheckBackup(ctx context.Context, path string) (plain string, version int, cleanup func(), err error) {
+	cleanup = func() {}
+	plain = path
+	compressed, err := isGzip(path)
+	if err != nil {
+		return "", 0, cleanup, err
+	}
+	if compressed {
+		plain = strings.TrimSuffix(path, ".gz") + ".restore"
+		if err := gunzipFile(path, plain); err != nil {
+			return "", 0, cleanup, err
+		}
+		cleanup = func() { os.Remove(plain) }
+	}
+
+	db, err := sql.Open("sqlite", "file:"+plain+"?mode=ro")
+	if err != nil {
+		return "", 0, cleanup, err
+	}
+	defer db.Close()
+	var check string
+	if err := db.QueryRowContext(ctx, "PRAGMA integrity_check").Scan(&check); err != nil {
+		return "", 0, cleanup, fmt.Errorf("not a readable database: %w", err)
+	}
+	if check != "ok" {
+		return "", 0, cleanup, fmt.Errorf("integrity check failed: %s", check)
+	}
+	// backups of databases from before schema versioning have no table
+	_ = db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	if version > LatestSchemaVersion() {
+		return "", version, cleanup, fmt.Errorf("%w: backup at version %d, binary supports %d", ErrSchemaTooNew, version, LatestSchemaVersion())
+	}
+	return plain, version, cleanup, nil
+}
+
+// isGzip reports whether the file at path starts with the gzip magic bytes
+func isGzip(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		// too short to be gzip; the integrity check reports what it is
+		return false, nil
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b, nil
+}
+
+func gzipFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func gunzipFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, zr); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,49 @@
+package api_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"almono/api"
+)
+
+// TestCheckBackupDetectsGzip checks a compressed backup is recognised by
+// its content when it was written under a name without .gz
+func TestCheckBackupDetectsGzip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := api.OpenStore(filepath.Join(dir, "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateRequest(ctx, api.NewRequest{Prompt: "kept"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compress := range []bool{true, false} {
+		dest := filepath.Join(dir, "backup.sqlite3")
+		if compress {
+			dest = filepath.Join(dir, "compressed.sqlite3")
+		}
+		if _, err := store.Backup(ctx, dest, compress); err != nil {
+			t.Fatal(err)
+		}
+		plain, version, cleanup, err := api.CheckBackup(ctx, dest)
+		if err != nil {
+			cleanup()
+			t.Fatalf("compress=%v: %v", compress, err)
+		}
+		if version != api.LatestSchemaVersion() {
+			t.Errorf("compress=%v: version %d, want %d", compress, version, api.LatestSchemaVersion())
+		}
+		if (plain != dest) != compress {
+			t.Errorf("compress=%v: restoring from %s", compress, plain)
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"unicode/utf8"
+)
+
+const (
+	// spillThreshold is the content size above which output moves to a blob
+	spillThreshold = 16 * 1024
+	// previewSize is how much of spilled content stays inline
+	previewSize = 2 * 1024
+)
+
+// spillLine moves oversized content into the blobs table and returns the
+// line with a preview in its place. Identical content is stored once.
+func spillLine(ctx context.Context, tx *sql.Tx, line OutputLine, now string) (OutputLine, error) {
+	spilled, ok := splitOversized(line)
+	if !ok {
+		return line, nil
+	}
+	if err := putBlob(ctx, tx, spilled.BlobHash, []byte(line.Content), now); err != nil {
+		return line, err
+	}
+	return spilled, nil
+}
+
+// putBlob stores content compressed under hash unless it is already stored
+func putBlob(ctx context.Context, tx *sql.Tx, hash string, content []byte, now string) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(
+		ctx,
+		"INSERT OR IGNORE INTO blobs (hash, size, data, created_at) VALUES (?, ?, ?, ?)",
+		hash, len(content), buf.Bytes(), now,
+	)
+	return err
+}
+
+// blobHash is the key content is stored under
+func blobHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// splitOversized returns line with its content replaced by a preview and
+// the content hash recorded, or false when the content is small enough
+// to stay inline
+func splitOversized(line OutputLine) (OutputLine, bool) {
+	if len(line.Content) <= spillThreshold {
+		return line, false
+	}
+	line.BlobHash = blobHash([]byte(line.Content))
+	line.FullSize = len(line.Content)
+	line.Content = preview(line.Content, previewSize)
+	return line, true
+}
+
+// preview cuts s to at most n bytes without splitting a UTF-8 sequence
+func preview(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// GetBlob returns the decompressed content stored under hash
+func (s *Store) GetBlob(ctx context.Context, hash string) ([]byte, bool, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT data FROM blobs WHERE hash = ?", hash)
+	var data []byte
+	if err := row.Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false, err
+	}
+	defer zr.Close()
+	content, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, false, err
+	}
+	return content, true, nil
+}
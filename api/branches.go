@@ -0,0 +1,80 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// states of a request branch
+const (
+	// BranchRunning is a branch codex is still working on
+	BranchRunning = "running"
+	// BranchOpen holds a commit waiting to be merged or discarded
+	BranchOpen = "open"
+	// BranchEmpty is a run that changed nothing; its branch is deleted
+	BranchEmpty     = "empty"
+	BranchMerged    = "merged"
+	BranchDiscarded = "discarded"
+)
+
+// RequestBranch is the git branch a request ran on. RepoDir is the top of
+// the checkout the worker's workdir is in; merges and discards run there.
+type RequestBranch struct {
+	RequestID int64  `json:"request_id"`
+	RepoDir   string `json:"repo_dir"`
+	Branch    string `json:"branch"`
+	// Target is the branch the request branch was created from and is
+	// merged into by default; empty when the workdir was detached
+	Target    string `json:"target"`
+	BaseSHA   string `json:"base_sha"`
+	CommitSHA string `json:"commit_sha"`
+	State     string `json:"state"`
+	MergeSHA  string `json:"merge_sha"`
+	// Error is why the last merge or discard failed
+	Error     string `json:"error"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// SaveBranch records a request's branch, replacing what was recorded
+func (s *Store) SaveBranch(ctx context.Context, b RequestBranch) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return retry(ctx, func() error {
+		_, err := s.w.ExecContext(
+			ctx,
+			`INSERT INTO request_branches (request_id, repo_dir, branch, target, base_sha, commit_sha, state, merge_sha, error, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (request_id) DO UPDATE SET
+				repo_dir = excluded.repo_dir,
+				branch = excluded.branch,
+				target = excluded.target,
+				base_sha = excluded.base_sha,
+				commit_sha = excluded.commit_sha,
+				state = excluded.state,
+				merge_sha = excluded.merge_sha,
+				error = excluded.error,
+				updated_at = excluded.updated_at`,
+			b.RequestID, b.RepoDir, b.Branch, b.Target, b.BaseSHA, b.CommitSHA, b.State, b.MergeSHA, b.Error, now,
+		)
+		return err
+	})
+}
+
+// GetBranch returns the branch a request ran on
+func (s *Store) GetBranch(ctx context.Context, requestID int64) (RequestBranch, bool, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT request_id, repo_dir, branch, target, base_sha, commit_sha, state, merge_sha, error, updated_at
+		FROM request_branches WHERE request_id = ?`,
+		requestID,
+	)
+	var b RequestBranch
+	err := row.Scan(&b.RequestID, &b.RepoDir, &b.Branch, &b.Target, &b.BaseSHA, &b.CommitSHA, &b.State, &b.MergeSHA, &b.Error, &b.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return RequestBranch{}, false, nil
+	}
+	if err != nil {
+		return RequestBranch{}, false, err
+	}
+	return b, true, nil
+}
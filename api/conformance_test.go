@@ -0,0 +1,980 @@
+package api_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"almono/api"
+)
+
+// TestStoreConformance runs the same checks against the SQLite Store and
+// MemStore so the two keep behaving alike
+func TestStoreConformance(t *testing.T) {
+	stores := map[string]func(t *testing.T) api.RequestStore{
+		"sqlite": func(t *testing.T) api.RequestStore {
+			store, err := api.OpenStore(filepath.Join(t.TempDir(), "db.sqlite3"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { store.Close() })
+			if err := store.Init(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+		"mem": func(t *testing.T) api.RequestStore { return api.NewMemStore() },
+	}
+	cases := map[string]func(t *testing.T, store api.RequestStore){
+		"CreateAndGet":        testCreateAndGet,
+		"TagsAreCopied":       testTagsAreCopied,
+		"ListFilters":         testListFilters,
+		"ListCursors":         testListCursors,
+		"UnknownCursors":      testUnknownCursors,
+		"StatusTransitions":   testStatusTransitions,
+		"OutputLines":         testOutputLines,
+		"Threads":             testThreads,
+		"PipelineSkipCascade": testPipelineSkipCascade,
+		"Schedules":           testSchedules,
+		"PruneByAge":          testPruneByAge,
+		"WorkdirLock":         testWorkdirLock,
+		"SortByDuration":      testSortByDuration,
+		"SortKeys":            testSortKeys,
+		"ModelAndUsage":       testModelAndUsage,
+		"SpilledOutput":       testSpilledOutput,
+		"Search":              testSearch,
+		"Files":               testFiles,
+		"Artifacts":           testArtifacts,
+		"Branches":            testBranches,
+		"SnapshotsAndEvents":  testSnapshotsAndEvents,
+		"ListPipelines":       testListPipelines,
+		"CompleteRequest":     testCompleteRequest,
+	}
+	for storeName, newStore := range stores {
+		for caseName, run := range cases {
+			t.Run(storeName+"/"+caseName, func(t *testing.T) {
+				run(t, newStore(t))
+			})
+		}
+	}
+}
+
+func mustCreate(t *testing.T, store api.RequestStore, nr api.NewRequest) api.Request {
+	t.Helper()
+	req, err := store.CreateRequest(context.Background(), nr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func mustGet(t *testing.T, store api.RequestStore, id int64) api.Request {
+	t.Helper()
+	req, ok, err := store.GetRequest(context.Background(), id)
+	if err != nil || !ok {
+		t.Fatalf("GetRequest(%d): %v %v", id, ok, err)
+	}
+	return req
+}
+
+func ids(reqs []api.Request) []int64 {
+	out := []int64{}
+	for _, req := range reqs {
+		out = append(out, req.ID)
+	}
+	return out
+}
+
+func testCreateAndGet(t *testing.T, store api.RequestStore) {
+	created := mustCreate(t, store, api.NewRequest{Prompt: "fix it", Project: "almono", Model: "gpt-5-codex", Tags: []string{" CI", "tests", "ci"}})
+	got := mustGet(t, store, created.ID)
+	if got.Prompt != "fix it" || got.Project != "almono" || got.Model != "gpt-5-codex" || got.Status != api.StatusPending {
+		t.Errorf("GetRequest returned %+v", got)
+	}
+	if !slices.Equal(got.Tags, []string{"ci", "tests"}) || !slices.Equal(created.Tags, got.Tags) {
+		t.Errorf("tags %v and %v, want [ci tests]", created.Tags, got.Tags)
+	}
+	if got.ThreadID != got.ID || got.QueuedAtMs == 0 || got.StartedAtMs != 0 || got.CreatedAt == "" {
+		t.Errorf("new request has ThreadID %d, QueuedAtMs %d, StartedAtMs %d, CreatedAt %q", got.ThreadID, got.QueuedAtMs, got.StartedAtMs, got.CreatedAt)
+	}
+	if _, ok, err := store.GetRequest(context.Background(), created.ID+100); ok || err != nil {
+		t.Errorf("GetRequest of a missing request returned %v, %v", ok, err)
+	}
+}
+
+func testTagsAreCopied(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	tags := []string{"a", "b"}
+	created := mustCreate(t, store, api.NewRequest{Prompt: "p", Tags: tags})
+	tags[0] = "changed"
+	created.Tags[1] = "changed"
+	got := mustGet(t, store, created.ID)
+	got.Tags[0] = "changed"
+	list, err := store.ListRequests(ctx, api.ListQuery{}, api.Cursor{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list[0].Tags[1] = "changed"
+	if got := mustGet(t, store, created.ID); !slices.Equal(got.Tags, []string{"a", "b"}) {
+		t.Errorf("stored tags changed to %v", got.Tags)
+	}
+
+	schedTags := []string{"nightly"}
+	sched, err := store.CreateSchedule(ctx, api.Schedule{Cron: "@daily", TimeZone: "UTC", Prompt: "p", Missed: api.MissedOnce, Tags: schedTags})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedTags[0] = "changed"
+	read, _, err := store.GetSchedule(ctx, sched.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read.Tags[0] = "changed"
+	if read, _, _ := store.GetSchedule(ctx, sched.ID); !slices.Equal(read.Tags, []string{"nightly"}) {
+		t.Errorf("stored schedule tags changed to %v", read.Tags)
+	}
+}
+
+func testListFilters(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	a := mustCreate(t, store, api.NewRequest{Prompt: "a", Project: "one", Tags: []string{"x"}})
+	b := mustCreate(t, store, api.NewRequest{Prompt: "b", Project: "two", Tags: []string{"x", "y"}})
+	c := mustCreate(t, store, api.NewRequest{Prompt: "c", Project: "one", Model: "m"})
+	if err := store.UpdateRequest(ctx, c.ID, api.StatusCancelled, ""); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		q    api.ListQuery
+		want []int64
+	}{
+		{api.ListQuery{}, []int64{c.ID, b.ID, a.ID}},
+		{api.ListQuery{Asc: true}, []int64{a.ID, b.ID, c.ID}},
+		{api.ListQuery{Project: "one"}, []int64{c.ID, a.ID}},
+		{api.ListQuery{Tag: "x"}, []int64{b.ID, a.ID}},
+		{api.ListQuery{Tag: "y", Project: "one"}, []int64{}},
+		{api.ListQuery{Status: "cancelled"}, []int64{c.ID}},
+		{api.ListQuery{Model: "m"}, []int64{c.ID}},
+	}
+	for _, tt := range tests {
+		got, err := store.ListRequests(ctx, tt.q, api.Cursor{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ids(got), tt.want) {
+			t.Errorf("%+v: got %v, want %v", tt.q, ids(got), tt.want)
+		}
+	}
+}
+
+func testListCursors(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	var all []int64
+	for range 7 {
+		all = append(all, mustCreate(t, store, api.NewRequest{Prompt: "p"}).ID)
+	}
+	slices.Reverse(all)
+	page := func(cur api.Cursor) []int64 {
+		t.Helper()
+		got, err := store.ListRequests(ctx, api.ListQuery{}, cur, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gotIDs, err := store.ListRequestIDs(ctx, api.ListQuery{}, cur, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(gotIDs, ids(got)) {
+			t.Errorf("%+v: ListRequestIDs returned %v, ListRequests %v", cur, gotIDs, ids(got))
+		}
+		return ids(got)
+	}
+	if got := page(api.Cursor{}); !slices.Equal(got, all[0:3]) {
+		t.Errorf("first page %v, want %v", got, all[0:3])
+	}
+	if got := page(api.Cursor{After: all[2]}); !slices.Equal(got, all[3:6]) {
+		t.Errorf("after %d: %v, want %v", all[2], got, all[3:6])
+	}
+	if got := page(api.Cursor{After: all[5]}); !slices.Equal(got, all[6:]) {
+		t.Errorf("after %d: %v, want %v", all[5], got, all[6:])
+	}
+	if got := page(api.Cursor{Before: all[3]}); !slices.Equal(got, all[0:3]) {
+		t.Errorf("before %d: %v, want %v", all[3], got, all[0:3])
+	}
+	if got := page(api.Cursor{Before: all[1]}); !slices.Equal(got, all[0:1]) {
+		t.Errorf("before %d: %v, want %v", all[1], got, all[0:1])
+	}
+}
+
+func testUnknownCursors(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	for range 3 {
+		mustCreate(t, store, api.NewRequest{Prompt: "p"})
+	}
+	for _, cur := range []api.Cursor{{After: 99}, {Before: 99}} {
+		got, err := store.ListRequests(ctx, api.ListQuery{}, cur, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 0 {
+			t.Errorf("%+v returned %v, want nothing", cur, ids(got))
+		}
+	}
+}
+
+func testStatusTransitions(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	first := mustCreate(t, store, api.NewRequest{Prompt: "first"})
+	second := mustCreate(t, store, api.NewRequest{Prompt: "second"})
+
+	claimed, ok, err := store.ClaimNextPending(ctx)
+	if err != nil || !ok || claimed.ID != first.ID || claimed.Status != api.StatusProcessing || claimed.StartedAtMs == 0 {
+		t.Fatalf("ClaimNextPending returned %+v, %v, %v", claimed, ok, err)
+	}
+	if running, ok, err := store.GetProcessingRequest(ctx); err != nil || !ok || running.ID != first.ID {
+		t.Errorf("GetProcessingRequest returned %+v, %v, %v", running, ok, err)
+	}
+	if err := store.UpdateRequest(ctx, first.ID, api.StatusPending, ""); !errors.As(err, new(*api.TransitionError)) {
+		t.Errorf("processing to pending returned %v, want a TransitionError", err)
+	}
+	if err := store.UpdateRequest(ctx, first.ID, api.StatusSkipped, ""); !errors.As(err, new(*api.TransitionError)) {
+		t.Errorf("processing to skipped returned %v, want a TransitionError", err)
+	}
+	if err := store.UpdateRequest(ctx, first.ID, api.StatusProcessed, "done"); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, store, first.ID); got.Status != api.StatusProcessed || got.Response != "done" || got.FinishedAtMs == 0 {
+		t.Errorf("processed request is %+v", got)
+	}
+	if cancelled, err := store.CancelRequest(ctx, first.ID); cancelled || err != nil {
+		t.Errorf("cancelling a processed request returned %v, %v", cancelled, err)
+	}
+
+	if _, _, err := store.ClaimNextPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.FailRequest(ctx, second.ID, api.Failure{Kind: api.FailureExit, Message: "exit status 1", StderrTail: []string{"boom"}}); err != nil {
+		t.Fatal(err)
+	}
+	got := mustGet(t, store, second.ID)
+	if got.Status != api.StatusError || got.Failure == nil || got.Failure.Kind != api.FailureExit || !slices.Equal(got.Failure.StderrTail, []string{"boom"}) {
+		t.Errorf("failed request is %+v", got)
+	}
+
+	third := mustCreate(t, store, api.NewRequest{Prompt: "third"})
+	if cancelled, err := store.CancelRequest(ctx, third.ID); !cancelled || err != nil {
+		t.Errorf("cancelling a pending request returned %v, %v", cancelled, err)
+	}
+	if _, ok, err := store.ClaimNextPending(ctx); ok || err != nil {
+		t.Errorf("ClaimNextPending with nothing pending returned %v, %v", ok, err)
+	}
+}
+
+func testOutputLines(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	req := mustCreate(t, store, api.NewRequest{Prompt: "p"})
+	if err := store.AddOutputLines(ctx, []api.OutputLine{
+		{RequestID: req.ID, LineNum: 1, LineType: "reasoning", Content: "one"},
+		{RequestID: req.ID, LineNum: 2, LineType: "agent_message", Content: "two"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddOutputLine(ctx, req.ID, 3, "agent_message", "three"); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := store.GetOutputLinesAfter(ctx, req.ID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != 2 || after[0].LineNum != 2 || after[1].Content != "three" {
+		t.Errorf("GetOutputLinesAfter returned %+v", after)
+	}
+	newest, err := store.GetOutputLines(ctx, req.ID, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(newest) != 2 || newest[0].LineNum != 3 || newest[1].LineNum != 2 {
+		t.Errorf("GetOutputLines returned %+v", newest)
+	}
+	for before, want := range map[int]int{0: 3, 1: 0, 3: 2, 10: 3} {
+		if n, err := store.CountOutputLines(ctx, req.ID, before); err != nil || n != want {
+			t.Errorf("CountOutputLines before %d returned %d, %v, want %d", before, n, err, want)
+		}
+	}
+	if line, ok, err := store.GetLatestOutputLine(ctx, req.ID, "agent_message"); err != nil || !ok || line.Content != "three" {
+		t.Errorf("GetLatestOutputLine returned %+v, %v, %v", line, ok, err)
+	}
+	if line, ok, err := store.GetOutputLine(ctx, req.ID, 1); err != nil || !ok || line.LineType != "reasoning" {
+		t.Errorf("GetOutputLine returned %+v, %v, %v", line, ok, err)
+	}
+	if _, ok, err := store.GetOutputLine(ctx, req.ID, 9); ok || err != nil {
+		t.Errorf("GetOutputLine of a missing line returned %v, %v", ok, err)
+	}
+}
+
+func testThreads(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	root := mustCreate(t, store, api.NewRequest{Prompt: "root"})
+	if err := store.SetSessionID(ctx, root.ID, "session-1"); err != nil {
+		t.Fatal(err)
+	}
+	reply := mustCreate(t, store, api.NewRequest{Prompt: "reply", ParentID: root.ID})
+	again := mustCreate(t, store, api.NewRequest{Prompt: "again", ParentID: reply.ID})
+	mustCreate(t, store, api.NewRequest{Prompt: "unrelated"})
+	if again.ThreadID != root.ID || again.ParentID != reply.ID || again.SessionID != "session-1" {
+		t.Errorf("follow-up is %+v", again)
+	}
+	thread, err := store.GetThread(ctx, root.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(thread); !slices.Equal(got, []int64{root.ID, reply.ID, again.ID}) {
+		t.Errorf("GetThread returned %v", got)
+	}
+}
+
+func testPipelineSkipCascade(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	p, err := store.CreatePipeline(ctx, api.NewPipeline{Name: "release", Steps: []api.NewStep{
+		{Name: "build", Prompt: "build"},
+		{Name: "test", Prompt: "test", DependsOn: []string{"build"}},
+		{Name: "deploy", Prompt: "deploy", DependsOn: []string{"test"}},
+		{Name: "docs", Prompt: "docs"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	steps := map[string]api.Request{}
+	for _, step := range p.Steps {
+		steps[step.Name] = step.Request
+	}
+	// build and docs are ready; test waits for build
+	first, _, err := store.ClaimNextPending(ctx)
+	if err != nil || first.ID != steps["build"].ID {
+		t.Fatalf("claimed %+v, %v, want build", first, err)
+	}
+	second, _, err := store.ClaimNextPending(ctx)
+	if err != nil || second.ID != steps["docs"].ID {
+		t.Fatalf("claimed %+v, %v, want docs", second, err)
+	}
+	if err := store.FailRequest(ctx, first.ID, api.Failure{Kind: api.FailureExit, Message: "exit status 2"}); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := store.GetPipeline(ctx, p.ID)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	want := map[string]api.Status{"build": api.StatusError, "test": api.StatusSkipped, "deploy": api.StatusSkipped, "docs": api.StatusProcessing}
+	for _, step := range got.Steps {
+		if step.Request.Status != want[step.Name] {
+			t.Errorf("step %s is %s, want %s", step.Name, step.Request.Status, want[step.Name])
+		}
+	}
+}
+
+func testSchedules(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	sched, err := store.CreateSchedule(ctx, api.Schedule{
+		Name: "nightly", Cron: "@daily", TimeZone: "UTC", Enabled: true, Prompt: "p", Missed: api.MissedOnce, NextRunAtMs: 1000,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, err := store.CreateSchedule(ctx, api.Schedule{Cron: "@daily", TimeZone: "UTC", Prompt: "q", Missed: api.MissedOnce, NextRunAtMs: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	due, err := store.DueSchedules(ctx, 2000)
+	if err != nil || len(due) != 1 || due[0].ID != sched.ID {
+		t.Fatalf("DueSchedules returned %+v, %v", due, err)
+	}
+	runs := []api.NewRequest{{Prompt: "p", ScheduleID: sched.ID, ScheduledForMs: 1000}}
+	reqs, ok, err := store.FireSchedule(ctx, sched.ID, 1000, 5000, 2, runs)
+	if err != nil || !ok || len(reqs) != 1 || reqs[0].ScheduleID != sched.ID || reqs[0].ScheduledForMs != 1000 {
+		t.Fatalf("FireSchedule returned %+v, %v, %v", reqs, ok, err)
+	}
+	// a second scheduler that read the same due time loses
+	if reqs, ok, err := store.FireSchedule(ctx, sched.ID, 1000, 5000, 0, runs); ok || err != nil || len(reqs) != 0 {
+		t.Errorf("second FireSchedule returned %+v, %v, %v", reqs, ok, err)
+	}
+	got, _, err := store.GetSchedule(ctx, sched.ID)
+	if err != nil || got.NextRunAtMs != 5000 || got.LastRunAtMs != 1000 || got.SkippedRuns != 2 {
+		t.Errorf("fired schedule is %+v, %v", got, err)
+	}
+
+	got.Name = "renamed"
+	if ok, err := store.UpdateSchedule(ctx, got); !ok || err != nil {
+		t.Errorf("UpdateSchedule returned %v, %v", ok, err)
+	}
+	if ok, err := store.DeleteSchedule(ctx, off.ID); !ok || err != nil {
+		t.Errorf("DeleteSchedule returned %v, %v", ok, err)
+	}
+	all, err := store.ListSchedules(ctx)
+	if err != nil || len(all) != 1 || all[0].Name != "renamed" || all[0].SkippedRuns != 2 {
+		t.Errorf("ListSchedules returned %+v, %v", all, err)
+	}
+	if ok, err := store.DeleteSchedule(ctx, off.ID); ok || err != nil {
+		t.Errorf("deleting a deleted schedule returned %v, %v", ok, err)
+	}
+}
+
+func testPruneByAge(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	old := mustCreate(t, store, api.NewRequest{Prompt: "old"})
+	if _, _, err := store.ClaimNextPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddOutputLine(ctx, old.ID, 1, "message", "old output"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateRequest(ctx, old.ID, api.StatusProcessed, "done"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	// finished after the cutoff, and still pending, so both keep their lines
+	recent := mustCreate(t, store, api.NewRequest{Prompt: "recent"})
+	if _, _, err := store.ClaimNextPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddOutputLine(ctx, recent.ID, 1, "message", "recent output"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateRequest(ctx, recent.ID, api.StatusProcessed, "done"); err != nil {
+		t.Fatal(err)
+	}
+	pending := mustCreate(t, store, api.NewRequest{Prompt: "pending"})
+	if err := store.AddOutputLine(ctx, pending.ID, 1, "message", "pending output"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the cutoff falls between the two finishes however slow the setup was
+	oldFinish, recentFinish := mustGet(t, store, old.ID).FinishedAtMs, mustGet(t, store, recent.ID).FinishedAtMs
+	maxAge := time.Since(time.UnixMilli((oldFinish + recentFinish) / 2))
+	report, err := store.Prune(ctx, api.RetentionPolicy{MaxAge: maxAge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.LinesDeleted != 1 {
+		t.Errorf("deleted %d lines, want 1", report.LinesDeleted)
+	}
+	for id, want := range map[int64]int{old.ID: 0, recent.ID: 1, pending.ID: 1} {
+		if total, err := store.CountOutputLines(ctx, id, 0); err != nil || total != want {
+			t.Errorf("request %d has %d lines, want %d (%v)", id, total, want, err)
+		}
+	}
+}
+
+func testWorkdirLock(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour).UnixMilli()
+	first := mustCreate(t, store, api.NewRequest{Prompt: "first"})
+	if _, _, err := store.ClaimNextPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if locked, err := store.LockWorkdir(ctx, 1, later); locked || err != nil {
+		t.Errorf("locking while a request runs returned %v, %v", locked, err)
+	}
+	if err := store.UpdateRequest(ctx, first.ID, api.StatusProcessed, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	second := mustCreate(t, store, api.NewRequest{Prompt: "second"})
+	if locked, err := store.LockWorkdir(ctx, 1, later); !locked || err != nil {
+		t.Fatalf("locking an idle workdir returned %v, %v", locked, err)
+	}
+	if locked, err := store.LockWorkdir(ctx, 2, later); locked || err != nil {
+		t.Errorf("locking a locked workdir returned %v, %v", locked, err)
+	}
+	if req, ok, err := store.ClaimNextPending(ctx); ok || err != nil {
+		t.Errorf("claiming while locked returned %+v, %v, %v", req, ok, err)
+	}
+	if err := store.UnlockWorkdir(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := store.ClaimNextPending(ctx); ok {
+		t.Errorf("another rollback released the lock")
+	}
+	if err := store.UnlockWorkdir(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if req, ok, err := store.ClaimNextPending(ctx); !ok || err != nil || req.ID != second.ID {
+		t.Fatalf("claiming after unlocking returned %+v, %v, %v", req, ok, err)
+	}
+	if err := store.UpdateRequest(ctx, second.ID, api.StatusProcessed, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// a lock left behind by a rollback that died expires
+	third := mustCreate(t, store, api.NewRequest{Prompt: "third"})
+	if locked, err := store.LockWorkdir(ctx, 3, time.Now().Add(-time.Second).UnixMilli()); !locked || err != nil {
+		t.Fatalf("locking returned %v, %v", locked, err)
+	}
+	if req, ok, err := store.ClaimNextPending(ctx); !ok || err != nil || req.ID != third.ID {
+		t.Errorf("claiming past an expired lock returned %+v, %v, %v", req, ok, err)
+	}
+}
+
+// testSortByDuration runs requests for different times and checks ones
+// that never ran, cancelled while pending or still running, come last
+func testSortByDuration(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	run := func(prompt string, d time.Duration) api.Request {
+		t.Helper()
+		req := mustCreate(t, store, api.NewRequest{Prompt: prompt})
+		if _, _, err := store.ClaimNextPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(d)
+		if err := store.UpdateRequest(ctx, req.ID, api.StatusProcessed, ""); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	long := run("long", 40*time.Millisecond)
+	cancelled := mustCreate(t, store, api.NewRequest{Prompt: "cancelled"})
+	if ok, err := store.CancelRequest(ctx, cancelled.ID); !ok || err != nil {
+		t.Fatalf("cancelling returned %v, %v", ok, err)
+	}
+	short := run("short", 10*time.Millisecond)
+	running := mustCreate(t, store, api.NewRequest{Prompt: "running"})
+	if _, _, err := store.ClaimNextPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		asc  bool
+		want []int64
+	}{
+		{false, []int64{long.ID, short.ID, running.ID, cancelled.ID}},
+		{true, []int64{short.ID, long.ID, cancelled.ID, running.ID}},
+	} {
+		got, err := store.ListRequests(ctx, api.ListQuery{Sort: api.SortDuration, Asc: tt.asc}, api.Cursor{}, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(ids(got), tt.want) {
+			t.Errorf("asc=%v: got %v, want %v", tt.asc, ids(got), tt.want)
+		}
+	}
+}
+
+// testSortKeys checks the order of every sort key both ways, and that
+// paging through it with cursors in either direction gives the same list
+func testSortKeys(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	finish := func(req api.Request, tokens int64) {
+		t.Helper()
+		if _, _, err := store.ClaimNextPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.AddUsage(ctx, req.ID, tokens, 0); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond)
+		if err := store.UpdateRequest(ctx, req.ID, api.StatusProcessed, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a := mustCreate(t, store, api.NewRequest{Prompt: "a"})
+	finish(a, 50)
+	b := mustCreate(t, store, api.NewRequest{Prompt: "b"})
+	if _, err := store.CancelRequest(ctx, b.ID); err != nil {
+		t.Fatal(err)
+	}
+	c := mustCreate(t, store, api.NewRequest{Prompt: "c"})
+	finish(c, 5)
+	f := mustCreate(t, store, api.NewRequest{Prompt: "f"})
+	finish(f, 50)
+	d := mustCreate(t, store, api.NewRequest{Prompt: "d"})
+	if _, _, err := store.ClaimNextPending(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddUsage(ctx, d.ID, 3, 4); err != nil {
+		t.Fatal(err)
+	}
+	e := mustCreate(t, store, api.NewRequest{Prompt: "e"})
+
+	want := map[api.ListQuery][]int64{
+		{Sort: api.SortCreated}:             {e.ID, d.ID, f.ID, c.ID, b.ID, a.ID},
+		{Sort: api.SortCreated, Asc: true}:  {a.ID, b.ID, c.ID, f.ID, d.ID, e.ID},
+		{Sort: api.SortTokens}:              {f.ID, a.ID, d.ID, c.ID, e.ID, b.ID},
+		{Sort: api.SortTokens, Asc: true}:   {c.ID, d.ID, a.ID, f.ID, b.ID, e.ID},
+		{Sort: api.SortDuration}:            nil,
+		{Sort: api.SortDuration, Asc: true}: nil,
+	}
+	for q, order := range want {
+		all, err := store.ListRequests(ctx, q, api.Cursor{}, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if order != nil && !slices.Equal(ids(all), order) {
+			t.Errorf("%+v: got %v, want %v", q, ids(all), order)
+		}
+		// durations vary with timing, so only their grouping is fixed
+		if q.Sort == api.SortDuration {
+			for i, req := range all {
+				if ran := req.Duration() > 0; ran != (i < 3) {
+					t.Errorf("%+v: %v has duration %v at position %d", q, ids(all), req.Duration(), i)
+				}
+			}
+		}
+
+		var forward []int64
+		for cur := (api.Cursor{}); ; {
+			page, err := store.ListRequests(ctx, q, cur, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			forward = append(forward, ids(page)...)
+			cur = api.Cursor{After: page[len(page)-1].ID}
+		}
+		if !slices.Equal(forward, ids(all)) {
+			t.Errorf("%+v: paging forward gave %v, want %v", q, forward, ids(all))
+		}
+		var backward []int64
+		for cur := (api.Cursor{Before: all[len(all)-1].ID}); ; {
+			page, err := store.ListRequests(ctx, q, cur, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			backward = append(ids(page), backward...)
+			cur = api.Cursor{Before: page[0].ID}
+		}
+		if !slices.Equal(append(backward, all[len(all)-1].ID), ids(all)) {
+			t.Errorf("%+v: paging backward gave %v, want %v", q, backward, ids(all))
+		}
+	}
+}
+
+func testModelAndUsage(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	req := mustCreate(t, store, api.NewRequest{Prompt: "p", Model: "first"})
+	if err := store.SetRequestModel(ctx, req.ID, "second"); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := store.AddUsage(ctx, req.ID, 10, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := mustGet(t, store, req.ID)
+	if got.Model != "second" || got.InputTokens != 20 || got.OutputTokens != 6 || got.Tokens() != 26 {
+		t.Errorf("request is %+v", got)
+	}
+	if err := store.SetRequestModel(ctx, req.ID+100, "x"); err != nil {
+		t.Errorf("setting the model of a missing request returned %v", err)
+	}
+}
+
+func testSpilledOutput(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	req := mustCreate(t, store, api.NewRequest{Prompt: "p"})
+	big := strings.Repeat("spilled output ", 2000)
+	if err := store.AddOutputLine(ctx, req.ID, 1, "command_output", big); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddOutputLine(ctx, req.ID, 2, "message", "small"); err != nil {
+		t.Fatal(err)
+	}
+	line, ok, err := store.GetOutputLine(ctx, req.ID, 1)
+	if err != nil || !ok {
+		t.Fatal(ok, err)
+	}
+	if !line.Truncated() || line.FullSize != len(big) || len(line.Content) >= len(big) || !strings.HasPrefix(big, line.Content) {
+		t.Errorf("spilled line has content of %d bytes, full size %d, hash %q", len(line.Content), line.FullSize, line.BlobHash)
+	}
+	data, ok, err := store.GetBlob(ctx, line.BlobHash)
+	if err != nil || !ok || string(data) != big {
+		t.Errorf("GetBlob returned %d bytes, %v, %v", len(data), ok, err)
+	}
+	if small, _, _ := store.GetOutputLine(ctx, req.ID, 2); small.Truncated() || small.Content != "small" {
+		t.Errorf("small line is %+v", small)
+	}
+	if _, ok, err := store.GetBlob(ctx, "missing"); ok || err != nil {
+		t.Errorf("GetBlob of a missing hash returned %v, %v", ok, err)
+	}
+}
+
+func testSearch(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	one := mustCreate(t, store, api.NewRequest{Prompt: "fix the flaky login test"})
+	two := mustCreate(t, store, api.NewRequest{Prompt: "write release notes"})
+	if err := store.AddOutputLines(ctx, []api.OutputLine{
+		{RequestID: two.ID, LineNum: 1, LineType: "message", Content: "the login test is flaky because of a timeout"},
+		{RequestID: two.ID, LineNum: 2, LineType: "message", Content: "nothing to see"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	type key struct {
+		id   int64
+		line int
+		kind string
+	}
+	tests := []struct {
+		query string
+		want  []key
+	}{
+		{"flaky login", []key{{one.ID, 0, "prompt"}, {two.ID, 1, "message"}}},
+		{"release", []key{{two.ID, 0, "prompt"}}},
+		{"timeout", []key{{two.ID, 1, "message"}}},
+		{"flaky release", nil},
+		{"   ", nil},
+	}
+	for _, tt := range tests {
+		hits, err := store.Search(ctx, tt.query, 0, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []key
+		for _, hit := range hits {
+			got = append(got, key{hit.RequestID, hit.LineNum, hit.LineType})
+			if !strings.Contains(hit.Snippet, "<mark>") || hit.CreatedAt == "" {
+				t.Errorf("%q: hit %+v", tt.query, hit)
+			}
+		}
+		slices.SortFunc(got, func(a, b key) int { return int(a.id-b.id)*10 + a.line - b.line })
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+	if hits, err := store.Search(ctx, "flaky", 1, 10); err != nil || len(hits) != 1 {
+		t.Errorf("searching from offset 1 returned %+v, %v", hits, err)
+	}
+	if hits, err := store.Search(ctx, "flaky", 0, 1); err != nil || len(hits) != 1 {
+		t.Errorf("searching with limit 1 returned %+v, %v", hits, err)
+	}
+}
+
+func testFiles(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	one := mustCreate(t, store, api.NewRequest{Prompt: "one"})
+	two := mustCreate(t, store, api.NewRequest{Prompt: "two"})
+	if err := store.RecordFiles(ctx, []api.RequestFile{
+		{RequestID: one.ID, Path: "web/server.go", Kind: "update", Added: 3, Removed: 1},
+		{RequestID: one.ID, Path: "README.md", Kind: "update", Added: 1},
+		{RequestID: two.ID, Path: "web/server.go", Kind: "update", Added: 2},
+		{RequestID: two.ID, Path: "web/templates/list.tmpl", Kind: "add", Added: 9},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// recorded again from the git diff, in the other order
+	if err := store.RecordFiles(ctx, []api.RequestFile{
+		{RequestID: one.ID, Path: "web/server.go", Kind: "delete", Added: 1, Removed: 7},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RecordFiles(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	files, err := store.GetRequestFiles(ctx, one.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []api.RequestFile{
+		{RequestID: one.ID, Path: "README.md", Kind: "update", Added: 1},
+		{RequestID: one.ID, Path: "web/server.go", Kind: "delete", Added: 3, Removed: 7},
+	}
+	if !slices.Equal(files, want) {
+		t.Errorf("GetRequestFiles returned %+v, want %+v", files, want)
+	}
+
+	touched := func(path string, offset, limit int) []string {
+		t.Helper()
+		touches, err := store.FilesTouched(ctx, path, offset, limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, touch := range touches {
+			if touch.Prompt == "" || touch.Status != api.StatusPending || touch.CreatedAt == "" {
+				t.Errorf("touch %+v", touch)
+			}
+			got = append(got, fmt.Sprintf("%d:%s", touch.RequestID, touch.Path))
+		}
+		return got
+	}
+	tests := []struct {
+		path          string
+		offset, limit int
+		want          []string
+	}{
+		{"web/server.go", 0, 10, []string{fmt.Sprintf("%d:web/server.go", two.ID), fmt.Sprintf("%d:web/server.go", one.ID)}},
+		{"web/", 0, 10, []string{fmt.Sprintf("%d:web/server.go", two.ID), fmt.Sprintf("%d:web/templates/list.tmpl", two.ID), fmt.Sprintf("%d:web/server.go", one.ID)}},
+		{"web/", 1, 1, []string{fmt.Sprintf("%d:web/templates/list.tmpl", two.ID)}},
+		{"web", 0, 10, nil},
+	}
+	for _, tt := range tests {
+		if got := touched(tt.path, tt.offset, tt.limit); !slices.Equal(got, tt.want) {
+			t.Errorf("FilesTouched(%q, %d, %d) returned %v, want %v", tt.path, tt.offset, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func testArtifacts(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	req := mustCreate(t, store, api.NewRequest{Prompt: "p"})
+	for _, a := range []struct {
+		name, content string
+	}{{"diff.patch", "old"}, {"diff.patch", "new diff"}, {"build.log", "ok"}} {
+		if err := store.SaveArtifact(ctx, api.Artifact{RequestID: req.ID, Name: a.name, Truncated: a.name == "build.log"}, []byte(a.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	a, content, ok, err := store.GetArtifact(ctx, req.ID, "diff.patch")
+	if err != nil || !ok || string(content) != "new diff" || a.Size != len("new diff") || a.Truncated || a.CreatedAt == "" {
+		t.Errorf("GetArtifact returned %+v, %q, %v, %v", a, content, ok, err)
+	}
+	if _, _, ok, err := store.GetArtifact(ctx, req.ID, "missing"); ok || err != nil {
+		t.Errorf("GetArtifact of a missing artifact returned %v, %v", ok, err)
+	}
+	list, err := store.ListArtifacts(ctx, req.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "build.log" || !list[0].Truncated || list[1].Name != "diff.patch" {
+		t.Errorf("ListArtifacts returned %+v", list)
+	}
+	if list, err := store.ListArtifacts(ctx, req.ID+1); err != nil || list == nil || len(list) != 0 {
+		t.Errorf("ListArtifacts of a request without any returned %+v, %v", list, err)
+	}
+}
+
+func testBranches(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	req := mustCreate(t, store, api.NewRequest{Prompt: "p"})
+	b := api.RequestBranch{RequestID: req.ID, RepoDir: "/repo", Branch: "codex/1", Target: "main", BaseSHA: "abc", State: api.BranchOpen}
+	if err := store.SaveBranch(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	b.State, b.MergeSHA = api.BranchMerged, "def"
+	if err := store.SaveBranch(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := store.GetBranch(ctx, req.ID)
+	if err != nil || !ok || got.UpdatedAt == "" {
+		t.Fatalf("GetBranch returned %+v, %v, %v", got, ok, err)
+	}
+	got.UpdatedAt = ""
+	if got != b {
+		t.Errorf("GetBranch returned %+v, want %+v", got, b)
+	}
+	if _, ok, err := store.GetBranch(ctx, req.ID+1); ok || err != nil {
+		t.Errorf("GetBranch of a request without one returned %v, %v", ok, err)
+	}
+}
+
+func testSnapshotsAndEvents(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	req := mustCreate(t, store, api.NewRequest{Prompt: "p"})
+	snap := api.RequestSnapshot{RequestID: req.ID, Dir: "/work", Path: "/snaps/request-1.tar.gz", Size: 10, Files: 2, Exclude: []string{".git", "*.log"}}
+	if err := store.SaveSnapshot(ctx, snap); err != nil {
+		t.Fatal(err)
+	}
+	got, ok, err := store.GetSnapshot(ctx, req.ID)
+	if err != nil || !ok || got.CreatedAt == "" || got.Files != 2 || !slices.Equal(got.Exclude, snap.Exclude) {
+		t.Fatalf("GetSnapshot returned %+v, %v, %v", got, ok, err)
+	}
+	got.RestoredAt = "2026-01-01T00:00:00Z"
+	if err := store.SaveSnapshot(ctx, got); err != nil {
+		t.Fatal(err)
+	}
+	if again, _, _ := store.GetSnapshot(ctx, req.ID); again.RestoredAt != got.RestoredAt || again.CreatedAt != got.CreatedAt {
+		t.Errorf("updated snapshot is %+v", again)
+	}
+	if err := store.DeleteSnapshot(ctx, req.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.GetSnapshot(ctx, req.ID); ok || err != nil {
+		t.Errorf("GetSnapshot after DeleteSnapshot returned %v, %v", ok, err)
+	}
+
+	for _, kind := range []string{api.EventSnapshot, api.EventRollback} {
+		if err := store.AddEvent(ctx, api.RequestEvent{RequestID: req.ID, Kind: kind, Message: kind}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events, err := store.ListEvents(ctx, req.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Kind != api.EventSnapshot || events[1].Kind != api.EventRollback || events[0].ID >= events[1].ID || events[0].CreatedAt == "" {
+		t.Errorf("ListEvents returned %+v", events)
+	}
+	if events, err := store.ListEvents(ctx, req.ID+1); err != nil || events == nil || len(events) != 0 {
+		t.Errorf("ListEvents of a request without any returned %+v, %v", events, err)
+	}
+}
+
+func testListPipelines(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	var created []int64
+	for _, name := range []string{"one", "two", "three"} {
+		p, err := store.CreatePipeline(ctx, api.NewPipeline{Name: name, Steps: []api.NewStep{{Name: "only", Prompt: name}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, p.ID)
+	}
+	list, err := store.ListPipelines(ctx, 1, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].ID != created[1] || list[1].ID != created[0] || list[0].Name != "two" {
+		t.Fatalf("ListPipelines returned %+v", list)
+	}
+	if len(list[0].Steps) != 1 || list[0].Steps[0].Request.Prompt != "two" {
+		t.Errorf("listed pipeline has steps %+v", list[0].Steps)
+	}
+}
+
+func testCompleteRequest(t *testing.T, store api.RequestStore) {
+	ctx := context.Background()
+	claim := func() api.Request {
+		t.Helper()
+		req := mustCreate(t, store, api.NewRequest{Prompt: "p"})
+		if _, _, err := store.ClaimNextPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	clean := claim()
+	if err := store.CompleteRequest(ctx, clean.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, store, clean.ID); got.Status != api.StatusProcessed || got.Failure != nil || got.FinishedAtMs == 0 {
+		t.Errorf("completed request is %+v", got)
+	}
+
+	warned := claim()
+	warnings := []string{"event 2 is not valid JSON"}
+	if err := store.CompleteRequest(ctx, warned.ID, warnings); err != nil {
+		t.Fatal(err)
+	}
+	got := mustGet(t, store, warned.ID)
+	if got.Status != api.StatusProcessed || got.Failure == nil || got.Failure.Kind != "" || !slices.Equal(got.Failure.Warnings, warnings) {
+		t.Errorf("request completed with warnings is %+v, failure %+v", got, got.Failure)
+	}
+
+	cancelled := claim()
+	if _, err := store.CancelRequest(ctx, cancelled.ID); err != nil {
+		t.Fatal(err)
+	}
+	var te *api.TransitionError
+	if err := store.CompleteRequest(ctx, cancelled.ID, warnings); !errors.As(err, &te) {
+		t.Errorf("completing a cancelled request returned %v", err)
+	}
+	if got := mustGet(t, store, cancelled.ID); got.Status != api.StatusCancelled || got.Failure != nil {
+		t.Errorf("cancelled request is %+v", got)
+	}
+}
@@ -0,0 +1,643 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"almono/api"
+	"almono/client"
+	"almono/web"
+)
+
+// spec is the part of the OpenAPI document the contract tests read
+type spec struct {
+	// Paths maps a path to its operations by method, next to its
+	// "parameters"
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*schema `json:"schemas"`
+	} `json:"components"`
+}
+
+type operation struct {
+	Responses map[string]struct {
+		Content map[string]struct {
+			Schema *schema `json:"schema"`
+		} `json:"content"`
+	} `json:"responses"`
+}
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Type       string             `json:"type"`
+	Properties map[string]*schema `json:"properties"`
+	Items      *schema            `json:"items"`
+	AllOf      []*schema          `json:"allOf"`
+}
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	api.NewOpenAPIHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	var doc spec
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("parsing openapi.json: %v", err)
+	}
+	return doc
+}
+
+// resolve follows $ref and merges allOf into a single object schema
+func (doc spec) resolve(s *schema) *schema {
+	if s == nil {
+		return nil
+	}
+	if name, ok := strings.CutPrefix(s.Ref, "#/components/schemas/"); ok {
+		return doc.resolve(doc.Components.Schemas[name])
+	}
+	if len(s.AllOf) == 0 {
+		return s
+	}
+	if len(s.AllOf) == 1 {
+		return doc.resolve(s.AllOf[0])
+	}
+	merged := &schema{Type: "object", Properties: map[string]*schema{}}
+	for _, part := range s.AllOf {
+		for name, prop := range doc.resolve(part).Properties {
+			merged.Properties[name] = prop
+		}
+	}
+	return merged
+}
+
+// check reports keys of v the schema does not declare, recursing into
+// objects and arrays
+func (doc spec) check(t *testing.T, where string, s *schema, v any) {
+	t.Helper()
+	s = doc.resolve(s)
+	if s == nil {
+		return
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		if s.Properties == nil {
+			return
+		}
+		for key, val := range v {
+			prop, ok := s.Properties[key]
+			if !ok {
+				t.Errorf("%s: key %q is not in the spec", where, key)
+				continue
+			}
+			doc.check(t, where+"."+key, prop, val)
+		}
+	case []any:
+		for i, item := range v {
+			doc.check(t, where+"["+strconv.Itoa(i)+"]", s.Items, item)
+		}
+	}
+}
+
+// fakeBranches and fakeSnapshots stand in for git and tar so that merge,
+// discard and rollback succeed
+type fakeBranches struct{}
+
+func (fakeBranches) Merge(ctx context.Context, b api.RequestBranch, target string) (string, error) {
+	return "abc123", nil
+}
+
+func (fakeBranches) Discard(ctx context.Context, b api.RequestBranch) error { return nil }
+
+type fakeSnapshots struct{}
+
+func (fakeSnapshots) Restore(ctx context.Context, snap api.RequestSnapshot) error { return nil }
+
+// fixture is a server holding one finished request with output, files, a
+// branch, a snapshot and history, plus a pipeline and two schedules
+type fixture struct {
+	srv      *httptest.Server
+	client   *client.Client
+	store    *api.MemStore
+	request  client.Request
+	pipeline client.Pipeline
+	schedule client.Schedule
+	// doomed is a schedule for DELETE to remove
+	doomed client.Schedule
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	ctx := context.Background()
+	store := api.NewMemStore()
+	svc := api.NewService(store)
+	svc.SetBranches(fakeBranches{})
+	svc.SetSnapshots(fakeSnapshots{})
+	admin := api.NewAdminHandler(svc, api.RetentionPolicy{}, func(ctx context.Context) (api.BackupInfo, error) {
+		return api.BackupInfo{Path: "backup.sqlite3.gz", Size: 1, SchemaVersion: 1, CreatedAt: "2026-01-01T00:00:00Z"}, nil
+	})
+	handler, err := web.NewHandler(svc, admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fixture{srv: httptest.NewServer(handler), store: store}
+	t.Cleanup(f.srv.Close)
+	f.client = client.New(f.srv.URL, f.srv.Client())
+
+	f.request, err = f.client.Submit(ctx, client.NewRequest{
+		Prompt:  "fix the flaky test",
+		Project: "almono",
+		Model:   "gpt-5-codex",
+		Tags:    []string{"ci", "tests"},
+	})
+	if err != nil {
+		t.Fatalf("Submit: %v", err)
+	}
+	id := f.request.ID
+	if _, ok, err := store.ClaimNextPending(ctx); err != nil || !ok {
+		t.Fatalf("ClaimNextPending: %v %v", ok, err)
+	}
+	steps := []func() error{
+		func() error { return store.SetSessionID(ctx, id, "session-1") },
+		func() error { return store.AddUsage(ctx, id, 120, 30) },
+		func() error {
+			return store.AddOutputLines(ctx, []api.OutputLine{
+				{RequestID: id, LineNum: 1, LineType: "reasoning", Content: "looking at the flaky test"},
+				{RequestID: id, LineNum: 2, LineType: "agent_message", Content: "fixed the flaky test"},
+			})
+		},
+		func() error {
+			return store.RecordFiles(ctx, []api.RequestFile{{RequestID: id, Path: "api/store.go", Kind: "update", Added: 3, Removed: 1}})
+		},
+		func() error {
+			return store.SaveArtifact(ctx, api.Artifact{RequestID: id, Name: api.ArtifactDiff}, []byte("--- a/api/store.go\n+++ b/api/store.go\n"))
+		},
+		func() error {
+			return store.SaveBranch(ctx, api.RequestBranch{RequestID: id, RepoDir: "/src", Branch: "codex/1", Target: "main", State: api.BranchOpen})
+		},
+		func() error {
+			return store.SaveSnapshot(ctx, api.RequestSnapshot{RequestID: id, Dir: "/src", Path: "/snapshots/1.tar.gz", Size: 10, Files: 2})
+		},
+		func() error {
+			return store.AddEvent(ctx, api.RequestEvent{RequestID: id, Kind: api.EventSnapshot, Message: "Snapshot taken"})
+		},
+		func() error { return store.UpdateRequest(ctx, id, api.StatusProcessed, "fixed the flaky test") },
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.request, err = f.client.Get(ctx, id); err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+
+	f.pipeline, err = f.client.CreatePipeline(ctx, client.NewPipeline{Name: "release", Text: "build: run the build\ntest after build: run the tests"})
+	if err != nil {
+		t.Fatalf("CreatePipeline: %v", err)
+	}
+	f.schedule, err = f.client.CreateSchedule(ctx, client.NewSchedule{Name: "nightly", Cron: "0 3 * * *", Prompt: "summarise {date}"})
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+	f.doomed, err = f.client.CreateSchedule(ctx, client.NewSchedule{Cron: "@hourly", Prompt: "check the build"})
+	if err != nil {
+		t.Fatalf("CreateSchedule: %v", err)
+	}
+	return f
+}
+
+// TestOpenAPIOperationsRouted sends every operation in the spec to the
+// server and checks it is routed, answers with a documented status and
+// returns only keys the spec declares
+func TestOpenAPIOperationsRouted(t *testing.T) {
+	doc := loadSpec(t)
+	f := newFixture(t)
+	bodies := map[string]string{
+		"POST /api/requests":                   `{"prompt":"add a changelog entry","tags":["docs"]}`,
+		"POST /api/requests/{id}/follow-up":    `{"prompt":"now add a test"}`,
+		"POST /api/requests/{id}/branch/merge": `{"target":"main"}`,
+		"POST /api/pipelines":                  `{"text":"lint: run the linter"}`,
+		"POST /api/schedules":                  `{"cron":"@daily","prompt":"tidy up"}`,
+		"PUT /api/schedules/{id}":              `{"name":"nightly","cron":"0 4 * * *","prompt":"summarise {date}"}`,
+	}
+	queries := map[string]string{
+		"/api/v1/search": "q=flaky",
+		"/api/files":     "path=api/",
+	}
+	// 409 is the documented answer for cancelling a finished request and
+	// for whichever of merge and discard finds the branch already closed
+	conflicts := map[string]bool{
+		"POST /api/requests/{id}/cancel":         true,
+		"POST /api/requests/{id}/branch/merge":   true,
+		"POST /api/requests/{id}/branch/discard": true,
+	}
+
+	var paths []string
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		for method, raw := range doc.Paths[path] {
+			if method == "parameters" {
+				continue
+			}
+			var op operation
+			if err := json.Unmarshal(raw, &op); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+			method = strings.ToUpper(method)
+			name := method + " " + path
+			t.Run(name, func(t *testing.T) {
+				id := f.request.ID
+				switch {
+				case strings.HasPrefix(path, "/api/pipelines/"):
+					id = f.pipeline.ID
+				case strings.HasPrefix(path, "/api/schedules/") && method == http.MethodDelete:
+					id = f.doomed.ID
+				case strings.HasPrefix(path, "/api/schedules/"):
+					id = f.schedule.ID
+				}
+				url := f.srv.URL + strings.NewReplacer("{id}", strconv.FormatInt(id, 10), "{num}", "1").Replace(path)
+				if q := queries[path]; q != "" {
+					url += "?" + q
+				}
+				var body io.Reader
+				if b := bodies[name]; b != "" {
+					body = strings.NewReader(b)
+				}
+				req, err := http.NewRequest(method, url, body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body != nil {
+					req.Header.Set("Content-Type", "application/json")
+				}
+				resp, err := f.srv.Client().Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+				data, err := io.ReadAll(resp.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				code := strconv.Itoa(resp.StatusCode)
+				documented, ok := op.Responses[code]
+				switch {
+				case !ok:
+					t.Fatalf("status %s is not documented; body %q", code, data)
+				case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed:
+					t.Fatalf("status %s for an existing resource; is the route missing?", code)
+				case resp.StatusCode == http.StatusConflict && !conflicts[name]:
+					t.Fatalf("unexpected conflict; body %q", data)
+				}
+				mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+				content, ok := documented.Content["application/json"]
+				if mediaType != "application/json" || !ok || content.Schema == nil {
+					return
+				}
+				var v any
+				if err := json.Unmarshal(data, &v); err != nil {
+					t.Fatalf("decoding response: %v", err)
+				}
+				doc.check(t, "response", content.Schema, v)
+			})
+		}
+	}
+}
+
+// jsonKeys returns the keys v marshals to, including omitempty fields and
+// the ones a MarshalJSON method adds
+func jsonKeys(t *testing.T, v any) []string {
+	t.Helper()
+	keys := map[string]bool{}
+	var walk func(reflect.Type)
+	walk = func(rt reflect.Type) {
+		for i := 0; i < rt.NumField(); i++ {
+			field := rt.Field(i)
+			tag := field.Tag.Get("json")
+			if field.Anonymous && tag == "" {
+				walk(field.Type)
+				continue
+			}
+			name, _, _ := strings.Cut(tag, ",")
+			if !field.IsExported() || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			keys[name] = true
+		}
+	}
+	walk(reflect.TypeOf(v))
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var marshalled map[string]any
+	if err := json.Unmarshal(data, &marshalled); err != nil {
+		t.Fatal(err)
+	}
+	for key := range marshalled {
+		keys[key] = true
+	}
+	var out []string
+	for key := range keys {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// TestSchemasMatchTypes checks the schemas in the spec name exactly the
+// JSON fields of the server and client types they describe
+func TestSchemasMatchTypes(t *testing.T) {
+	doc := loadSpec(t)
+	types := map[string][]any{
+		"CreateRequest":   {client.NewRequest{}},
+		"Request":         {api.Request{}, client.Request{}},
+		"CreatePipeline":  {client.NewPipeline{}},
+		"Pipeline":        {api.Pipeline{}, client.Pipeline{}},
+		"PipelineStep":    {api.PipelineStep{}, client.PipelineStep{}},
+		"CreateSchedule":  {client.NewSchedule{}},
+		"Schedule":        {api.Schedule{}, client.Schedule{}},
+		"Failure":         {api.Failure{}, client.Failure{}},
+		"OutputLine":      {api.OutputLine{}, client.OutputLine{}},
+		"LinesResponse":   {client.LinesResponse{}},
+		"SearchHit":       {api.SearchHit{}, client.SearchHit{}},
+		"SearchResponse":  {client.SearchResponse{}},
+		"RequestFile":     {api.RequestFile{}, client.RequestFile{}},
+		"FileTouch":       {api.FileTouch{}, client.FileTouch{}},
+		"FilesResponse":   {client.FilesResponse{}},
+		"RequestBranch":   {api.RequestBranch{}, client.Branch{}},
+		"RequestSnapshot": {api.RequestSnapshot{}, client.Snapshot{}},
+		"RequestEvent":    {api.RequestEvent{}, client.HistoryEvent{}},
+		"BackupInfo":      {api.BackupInfo{}},
+		"ListResponse":    {client.ListResponse{}},
+	}
+	for name, values := range types {
+		s, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing", name)
+			continue
+		}
+		var props []string
+		for prop := range doc.resolve(s).Properties {
+			props = append(props, prop)
+		}
+		sort.Strings(props)
+		for _, v := range values {
+			if keys := jsonKeys(t, v); !slices.Equal(keys, props) {
+				t.Errorf("%s: %T has JSON keys %v, the spec %v", name, v, keys, props)
+			}
+		}
+	}
+}
+
+// TestTailAfterPruning checks the tail is the newest lines when retention
+// has deleted the first ones and line numbers no longer start at 1
+func TestTailAfterPruning(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	req, err := f.client.Submit(ctx, client.NewRequest{Prompt: "long run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []api.OutputLine
+	for n := 5; n <= 9; n++ {
+		lines = append(lines, api.OutputLine{RequestID: req.ID, LineNum: n, LineType: "message", Content: strconv.Itoa(n)})
+	}
+	if err := f.store.AddOutputLines(ctx, lines); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		n    int
+		want []int
+	}{{2, []int{8, 9}}, {5, []int{5, 6, 7, 8, 9}}, {20, []int{5, 6, 7, 8, 9}}} {
+		tail, err := f.client.Tail(ctx, req.ID, tt.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, line := range tail.Lines {
+			got = append(got, line.LineNum)
+		}
+		if !slices.Equal(got, tt.want) || tail.Total != 5 {
+			t.Errorf("Tail(%d) returned lines %v of %d, want %v of 5", tt.n, got, tail.Total, tt.want)
+		}
+	}
+}
+
+// TestTranscriptAfterPruning checks the transcript and thread pages count
+// lines rather than line numbers when the first lines have been deleted
+func TestTranscriptAfterPruning(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	req, err := f.client.Submit(ctx, client.NewRequest{Prompt: "long run"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []api.OutputLine
+	for n := 101; n <= 250; n++ {
+		lines = append(lines, api.OutputLine{RequestID: req.ID, LineNum: n, LineType: "message", Content: "text"})
+	}
+	if err := f.store.AddOutputLines(ctx, lines); err != nil {
+		t.Fatal(err)
+	}
+	// shown returns the first and last line a page shows, and its body
+	lineID := regexp.MustCompile(`id="line-(\d+)"`)
+	shown := func(path string) (first, last int, body string) {
+		t.Helper()
+		resp, err := f.srv.Client().Get(f.srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s: %d %v", path, resp.StatusCode, err)
+		}
+		matches := lineID.FindAllStringSubmatch(string(data), -1)
+		if len(matches) == 0 {
+			t.Fatalf("GET %s shows no lines", path)
+		}
+		first, _ = strconv.Atoi(matches[0][1])
+		last, _ = strconv.Atoi(matches[len(matches)-1][1])
+		return first, last, string(data)
+	}
+	transcript := fmt.Sprintf("/requests/%d/transcript/", req.ID)
+	for query, want := range map[string][2]int{
+		"":          {101, 150},
+		"?page=2":   {151, 200},
+		"?page=3":   {201, 250},
+		"?page=9":   {201, 250},
+		"?line=160": {151, 200},
+		"?line=101": {101, 150},
+	} {
+		if first, last, _ := shown(transcript + query); first != want[0] || last != want[1] {
+			t.Errorf("transcript%s shows lines %d-%d, want %d-%d", query, first, last, want[0], want[1])
+		}
+	}
+	first, last, body := shown(fmt.Sprintf("/requests/%d/thread", req.ID))
+	if first != 151 || last != 250 || !strings.Contains(body, "50 earlier lines") {
+		t.Errorf("thread shows lines %d-%d", first, last)
+	}
+}
+
+// TestClientRoundTrip drives the server through the client and checks
+// what it sends arrives and what comes back decodes
+func TestClientRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	f := newFixture(t)
+	c := f.client
+
+	req := f.request
+	if req.Status != "processed" || req.Project != "almono" || req.Model != "gpt-5-codex" ||
+		!slices.Equal(req.Tags, []string{"ci", "tests"}) || req.SessionID != "session-1" ||
+		req.InputTokens != 120 || req.OutputTokens != 30 || req.ThreadID != req.ID {
+		t.Fatalf("Get returned %+v", req)
+	}
+	if req.QueuedAtMs == 0 || req.StartedAtMs == 0 || req.FinishedAtMs == 0 || req.CreatedAt == "" {
+		t.Errorf("timestamps missing from %+v", req)
+	}
+
+	list, err := c.List(ctx, client.ListOptions{Project: "almono", Tag: "ci"})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list.Requests) != 1 || list.Requests[0].ID != req.ID {
+		t.Errorf("List by project and tag returned %+v", list.Requests)
+	}
+
+	lines, err := c.Lines(ctx, req.ID, 0, 10)
+	if err != nil {
+		t.Fatalf("Lines: %v", err)
+	}
+	if len(lines.Lines) != 2 || lines.Lines[1].LineNum != 2 || lines.Lines[1].LineType != "agent_message" ||
+		lines.Lines[1].Content != "fixed the flaky test" || lines.Lines[1].RequestID != req.ID {
+		t.Errorf("Lines returned %+v", lines)
+	}
+	if tail, err := c.Tail(ctx, req.ID, 1); err != nil || len(tail.Lines) != 1 || tail.Lines[0].LineNum != 2 || tail.Total != 2 {
+		t.Errorf("Tail returned %+v, %v", tail, err)
+	}
+	if content, err := c.FullContent(ctx, req.ID, 1); err != nil || content != "looking at the flaky test" {
+		t.Errorf("FullContent returned %q, %v", content, err)
+	}
+
+	var events []client.Event
+	err = c.StreamEvents(ctx, req.ID, 0, func(ev client.Event) error {
+		events = append(events, ev)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("StreamEvents: %v", err)
+	}
+	if len(events) != 3 || events[0].Line == nil || events[0].Line.LineNum != 1 ||
+		events[2].Request == nil || events[2].Request.Status != "processed" {
+		t.Errorf("StreamEvents returned %+v", events)
+	}
+
+	if diff, err := c.Diff(ctx, req.ID); err != nil || !strings.HasPrefix(diff, "--- a/api/store.go") {
+		t.Errorf("Diff returned %q, %v", diff, err)
+	}
+	if files, err := c.RequestFiles(ctx, req.ID); err != nil || len(files) != 1 || files[0].Path != "api/store.go" || files[0].Added != 3 {
+		t.Errorf("RequestFiles returned %+v, %v", files, err)
+	}
+	if touched, err := c.Files(ctx, "api/", 1, 10); err != nil || len(touched.Files) != 1 || touched.Files[0].Prompt != req.Prompt {
+		t.Errorf("Files returned %+v, %v", touched, err)
+	}
+	if found, err := c.Search(ctx, "flaky", 1, 10); err != nil || len(found.Hits) == 0 || found.Hits[0].RequestID != req.ID {
+		t.Errorf("Search returned %+v, %v", found, err)
+	}
+
+	branch, err := c.Branch(ctx, req.ID)
+	if err != nil || branch.Branch != "codex/1" || branch.State != "open" {
+		t.Fatalf("Branch returned %+v, %v", branch, err)
+	}
+	if branch, err = c.MergeBranch(ctx, req.ID, ""); err != nil || branch.State != "merged" || branch.MergeSHA != "abc123" || branch.Target != "main" {
+		t.Errorf("MergeBranch returned %+v, %v", branch, err)
+	}
+	var apiErr *client.APIError
+	if _, err := c.DiscardBranch(ctx, req.ID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("DiscardBranch of a merged branch returned %v", err)
+	}
+
+	if snap, err := c.Snapshot(ctx, req.ID); err != nil || snap.Path != "/snapshots/1.tar.gz" || snap.Files != 2 {
+		t.Errorf("Snapshot returned %+v, %v", snap, err)
+	}
+	if snap, err := c.Rollback(ctx, req.ID); err != nil || snap.RestoredAt == "" {
+		t.Errorf("Rollback returned %+v, %v", snap, err)
+	}
+	history, err := c.History(ctx, req.ID)
+	if err != nil || len(history) < 2 || history[0].Kind != "snapshot" {
+		t.Errorf("History returned %+v, %v", history, err)
+	}
+
+	next, err := c.FollowUp(ctx, req.ID, client.NewRequest{Prompt: "now add a test"})
+	if err != nil {
+		t.Fatalf("FollowUp: %v", err)
+	}
+	if next.ParentID != req.ID || next.ThreadID != req.ID || next.Project != "almono" || !slices.Equal(next.Tags, req.Tags) {
+		t.Errorf("FollowUp returned %+v", next)
+	}
+	if thread, err := c.Thread(ctx, next.ID); err != nil || len(thread) != 2 || thread[1].ID != next.ID {
+		t.Errorf("Thread returned %+v, %v", thread, err)
+	}
+	cancelled, err := c.Cancel(ctx, next.ID)
+	if err != nil || cancelled.Status != "cancelled" || cancelled.FinishedAtMs == 0 {
+		t.Errorf("Cancel returned %+v, %v", cancelled, err)
+	}
+	if _, err := c.Get(ctx, 999); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Get of a missing request returned %v", err)
+	}
+
+	pipeline, err := c.Pipeline(ctx, f.pipeline.ID)
+	if err != nil || pipeline.Name != "release" || len(pipeline.Steps) != 2 {
+		t.Fatalf("Pipeline returned %+v, %v", pipeline, err)
+	}
+	if test := pipeline.Steps[1]; test.Name != "test" || !slices.Equal(test.DependsOn, []string{"build"}) ||
+		test.Layer != 1 || test.Request.PipelineID != pipeline.ID || test.Request.Step != "test" {
+		t.Errorf("pipeline step returned %+v", test)
+	}
+
+	sched := f.schedule
+	if sched.Name != "nightly" || sched.TimeZone != "UTC" || sched.Missed != "once" || !sched.Enabled || sched.NextRunAtMs == 0 {
+		t.Errorf("CreateSchedule returned %+v", sched)
+	}
+	disabled := false
+	if sched, err = c.UpdateSchedule(ctx, sched.ID, client.NewSchedule{Cron: "0 4 * * *", Prompt: "summarise {date}", TimeZone: "Europe/Berlin", Enabled: &disabled}); err != nil ||
+		sched.Cron != "0 4 * * *" || sched.TimeZone != "Europe/Berlin" || sched.Enabled {
+		t.Errorf("UpdateSchedule returned %+v, %v", sched, err)
+	}
+	if sched, err = c.SetScheduleEnabled(ctx, sched.ID, true); err != nil || !sched.Enabled {
+		t.Errorf("SetScheduleEnabled returned %+v, %v", sched, err)
+	}
+	run, err := c.RunSchedule(ctx, sched.ID)
+	if err != nil || run.ScheduleID != sched.ID || !strings.HasPrefix(run.Prompt, "summarise ") {
+		t.Errorf("RunSchedule returned %+v, %v", run, err)
+	}
+	if scheduled, err := c.List(ctx, client.ListOptions{Schedule: sched.ID}); err != nil || len(scheduled.Requests) != 1 {
+		t.Errorf("List by schedule returned %+v, %v", scheduled, err)
+	}
+	if err := c.DeleteSchedule(ctx, f.doomed.ID); err != nil {
+		t.Errorf("DeleteSchedule: %v", err)
+	}
+	if schedules, err := c.Schedules(ctx); err != nil || len(schedules) != 1 || schedules[0].ID != sched.ID {
+		t.Errorf("Schedules returned %+v, %v", schedules, err)
+	}
+}
@@ -0,0 +1,146 @@
+package api_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"almono/api"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{
+		"* * * * *", "*/15 * * * *", "5/15 * * * *", "0-30/10 9-17 * * 1-5",
+		"0 0 1,15 * *", "0 0 * jan,JUL *", "0 0 * * sun", "0 0 * * 7",
+		"@daily", "@Hourly", " @yearly ",
+	} {
+		if _, err := api.ParseCron(expr); err != nil {
+			t.Errorf("ParseCron(%q): %v", expr, err)
+		}
+	}
+	for _, expr := range []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "*/0 * * * *", "*/x * * * *", "30-10 * * * *",
+		"* * * foo *", "@often",
+	} {
+		if _, err := api.ParseCron(expr); !errors.Is(err, api.ErrInvalidCron) {
+			t.Errorf("ParseCron(%q) returned %v, want ErrInvalidCron", expr, err)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	adelaide, err := time.LoadLocation("Australia/Adelaide")
+	if err != nil {
+		t.Skip(err)
+	}
+	stJohns, err := time.LoadLocation("America/St_Johns")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(loc *time.Location, s string) time.Time {
+		t.Helper()
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	utc := func(s string) time.Time { return at(time.UTC, s) }
+	// in names an instant in UTC, for wall times that occur twice
+	in := func(loc *time.Location, s string) time.Time { return utc(s).In(loc) }
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want []time.Time
+	}{
+		{"every minute", "* * * * *", utc("2026-01-01 10:00"),
+			[]time.Time{utc("2026-01-01 10:01"), utc("2026-01-01 10:02")}},
+		{"seconds are dropped", "* * * * *", utc("2026-01-01 10:00").Add(59 * time.Second),
+			[]time.Time{utc("2026-01-01 10:01")}},
+		{"steps", "*/20 * * * *", utc("2026-01-01 10:00"),
+			[]time.Time{utc("2026-01-01 10:20"), utc("2026-01-01 10:40"), utc("2026-01-01 11:00")}},
+		{"step from a value", "5/15 * * * *", utc("2026-01-01 10:00"),
+			[]time.Time{utc("2026-01-01 10:05"), utc("2026-01-01 10:20"), utc("2026-01-01 10:35"), utc("2026-01-01 10:50"), utc("2026-01-01 11:05")}},
+		{"stepped range", "10-40/15 * * * *", utc("2026-01-01 10:30"),
+			[]time.Time{utc("2026-01-01 10:40"), utc("2026-01-01 11:10")}},
+		{"lists and ranges", "0 9-10,17 * * *", utc("2026-01-01 09:30"),
+			[]time.Time{utc("2026-01-01 10:00"), utc("2026-01-01 17:00"), utc("2026-01-02 09:00")}},
+		// 2026-01-01 is a Thursday
+		{"weekdays by name", "0 9 * * mon-fri", utc("2026-01-01 12:00"),
+			[]time.Time{utc("2026-01-02 09:00"), utc("2026-01-05 09:00")}},
+		{"7 is Sunday", "0 9 * * 7", utc("2026-01-01 12:00"),
+			[]time.Time{utc("2026-01-04 09:00"), utc("2026-01-11 09:00")}},
+		{"month names", "0 0 1 mar,SEP *", utc("2026-01-01 00:00"),
+			[]time.Time{utc("2026-03-01 00:00"), utc("2026-09-01 00:00"), utc("2027-03-01 00:00")}},
+		{"either day field when both are set", "0 0 13 * fri", utc("2026-02-01 00:00"),
+			[]time.Time{utc("2026-02-06 00:00"), utc("2026-02-13 00:00"), utc("2026-02-20 00:00"), utc("2026-02-27 00:00"), utc("2026-03-06 00:00"), utc("2026-03-13 00:00")}},
+		{"both day fields with a star", "0 0 13 * *", utc("2026-02-01 00:00"),
+			[]time.Time{utc("2026-02-13 00:00"), utc("2026-03-13 00:00")}},
+		{"day of week with a star month day", "0 0 * * fri", utc("2026-02-01 00:00"),
+			[]time.Time{utc("2026-02-06 00:00")}},
+		{"stepped day field counts as a star, so both must match", "0 0 */10 * mon", utc("2026-02-01 00:00"),
+			[]time.Time{utc("2026-05-11 00:00"), utc("2026-06-01 00:00")}},
+		{"leap day", "0 0 29 2 *", utc("2026-01-01 00:00"),
+			[]time.Time{utc("2028-02-29 00:00")}},
+		{"@hourly", "@hourly", utc("2026-01-01 10:00"), []time.Time{utc("2026-01-01 11:00")}},
+		{"@daily", "@daily", utc("2026-01-01 10:00"), []time.Time{utc("2026-01-02 00:00")}},
+		{"@weekly", "@weekly", utc("2026-01-01 10:00"), []time.Time{utc("2026-01-04 00:00")}},
+		{"@monthly", "@monthly", utc("2026-01-01 10:00"), []time.Time{utc("2026-02-01 00:00")}},
+		{"@yearly", "@yearly", utc("2026-01-01 10:00"), []time.Time{utc("2027-01-01 00:00")}},
+		{"never matches", "0 0 30 2 *", utc("2026-01-01 00:00"), []time.Time{{}}},
+		{"in the time's location", "0 9 * * *", at(berlin, "2026-01-01 10:00"),
+			[]time.Time{at(berlin, "2026-01-02 09:00")}},
+		// clocks go forward from 02:00 to 03:00 on 2026-03-29 in Berlin
+		{"skipped wall time does not run", "30 2 * * *", at(berlin, "2026-03-28 03:00"),
+			[]time.Time{at(berlin, "2026-03-30 02:30")}},
+		{"hourly across the gap", "0 * * * *", at(berlin, "2026-03-29 01:00"),
+			[]time.Time{at(berlin, "2026-03-29 03:00"), at(berlin, "2026-03-29 04:00")}},
+		// and back from 03:00 to 02:00 on 2026-10-25, so 02:00 to 02:59
+		// happen first at UTC 00:00 and again at UTC 01:00
+		{"repeated wall time runs once", "30 2 * * *", at(berlin, "2026-10-25 00:00"),
+			[]time.Time{in(berlin, "2026-10-25 01:30"), at(berlin, "2026-10-26 02:30")}},
+		{"repeated wall time after its first run", "30 2 * * *", in(berlin, "2026-10-25 00:30"),
+			[]time.Time{at(berlin, "2026-10-26 02:30")}},
+		{"hourly through the repeated hour runs once", "59 * * * *", in(berlin, "2026-10-25 00:30"),
+			[]time.Time{in(berlin, "2026-10-25 01:59"), in(berlin, "2026-10-25 02:59")}},
+		{"hours after the repeated one", "15 4 * * *", in(berlin, "2026-10-25 00:20"),
+			[]time.Time{at(berlin, "2026-10-25 04:15")}},
+		// Adelaide is UTC+10:30 until 03:00 on 2026-04-05, then UTC+9:30
+		{"repeated hour on a half-hour offset", "15 4 * * *", in(adelaide, "2026-04-04 16:20"),
+			[]time.Time{at(adelaide, "2026-04-05 04:15")}},
+		{"hourly through a repeated hour on a half-hour offset", "0 * * * *", in(adelaide, "2026-04-04 16:20"),
+			[]time.Time{at(adelaide, "2026-04-05 03:00"), at(adelaide, "2026-04-05 04:00")}},
+		// St. John's is UTC-2:30 until 02:00 on 2026-11-01, then UTC-3:30;
+		// a repeated wall time there resolves to its first occurrence
+		{"repeated wall time runs once west of UTC", "30 1 * * *", at(stJohns, "2026-11-01 00:00"),
+			[]time.Time{in(stJohns, "2026-11-01 04:00"), at(stJohns, "2026-11-02 01:30")}},
+		{"inside the second of two repeated hours", "45 1 * * *", in(stJohns, "2026-11-01 04:40"),
+			[]time.Time{in(stJohns, "2026-11-01 05:15"), at(stJohns, "2026-11-02 01:45")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := api.ParseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			from := tt.from
+			for i, want := range tt.want {
+				got := c.Next(from)
+				if !got.Equal(want) {
+					t.Fatalf("run %d after %v is %v, want %v", i+1, from, got, want)
+				}
+				if !got.IsZero() && got.Location() != from.Location() {
+					t.Errorf("run %d is in %v, want %v", i+1, got.Location(), from.Location())
+				}
+				from = got
+			}
+		})
+	}
+}
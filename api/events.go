@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// kinds of request events
+const (
+	EventSnapshot        = "snapshot"
+	EventSnapshotSkipped = "snapshot_skipped"
+	EventRollback        = "rollback"
+	EventRollbackFailed  = "rollback_failed"
+	EventBranchMerged    = "branch_merged"
+	EventBranchDiscarded = "branch_discarded"
+)
+
+// RequestEvent is something that happened to a request outside its run,
+// shown as the request's history
+type RequestEvent struct {
+	ID        int64  `json:"id"`
+	RequestID int64  `json:"request_id"`
+	Kind      string `json:"kind"`
+	Message   string `json:"message"`
+	CreatedAt string `json:"created_at"`
+}
+
+// AddEvent appends to a request's history
+func (s *Store) AddEvent(ctx context.Context, e RequestEvent) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	return retry(ctx, func() error {
+		_, err := s.w.ExecContext(
+			ctx,
+			"INSERT INTO request_events (request_id, kind, message, created_at) VALUES (?, ?, ?, ?)",
+			e.RequestID, e.Kind, e.Message, now,
+		)
+		return err
+	})
+}
+
+// ListEvents returns a request's history, oldest first
+func (s *Store) ListEvents(ctx context.Context, requestID int64) ([]RequestEvent, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT id, request_id, kind, message, created_at FROM request_events WHERE request_id = ? ORDER BY id",
+		requestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []RequestEvent{}
+	for rows.Next() {
+		var e RequestEvent
+		if err := rows.Scan(&e.ID, &e.RequestID, &e.Kind, &e.Message, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// FailureKind classifies why a request did not complete
+type FailureKind string
+
+const (
+	// FailureSpawn means the codex process could not be started
+	FailureSpawn FailureKind = "spawn"
+	// FailureExit means codex exited with a non-zero status or a signal
+	FailureExit FailureKind = "exit"
+	// FailureTimeout means the run outlived the worker's timeout
+	FailureTimeout FailureKind = "timeout"
+	// FailureCancelled means the run was stopped by a cancel or shutdown
+	FailureCancelled FailureKind = "cancelled"
+	// FailureCodexError means codex reported an error event or failed turn
+	FailureCodexError FailureKind = "codex_error"
+	// FailureStreamCorrupt means the JSON event stream could not be read
+	FailureStreamCorrupt FailureKind = "stream_corrupt"
+	// FailureWorkspace means the workdir could not be prepared for the run
+	FailureWorkspace FailureKind = "workspace"
+)
+
+// Failure is the structured record of a failed run
+type Failure struct {
+	Kind    FailureKind `json:"kind"`
+	Message string      `json:"message"`
+	// ExitCode is set once the process has exited on its own
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	// StderrTail holds the last lines codex wrote to stderr
+	StderrTail []string `json:"stderr_tail,omitempty"`
+	// CodexError is the last error message codex reported in its stream
+	CodexError string `json:"codex_error,omitempty"`
+	// Warnings are problems that did not fail the run, such as events
+	// that could not be read; a processed request keeps them in a
+	// Failure without a Kind
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Summary is a one-line description stored as the request's response
+func (f Failure) Summary() string {
+	summary := string(f.Kind)
+	if f.Message != "" {
+		summary += ": " + f.Message
+	}
+	if f.Signal != "" {
+		summary += " (" + f.Signal + ")"
+	} else if f.ExitCode != nil && f.Kind != FailureExit {
+		summary += " (exit " + strconv.Itoa(*f.ExitCode) + ")"
+	}
+	return summary
+}
+
+// encodeFailure stores f as JSON, or "" for no failure
+func encodeFailure(f *Failure) string {
+	if f == nil {
+		return ""
+	}
+	data, _ := json.Marshal(f)
+	return string(data)
+}
+
+// decodeFailure reads a stored failure; rows from before failures were
+// recorded, or with unreadable detail, have none
+func decodeFailure(detail string) *Failure {
+	if detail == "" {
+		return nil
+	}
+	var f Failure
+	if err := json.Unmarshal([]byte(detail), &f); err != nil {
+		return nil
+	}
+	return &f
+}
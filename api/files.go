@@ -0,0 +1,118 @@
+package api
+
+import (
+	"context"
+	"strings"
+)
+
+// kinds of change recorded for a file
+const (
+	FileAdded   = "add"
+	FileDeleted = "delete"
+	FileUpdated = "update"
+)
+
+// RequestFile is a file a request changed. Paths are relative to the
+// worker's workdir when inside it. Added and Removed are line counts from
+// git, 0 when the workdir is not a git repository.
+type RequestFile struct {
+	RequestID int64  `json:"request_id"`
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`
+	Added     int    `json:"added"`
+	Removed   int    `json:"removed"`
+}
+
+// FileTouch is a request that changed a file, for the reverse lookup
+type FileTouch struct {
+	RequestFile
+	Prompt    string `json:"prompt"`
+	Status    Status `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+// RecordFiles adds files to their requests' indexes. A file recorded
+// again takes the newer kind and the larger line counts, so codex items
+// and the git diff can be recorded in either order.
+func (s *Store) RecordFiles(ctx context.Context, files []RequestFile) error {
+	if len(files) == 0 {
+		return nil
+	}
+	return retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		for _, f := range files {
+			_, err := tx.ExecContext(
+				ctx,
+				`INSERT INTO request_files (request_id, path, kind, added, removed) VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT (request_id, path) DO UPDATE SET
+					kind = excluded.kind,
+					added = max(added, excluded.added),
+					removed = max(removed, excluded.removed)`,
+				f.RequestID, f.Path, f.Kind, f.Added, f.Removed,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// GetRequestFiles returns the files a request changed, by path
+func (s *Store) GetRequestFiles(ctx context.Context, requestID int64) ([]RequestFile, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		"SELECT request_id, path, kind, added, removed FROM request_files WHERE request_id = ? ORDER BY path",
+		requestID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := []RequestFile{}
+	for rows.Next() {
+		var f RequestFile
+		if err := rows.Scan(&f.RequestID, &f.Path, &f.Kind, &f.Added, &f.Removed); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// FilesTouched returns the requests that changed path, newest first. A
+// path ending in "/" matches every file below that directory.
+func (s *Store) FilesTouched(ctx context.Context, path string, offset, limit int) ([]FileTouch, error) {
+	cond, args := "f.path = ?", []any{path}
+	if strings.HasSuffix(path, "/") {
+		cond, args = "substr(f.path, 1, length(?)) = ?", []any{path, path}
+	}
+	args = append(args, limit, offset)
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT f.request_id, f.path, f.kind, f.added, f.removed, r.prompt, r.status, r.created_at
+		FROM request_files f JOIN requests r ON r.id = f.request_id
+		WHERE `+cond+`
+		ORDER BY f.request_id DESC, f.path
+		LIMIT ? OFFSET ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	touches := []FileTouch{}
+	for rows.Next() {
+		var t FileTouch
+		err := rows.Scan(&t.RequestID, &t.Path, &t.Kind, &t.Added, &t.Removed, &t.Prompt, &t.Status, &t.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		touches = append(touches, t)
+	}
+	return touches, rows.Err()
+}
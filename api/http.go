@@ -1,55 +1,482 @@
 package api
 
 import (
+	_ "embed"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 )
 
+//go:embed openapi.json
+var openAPISpec []byte
+
+// eventPollInterval is how often the event stream checks for new output
+const eventPollInterval = 500 * time.Millisecond
+
 type requestHandler struct {
 	svc *Service
 }
 
 type createRequestPayload struct {
-	Prompt string `json:"prompt"`
+	Prompt  string   `json:"prompt"`
+	Project string   `json:"project"`
+	Model   string   `json:"model"`
+	Tags    []string `json:"tags"`
+}
+
+type createPipelinePayload struct {
+	Name    string   `json:"name"`
+	Project string   `json:"project"`
+	Model   string   `json:"model"`
+	Tags    []string `json:"tags"`
+	Steps   []struct {
+		Name      string   `json:"name"`
+		Prompt    string   `json:"prompt"`
+		DependsOn []string `json:"depends_on"`
+	} `json:"steps"`
+	// Text holds the steps in the form ParsePipelineSteps reads, used
+	// when Steps is empty
+	Text string `json:"text"`
+}
+
+type linesResponse struct {
+	Lines []OutputLine `json:"lines"`
+	Total int          `json:"total"`
+}
+
+type mergePayload struct {
+	Target string `json:"target"`
+}
+
+// schedulePayload creates or replaces a schedule; enabled defaults to true
+type schedulePayload struct {
+	Name     string   `json:"name"`
+	Cron     string   `json:"cron"`
+	TimeZone string   `json:"time_zone"`
+	Prompt   string   `json:"prompt"`
+	Project  string   `json:"project"`
+	Model    string   `json:"model"`
+	Tags     []string `json:"tags"`
+	Missed   string   `json:"missed"`
+	Enabled  *bool    `json:"enabled"`
+}
+
+type schedulesResponse struct {
+	Schedules []Schedule `json:"schedules"`
+}
+
+type filesResponse struct {
+	Files []RequestFile `json:"files"`
+}
+
+type historyResponse struct {
+	Events []RequestEvent `json:"events"`
+}
+
+type threadResponse struct {
+	Requests []Request `json:"requests"`
 }
 
 type listResponse struct {
 	Requests []Request `json:"requests"`
 	Page     int       `json:"page"`
-	Pages    int       `json:"pages"`
-	Total    int       `json:"total"`
+	// Next and Prev are cursors for ?after= and ?before=, 0 at either end
+	Next int64 `json:"next"`
+	Prev int64 `json:"prev"`
 }
 
 func NewRequestHandler(svc *Service) http.Handler {
 	return &requestHandler{svc: svc}
 }
 
+// NewOpenAPIHandler serves the OpenAPI document describing the request API
+func NewOpenAPIHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(openAPISpec)
+	})
+}
+
+// NewSearchHandler serves GET /api/v1/search?q=&page=&limit=
+func NewSearchHandler(svc *Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		query := strings.TrimSpace(r.URL.Query().Get("q"))
+		if query == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit := parseInt(r.URL.Query().Get("limit"), 20)
+		if limit < 1 || limit > 100 {
+			limit = 100
+		}
+		result, err := svc.Search(r.Context(), query, parseInt(r.URL.Query().Get("page"), 1), limit)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, result)
+	})
+}
+
+// NewFilesHandler serves GET /api/files?path=&page=&limit=, the requests
+// that changed a file
+func NewFilesHandler(svc *Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		path := strings.TrimSpace(r.URL.Query().Get("path"))
+		if path == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		limit := parseInt(r.URL.Query().Get("limit"), 20)
+		if limit < 1 || limit > 100 {
+			limit = 100
+		}
+		result, err := svc.FilesTouched(r.Context(), path, parseInt(r.URL.Query().Get("page"), 1), limit)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, result)
+	})
+}
+
+// NewPipelinesHandler serves /api/pipelines: GET lists pipelines with
+// ?page=&limit=, POST creates one, and GET /api/pipelines/{id} returns one
+// with the status of each step
+func NewPipelinesHandler(svc *Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/pipelines"), "/")
+		if path != "" {
+			id, err := strconv.ParseInt(path, 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			p, ok, err := svc.GetPipeline(r.Context(), id)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			writeJSON(w, p)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			limit := parseInt(r.URL.Query().Get("limit"), 20)
+			if limit < 1 || limit > 100 {
+				limit = 100
+			}
+			result, err := svc.ListPipelines(r.Context(), parseInt(r.URL.Query().Get("page"), 1), limit)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, result)
+		case http.MethodPost:
+			var payload createPipelinePayload
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			np := NewPipeline{Name: payload.Name, Project: payload.Project, Model: payload.Model, Tags: payload.Tags}
+			for _, step := range payload.Steps {
+				np.Steps = append(np.Steps, NewStep{Name: step.Name, Prompt: step.Prompt, DependsOn: step.DependsOn})
+			}
+			var err error
+			if len(np.Steps) == 0 {
+				np.Steps, err = ParsePipelineSteps(payload.Text)
+			}
+			var p Pipeline
+			if err == nil {
+				p, err = svc.CreatePipeline(r.Context(), np)
+			}
+			switch {
+			case errors.Is(err, ErrInvalidPipeline):
+				// the reason is the only part of a pipeline a caller can fix
+				http.Error(w, err.Error(), http.StatusBadRequest)
+			case err != nil:
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				writeJSON(w, p)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// NewSchedulesHandler serves /api/schedules: GET lists schedules and POST
+// creates one; /{id} is read with GET, replaced with PUT and removed with
+// DELETE, and POST to /{id}/enable, /{id}/disable or /{id}/run switches it
+// or enqueues a run now. The runs of a schedule are listed by
+// /api/requests?schedule={id}.
+func NewSchedulesHandler(svc *Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/schedules"), "/")
+		if path == "" {
+			switch r.Method {
+			case http.MethodGet:
+				schedules, err := svc.ListSchedules(r.Context())
+				if err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				writeJSON(w, schedulesResponse{Schedules: schedules})
+			case http.MethodPost:
+				ns, ok := decodeSchedule(w, r)
+				if !ok {
+					return
+				}
+				sched, err := svc.CreateSchedule(r.Context(), ns)
+				writeSchedule(w, sched, err)
+			default:
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		idPart, action, _ := strings.Cut(path, "/")
+		id, err := strconv.ParseInt(idPart, 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch {
+		case action == "" && r.Method == http.MethodGet:
+			sched, ok, err := svc.GetSchedule(r.Context(), id)
+			if err == nil && !ok {
+				err = ErrScheduleNotFound
+			}
+			writeSchedule(w, sched, err)
+		case action == "" && r.Method == http.MethodPut:
+			ns, ok := decodeSchedule(w, r)
+			if !ok {
+				return
+			}
+			sched, err := svc.UpdateSchedule(r.Context(), id, ns)
+			writeSchedule(w, sched, err)
+		case action == "" && r.Method == http.MethodDelete:
+			ok, err := svc.DeleteSchedule(r.Context(), id)
+			switch {
+			case err != nil:
+				w.WriteHeader(http.StatusInternalServerError)
+			case !ok:
+				w.WriteHeader(http.StatusNotFound)
+			default:
+				w.WriteHeader(http.StatusNoContent)
+			}
+		case (action == "enable" || action == "disable") && r.Method == http.MethodPost:
+			sched, err := svc.SetScheduleEnabled(r.Context(), id, action == "enable")
+			writeSchedule(w, sched, err)
+		case action == "run" && r.Method == http.MethodPost:
+			req, err := svc.RunSchedule(r.Context(), id)
+			switch {
+			case errors.Is(err, ErrScheduleNotFound):
+				w.WriteHeader(http.StatusNotFound)
+			case err != nil:
+				w.WriteHeader(http.StatusInternalServerError)
+			default:
+				writeJSON(w, req)
+			}
+		case action == "" || action == "enable" || action == "disable" || action == "run":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func decodeSchedule(w http.ResponseWriter, r *http.Request) (NewSchedule, bool) {
+	var payload schedulePayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return NewSchedule{}, false
+	}
+	return NewSchedule{
+		Name:     payload.Name,
+		Cron:     payload.Cron,
+		TimeZone: payload.TimeZone,
+		Prompt:   payload.Prompt,
+		Project:  payload.Project,
+		Model:    payload.Model,
+		Tags:     payload.Tags,
+		Missed:   payload.Missed,
+		Disabled: payload.Enabled != nil && !*payload.Enabled,
+	}, true
+}
+
+func writeSchedule(w http.ResponseWriter, sched Schedule, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidSchedule):
+		// the reason is the only part of a schedule a caller can fix
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ErrScheduleNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		writeJSON(w, sched)
+	}
+}
+
 func (h *requestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		h.handleList(w, r)
-	case http.MethodPost:
-		h.handleCreate(w, r)
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/requests"), "/")
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.handleList(w, r)
+		case http.MethodPost:
+			h.handleCreate(w, r)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// /api/requests/{id}[/action]
+	idStr, action, _ := strings.Cut(path, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	// /api/requests/{id}/lines/{num}/content
+	if rest, ok := strings.CutPrefix(action, "lines/"); ok {
+		numStr, ok := strings.CutSuffix(rest, "/content")
+		lineNum, err := strconv.Atoi(numStr)
+		if !ok || err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleLineContent(w, r, id, lineNum)
+		return
+	}
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleGet(w, r, id)
+	case "cancel":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleCancel(w, r, id)
+	case "lines":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleLines(w, r, id)
+	case "events":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleEvents(w, r, id)
+	case "files":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleFiles(w, r, id)
+	case "diff":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleDiff(w, r, id)
+	case "branch":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleBranch(w, r, id)
+	case "branch/merge", "branch/discard":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleFinishBranch(w, r, id, action == "branch/merge")
+	case "snapshot":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleSnapshot(w, r, id)
+	case "rollback":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleRollback(w, r, id)
+	case "follow-up":
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleFollowUp(w, r, id)
+	case "thread":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleThread(w, r, id)
+	case "history":
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleHistory(w, r, id)
 	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		w.WriteHeader(http.StatusNotFound)
 	}
 }
 
 func (h *requestHandler) handleList(w http.ResponseWriter, r *http.Request) {
 	page := parseInt(r.URL.Query().Get("page"), 1)
 	limit := parseInt(r.URL.Query().Get("limit"), 10)
-	result, err := h.svc.ListRequests(r.Context(), page, limit)
+	result, err := h.svc.ListRequests(r.Context(), ParseListQuery(r.URL.Query()), ParseCursor(r.URL.Query()), page, limit)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(listResponse{
+	writeJSON(w, listResponse{
 		Requests: result.Requests,
 		Page:     result.Page,
-		Pages:    result.Pages,
-		Total:    result.Total,
+		Next:     result.Next,
+		Prev:     result.Prev,
 	})
 }
 
@@ -59,13 +486,362 @@ func (h *requestHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	req, err := h.svc.CreateRequest(r.Context(), payload.Prompt)
+	req, err := h.svc.CreateRequest(r.Context(), NewRequest{
+		Prompt:  payload.Prompt,
+		Project: payload.Project,
+		Model:   payload.Model,
+		Tags:    payload.Tags,
+	})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	writeJSON(w, req)
+}
+
+// handleFollowUp enqueues the next turn of a thread. Requests that cannot
+// be followed up get 409 with the request.
+func (h *requestHandler) handleFollowUp(w http.ResponseWriter, r *http.Request, id int64) {
+	var payload createRequestPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || strings.TrimSpace(payload.Prompt) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req, err := h.svc.FollowUp(r.Context(), id, NewRequest{
+		Prompt:  payload.Prompt,
+		Project: payload.Project,
+		Model:   payload.Model,
+		Tags:    payload.Tags,
+	})
+	switch {
+	case errors.Is(err, ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, ErrNotFinished), errors.Is(err, ErrNoSession), errors.Is(err, ErrHasFollowUp):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(req)
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		writeJSON(w, req)
+	}
+}
+
+// handleThread returns every request of the thread id belongs to, oldest
+// first
+func (h *requestHandler) handleThread(w http.ResponseWriter, r *http.Request, id int64) {
+	thread, ok, err := h.svc.GetThread(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, threadResponse{Requests: thread})
+}
+
+func (h *requestHandler) handleGet(w http.ResponseWriter, r *http.Request, id int64) {
+	req, ok, err := h.svc.GetRequest(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, req)
+}
+
+func (h *requestHandler) handleCancel(w http.ResponseWriter, r *http.Request, id int64) {
+	cancelled, err := h.svc.CancelRequest(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	req, ok, err := h.svc.GetRequest(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if !cancelled {
+		// request exists but already finished
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(req)
+		return
+	}
+	writeJSON(w, req)
+}
+
+// handleLines returns lines oldest first, starting after the given line
+// number, or with tail=N the last N lines
+func (h *requestHandler) handleLines(w http.ResponseWriter, r *http.Request, id int64) {
+	_, ok, err := h.svc.GetRequest(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	after := parseInt(r.URL.Query().Get("after"), 0)
+	limit := parseInt(r.URL.Query().Get("limit"), 1000)
+	if limit < 1 || limit > 1000 {
+		limit = 1000
+	}
+	total, err := h.svc.CountOutputLines(r.Context(), id, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var lines []OutputLine
+	if tail := parseInt(r.URL.Query().Get("tail"), 0); tail > 0 {
+		// retention leaves gaps in the line numbers, so the tail is the
+		// newest lines rather than those after total-N
+		lines, err = h.svc.GetOutputLines(r.Context(), id, min(tail, limit), 0)
+		slices.Reverse(lines)
+	} else {
+		lines, err = h.svc.GetOutputLinesAfter(r.Context(), id, after, limit)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if lines == nil {
+		lines = []OutputLine{}
+	}
+	writeJSON(w, linesResponse{Lines: lines, Total: total})
+}
+
+// handleFiles returns the files a request changed, by path
+func (h *requestHandler) handleFiles(w http.ResponseWriter, r *http.Request, id int64) {
+	_, ok, err := h.svc.GetRequest(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	files, err := h.svc.GetRequestFiles(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, filesResponse{Files: files})
+}
+
+// handleDiff returns the workspace diff of a run as a patch
+func (h *requestHandler) handleDiff(w http.ResponseWriter, r *http.Request, id int64) {
+	diff, patch, ok, err := h.svc.GetDiff(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+	if diff.Truncated {
+		w.Header().Set("X-Diff-Truncated", "true")
+	}
+	_, _ = io.WriteString(w, patch)
+}
+
+// handleBranch returns the git branch a request ran on
+func (h *requestHandler) handleBranch(w http.ResponseWriter, r *http.Request, id int64) {
+	branch, ok, err := h.svc.GetBranch(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, branch)
+}
+
+// handleFinishBranch merges or discards a request's open branch. Requests
+// without one, and merges or discards git refused, get 409 with the branch.
+func (h *requestHandler) handleFinishBranch(w http.ResponseWriter, r *http.Request, id int64, merge bool) {
+	var branch RequestBranch
+	var err error
+	if merge {
+		var payload mergePayload
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		branch, err = h.svc.MergeBranch(r.Context(), id, strings.TrimSpace(payload.Target))
+	} else {
+		branch, err = h.svc.DiscardBranch(r.Context(), id)
+	}
+	switch {
+	case errors.Is(err, ErrNoMergeTarget):
+		w.WriteHeader(http.StatusBadRequest)
+	case errors.Is(err, ErrBranchNotOpen) && branch.RequestID == 0:
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, ErrBranchNotOpen), errors.Is(err, ErrBranchGit):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(branch)
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		writeJSON(w, branch)
+	}
+}
+
+// handleSnapshot returns the workdir snapshot taken before a request ran
+func (h *requestHandler) handleSnapshot(w http.ResponseWriter, r *http.Request, id int64) {
+	snap, ok, err := h.svc.GetSnapshot(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	writeJSON(w, snap)
+}
+
+// handleRollback restores the workdir to a request's snapshot. Rollbacks
+// refused while a request runs or another rollback is under way, or
+// failing to restore, get 409 with the snapshot.
+func (h *requestHandler) handleRollback(w http.ResponseWriter, r *http.Request, id int64) {
+	snap, err := h.svc.Rollback(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrNoSnapshot):
+		w.WriteHeader(http.StatusNotFound)
+	case errors.Is(err, ErrWorkdirBusy), errors.Is(err, ErrRestore):
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		_ = json.NewEncoder(w).Encode(snap)
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		writeJSON(w, snap)
+	}
+}
+
+// handleHistory returns what happened to a request outside its run
+func (h *requestHandler) handleHistory(w http.ResponseWriter, r *http.Request, id int64) {
+	events, err := h.svc.ListEvents(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, historyResponse{Events: events})
+}
+
+// handleLineContent returns the complete content of one line as plain text
+func (h *requestHandler) handleLineContent(w http.ResponseWriter, r *http.Request, id int64, lineNum int) {
+	content, ok, err := h.svc.GetFullOutput(r.Context(), id, lineNum)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, content)
+}
+
+// handleEvents streams output lines and status changes as server-sent events.
+// The stream ends once the request is finished and all lines have been sent.
+func (h *requestHandler) handleEvents(w http.ResponseWriter, r *http.Request, id int64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	ctx := r.Context()
+	req, ok, err := h.svc.GetRequest(ctx, id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	after := parseInt(r.URL.Query().Get("after"), 0)
+	var lastStatus Status
+	ticker := time.NewTicker(eventPollInterval)
+	defer ticker.Stop()
+	for {
+		// read status before lines so a finished request never misses its tail
+		req, _, err = h.svc.GetRequest(ctx, id)
+		if err != nil {
+			return
+		}
+		for {
+			lines, err := h.svc.GetOutputLinesAfter(ctx, id, after, 100)
+			if err != nil {
+				return
+			}
+			for _, line := range lines {
+				if err := writeEvent(w, "line", line); err != nil {
+					return
+				}
+				after = line.LineNum
+			}
+			if len(lines) < 100 {
+				break
+			}
+		}
+		if req.Status != lastStatus {
+			if err := writeEvent(w, "status", req); err != nil {
+				return
+			}
+			lastStatus = req.Status
+		}
+		flusher.Flush()
+		if req.Finished() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(req)
+	_ = json.NewEncoder(w).Encode(v)
 }
 
 func parseInt(val string, fallback int) int {
@@ -0,0 +1,114 @@
+package api
+
+import "strings"
+
+// line types of codex items stored as structured text, so the transcript
+// can render them while search and exports still read them as plain text
+const (
+	LineFileChange = "file_change"
+	LineToolCall   = "tool_call"
+	LineWebSearch  = "web_search"
+	LineTodoList   = "todo_list"
+)
+
+// FileChange is one path touched by a file_change item. Kind is add,
+// delete or update.
+type FileChange struct {
+	Path string
+	Kind string
+}
+
+// FormatFileChanges stores changes one per line as "kind path"
+func FormatFileChanges(changes []FileChange) string {
+	lines := make([]string, len(changes))
+	for i, change := range changes {
+		lines[i] = change.Kind + " " + change.Path
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseFileChanges reads the content of a file_change line
+func ParseFileChanges(content string) []FileChange {
+	var changes []FileChange
+	for _, line := range strings.Split(content, "\n") {
+		kind, path, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		changes = append(changes, FileChange{Path: path, Kind: kind})
+	}
+	return changes
+}
+
+// TodoItem is one entry of a codex plan
+type TodoItem struct {
+	Text      string
+	Completed bool
+}
+
+// FormatTodoList stores items one per line as "[x] text" or "[ ] text"
+func FormatTodoList(items []TodoItem) string {
+	lines := make([]string, len(items))
+	for i, item := range items {
+		mark := "[ ] "
+		if item.Completed {
+			mark = "[x] "
+		}
+		lines[i] = mark + strings.Join(strings.Fields(item.Text), " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParseTodoList reads the content of a todo_list line
+func ParseTodoList(content string) []TodoItem {
+	var items []TodoItem
+	for _, line := range strings.Split(content, "\n") {
+		if text, ok := strings.CutPrefix(line, "[x] "); ok {
+			items = append(items, TodoItem{Text: text, Completed: true})
+		} else if text, ok := strings.CutPrefix(line, "[ ] "); ok {
+			items = append(items, TodoItem{Text: text})
+		}
+	}
+	return items
+}
+
+// ToolCall is an MCP tool call. Arguments is compact JSON; Result is the
+// text the tool returned, or its error message when Failed.
+type ToolCall struct {
+	Server    string
+	Tool      string
+	Arguments string
+	Result    string
+	Failed    bool
+}
+
+// toolCallFailed marks the header of a failed call
+const toolCallFailed = " (failed)"
+
+// FormatToolCall stores a call as a "server/tool" header, the arguments
+// on the second line and the result after them
+func FormatToolCall(call ToolCall) string {
+	header := call.Server + "/" + call.Tool
+	if call.Failed {
+		header += toolCallFailed
+	}
+	args := strings.ReplaceAll(call.Arguments, "\n", " ")
+	return header + "\n" + args + "\n" + call.Result
+}
+
+// ParseToolCall reads the content of a tool_call line
+func ParseToolCall(content string) ToolCall {
+	parts := strings.SplitN(content, "\n", 3)
+	for len(parts) < 3 {
+		parts = append(parts, "")
+	}
+	header, failed := strings.CutSuffix(parts[0], toolCallFailed)
+	server, tool, _ := strings.Cut(header, "/")
+	return ToolCall{
+		Server:    server,
+		Tool:      tool,
+		Arguments: parts[1],
+		Result:    parts[2],
+		Failed:    failed,
+	}
+}
@@ -0,0 +1,84 @@
+package api_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"almono/api"
+)
+
+// TestListRequestsPageLinks follows every numbered page link from the
+// first page on and checks each one leads to the page it is numbered as
+func TestListRequestsPageLinks(t *testing.T) {
+	ctx := context.Background()
+	store := api.NewMemStore()
+	svc := api.NewService(store)
+	const pageSize, requests = 5, 58
+	var all []int64
+	for range requests {
+		all = append(all, mustCreate(t, store, api.NewRequest{Prompt: "p"}).ID)
+	}
+	slices.Reverse(all)
+	want := func(page int) []int64 {
+		return all[(page-1)*pageSize : min(page*pageSize, requests)]
+	}
+	lastPage := (requests + pageSize - 1) / pageSize
+
+	seen := map[int]bool{}
+	var visit func(cur api.Cursor, page int)
+	visit = func(cur api.Cursor, page int) {
+		t.Helper()
+		got, err := svc.ListRequests(ctx, api.ListQuery{}, cur, page, pageSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Page != page || !slices.Equal(ids(got.Requests), want(page)) {
+			t.Fatalf("%+v: page %d %v, want page %d %v", cur, got.Page, ids(got.Requests), page, want(page))
+		}
+		if (got.Prev != 0) != (page > 1) || (got.Next != 0) != (page < lastPage) {
+			t.Errorf("page %d: prev %d, next %d", page, got.Prev, got.Next)
+		}
+		var numbers []int
+		for _, link := range got.Links {
+			numbers = append(numbers, link.Page)
+		}
+		first := min(max(1, page-2), lastPage-4)
+		if !slices.Equal(numbers, []int{first, first + 1, first + 2, first + 3, first + 4}) {
+			t.Errorf("page %d links to pages %v", page, numbers)
+		}
+		if seen[page] {
+			return
+		}
+		seen[page] = true
+		for _, link := range got.Links {
+			if link.Page != page {
+				visit(api.Cursor{After: link.After, Before: link.Before}, link.Page)
+			}
+		}
+	}
+	visit(api.Cursor{}, 1)
+	if len(seen) != lastPage {
+		t.Errorf("reached %d of %d pages", len(seen), lastPage)
+	}
+}
+
+// TestListRequestsRenumbersNearStart checks a page number carried by a
+// stale link is corrected once the start of the list is in reach
+func TestListRequestsRenumbersNearStart(t *testing.T) {
+	ctx := context.Background()
+	store := api.NewMemStore()
+	svc := api.NewService(store)
+	var all []int64
+	for range 12 {
+		all = append(all, mustCreate(t, store, api.NewRequest{Prompt: "p"}).ID)
+	}
+	slices.Reverse(all)
+	got, err := svc.ListRequests(ctx, api.ListQuery{}, api.Cursor{After: all[4]}, 9, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Page != 2 || got.Prev != all[5] || got.Next != all[9] {
+		t.Errorf("got page %d, prev %d, next %d", got.Page, got.Prev, got.Next)
+	}
+}
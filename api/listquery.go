@@ -0,0 +1,313 @@
+package api
+
+import (
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sort keys accepted by ListQuery
+const (
+	SortCreated  = "created"
+	SortDuration = "duration"
+	SortTokens   = "tokens"
+)
+
+// dateLayout is the format of the From and To filters
+const dateLayout = "2006-01-02"
+
+// ListQuery filters and orders the request list. Zero values match
+// everything and sort newest first.
+type ListQuery struct {
+	Status  string
+	Project string
+	Model   string
+	Tag     string
+	// Schedule limits the list to the runs of one schedule
+	Schedule int64
+	// From and To bound the creation date, inclusive, as YYYY-MM-DD in UTC
+	From string
+	To   string
+	// Sort is SortCreated, SortDuration or SortTokens
+	Sort string
+	// Asc sorts ascending instead of largest or newest first
+	Asc bool
+}
+
+// ParseListQuery reads a ListQuery from URL parameters. Unknown sort keys
+// and malformed dates are ignored rather than rejected, so a stale
+// bookmark still shows a list.
+func ParseListQuery(values url.Values) ListQuery {
+	schedule, _ := strconv.ParseInt(values.Get("schedule"), 10, 64)
+	q := ListQuery{
+		Status:   strings.TrimSpace(values.Get("status")),
+		Project:  strings.TrimSpace(values.Get("project")),
+		Model:    strings.TrimSpace(values.Get("model")),
+		Tag:      normalizeTag(values.Get("tag")),
+		Schedule: max(0, schedule),
+		From:     parseDate(values.Get("from")),
+		To:       parseDate(values.Get("to")),
+		Sort:     values.Get("sort"),
+		Asc:      values.Get("order") == "asc",
+	}
+	switch q.Sort {
+	case SortDuration, SortTokens:
+	default:
+		q.Sort = SortCreated
+	}
+	return q
+}
+
+// Values encodes the query as URL parameters, omitting defaults
+func (q ListQuery) Values() url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("status", q.Status)
+	set("project", q.Project)
+	set("model", q.Model)
+	set("tag", q.Tag)
+	if q.Schedule != 0 {
+		values.Set("schedule", strconv.FormatInt(q.Schedule, 10))
+	}
+	set("from", q.From)
+	set("to", q.To)
+	if q.Sort != SortCreated {
+		set("sort", q.Sort)
+	}
+	if q.Asc {
+		values.Set("order", "asc")
+	}
+	return values
+}
+
+// Filtered reports whether any filter is set
+func (q ListQuery) Filtered() bool {
+	return q.Status != "" || q.Project != "" || q.Model != "" || q.Tag != "" || q.Schedule != 0 || q.From != "" || q.To != ""
+}
+
+// Cursor positions a page of the request list. After and Before are ids
+// of requests on a neighbouring page: the page holds the requests that
+// follow After, or precede Before, in the query's order. With neither the
+// page is the start of the list.
+type Cursor struct {
+	After  int64
+	Before int64
+}
+
+// ParseCursor reads the after and before cursors from URL parameters
+func ParseCursor(values url.Values) Cursor {
+	after, _ := strconv.ParseInt(values.Get("after"), 10, 64)
+	before, _ := strconv.ParseInt(values.Get("before"), 10, 64)
+	return Cursor{After: max(0, after), Before: max(0, before)}
+}
+
+// conditions builds the SQL filter conditions and their arguments
+func (q ListQuery) conditions() ([]string, []any) {
+	var conds []string
+	var args []any
+	if q.Status != "" {
+		conds = append(conds, "status = ?")
+		args = append(args, q.Status)
+	}
+	if q.Project != "" {
+		conds = append(conds, "project = ?")
+		args = append(args, q.Project)
+	}
+	if q.Model != "" {
+		conds = append(conds, "model = ?")
+		args = append(args, q.Model)
+	}
+	if q.Tag != "" {
+		conds = append(conds, "id IN (SELECT request_id FROM request_tags WHERE tag = ?)")
+		args = append(args, q.Tag)
+	}
+	if q.Schedule != 0 {
+		conds = append(conds, "schedule_id = ?")
+		args = append(args, q.Schedule)
+	}
+	if q.From != "" {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, q.From)
+	}
+	if q.To != "" {
+		conds = append(conds, "created_at < ?")
+		args = append(args, dayAfter(q.To))
+	}
+	return conds, args
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
+
+// durationExpr is Request.Duration in milliseconds: 0 for requests that
+// never started, such as ones cancelled or skipped while pending, and for
+// ones still running
+const durationExpr = "(CASE WHEN started_at_ms > 0 AND finished_at_ms >= started_at_ms THEN finished_at_ms - started_at_ms ELSE 0 END)"
+
+// sortKeys are the expressions the list is ordered by, most significant
+// first and all in the same direction, so a cursor can be compared as one
+// row value. The leading flag keeps requests without a duration or token
+// count last either way, and id breaks ties.
+func (q ListQuery) sortKeys() []string {
+	zeroLast := func(expr string) string {
+		if q.Asc {
+			return expr + " = 0"
+		}
+		return expr + " != 0"
+	}
+	switch q.Sort {
+	case SortDuration:
+		return []string{zeroLast(durationExpr), durationExpr, "id"}
+	case SortTokens:
+		return []string{zeroLast("input_tokens + output_tokens"), "input_tokens + output_tokens", "id"}
+	}
+	return []string{"id"}
+}
+
+// orderBy builds the ORDER BY clause, reversed when reading backwards
+// from a Before cursor
+func (q ListQuery) orderBy(reverse bool) string {
+	dir := " DESC"
+	if q.Asc != reverse {
+		dir = " ASC"
+	}
+	keys := q.sortKeys()
+	for i := range keys {
+		keys[i] += dir
+	}
+	return " ORDER BY " + strings.Join(keys, ", ")
+}
+
+// cursorCondition selects the requests following the cursor request, or
+// preceding it when before is set
+func (q ListQuery) cursorCondition(before bool) string {
+	op := " < "
+	if q.Asc != before {
+		op = " > "
+	}
+	keys := strings.Join(q.sortKeys(), ", ")
+	return "(" + keys + ")" + op + "(SELECT " + keys + " FROM requests WHERE id = ?)"
+}
+
+// selectFrom builds the query for up to limit rows of columns from the
+// position cur. Reading backwards from a Before cursor runs in reverse,
+// so reverse reports that the rows need flipping into list order.
+func (q ListQuery) selectFrom(columns string, cur Cursor, limit int) (query string, args []any, reverse bool) {
+	conds, args := q.conditions()
+	reverse = cur.Before != 0 && cur.After == 0
+	switch {
+	case cur.After != 0:
+		conds = append(conds, q.cursorCondition(false))
+		args = append(args, cur.After)
+	case reverse:
+		conds = append(conds, q.cursorCondition(true))
+		args = append(args, cur.Before)
+	}
+	query = "SELECT " + columns + " FROM requests" + whereClause(conds) + q.orderBy(reverse) + " LIMIT ?"
+	return query, append(args, limit), reverse
+}
+
+// matches applies the filters to a request in memory
+func (q ListQuery) matches(req Request) bool {
+	if q.Status != "" && req.Status != Status(q.Status) {
+		return false
+	}
+	if q.Project != "" && req.Project != q.Project {
+		return false
+	}
+	if q.Model != "" && req.Model != q.Model {
+		return false
+	}
+	if q.Tag != "" && !containsTag(req.Tags, q.Tag) {
+		return false
+	}
+	if q.Schedule != 0 && req.ScheduleID != q.Schedule {
+		return false
+	}
+	if q.From != "" && req.CreatedAt < q.From {
+		return false
+	}
+	if q.To != "" && req.CreatedAt >= dayAfter(q.To) {
+		return false
+	}
+	return true
+}
+
+// less orders requests in memory the same way orderBy does in SQL
+func (q ListQuery) less(a, b Request) bool {
+	var ka, kb int64
+	switch q.Sort {
+	case SortDuration:
+		ka, kb = int64(a.Duration()), int64(b.Duration())
+	case SortTokens:
+		ka, kb = a.Tokens(), b.Tokens()
+	default:
+		ka, kb = a.ID, b.ID
+	}
+	if (ka == 0) != (kb == 0) {
+		return kb == 0
+	}
+	if ka == kb {
+		ka, kb = a.ID, b.ID
+	}
+	if q.Asc {
+		return ka < kb
+	}
+	return ka > kb
+}
+
+// NormalizeTags lowercases, trims and de-duplicates tags, dropping empty ones
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SplitTags parses a comma-separated tag list as typed into a form
+func SplitTags(list string) []string {
+	return NormalizeTags(strings.Split(list, ","))
+}
+
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDate(value string) string {
+	if _, err := time.Parse(dateLayout, value); err != nil {
+		return ""
+	}
+	return value
+}
+
+func dayAfter(date string) string {
+	t, _ := time.Parse(dateLayout, date)
+	return t.AddDate(0, 0, 1).Format(dateLayout)
+}
@@ -0,0 +1,950 @@
+package api
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MemStore is an in-memory RequestStore with the same behaviour as the
+// SQLite Store, for tests and throwaway instances
+type MemStore struct {
+	mu       sync.Mutex
+	requests []Request // indexed by ID-1
+	lines    map[int64][]OutputLine
+	blobs    map[string][]byte
+	lineID   int64
+	files    map[int64][]RequestFile
+	// artifacts keep their content in blobs, keyed by request and name
+	artifacts map[int64]map[string]memArtifact
+	branches  map[int64]RequestBranch
+	snapshots map[int64]RequestSnapshot
+	events    []RequestEvent
+	pipelines []Pipeline // indexed by ID-1, without steps
+	// deps maps a request to the requests it depends on
+	deps map[int64][]int64
+	// schedules are keyed by ID; scheduleID is the last ID handed out
+	schedules  map[int64]Schedule
+	scheduleID int64
+	// lock is the rollback holding the workdir, if it has not expired
+	lock memLock
+}
+
+type memLock struct {
+	requestID   int64
+	expiresAtMs int64
+}
+
+type memArtifact struct {
+	Artifact
+	hash string
+}
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		lines:     map[int64][]OutputLine{},
+		blobs:     map[string][]byte{},
+		files:     map[int64][]RequestFile{},
+		artifacts: map[int64]map[string]memArtifact{},
+		branches:  map[int64]RequestBranch{},
+		snapshots: map[int64]RequestSnapshot{},
+		deps:      map[int64][]int64{},
+		schedules: map[int64]Schedule{},
+	}
+}
+
+func memNow() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// request returns a pointer to the stored request; callers hold mu
+func (m *MemStore) request(id int64) (*Request, bool) {
+	if id < 1 || id > int64(len(m.requests)) {
+		return nil, false
+	}
+	return &m.requests[id-1], true
+}
+
+// copyRequest returns req with its own Tags and Failure, so callers and
+// the store never share them
+func copyRequest(req Request) Request {
+	req.Tags = slices.Clone(req.Tags)
+	if req.Failure != nil {
+		f := *req.Failure
+		f.StderrTail = slices.Clone(f.StderrTail)
+		f.Warnings = slices.Clone(f.Warnings)
+		req.Failure = &f
+	}
+	return req
+}
+
+// copySchedule returns sched with its own Tags
+func copySchedule(sched Schedule) Schedule {
+	sched.Tags = slices.Clone(sched.Tags)
+	return sched
+}
+
+func (m *MemStore) CreateRequest(ctx context.Context, nr NewRequest) (Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.insertRequest(nr, 0, ""), nil
+}
+
+// insertRequest mirrors Store's; callers hold mu
+func (m *MemStore) insertRequest(nr NewRequest, pipelineID int64, step string) Request {
+	req := Request{
+		ID:             int64(len(m.requests)) + 1,
+		Prompt:         nr.Prompt,
+		Status:         StatusPending,
+		CreatedAt:      memNow(),
+		Project:        nr.Project,
+		Model:          nr.Model,
+		Tags:           NormalizeTags(nr.Tags),
+		QueuedAtMs:     time.Now().UnixMilli(),
+		ParentID:       nr.ParentID,
+		ThreadID:       int64(len(m.requests)) + 1,
+		PipelineID:     pipelineID,
+		Step:           step,
+		ScheduleID:     nr.ScheduleID,
+		ScheduledForMs: nr.ScheduledForMs,
+	}
+	if parent, ok := m.request(nr.ParentID); ok {
+		req.ThreadID, req.SessionID = parent.ThreadID, parent.SessionID
+	}
+	m.requests = append(m.requests, req)
+	return copyRequest(req)
+}
+
+func (m *MemStore) GetRequest(ctx context.Context, id int64) (Request, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, ok := m.request(id)
+	if !ok {
+		return Request{}, false, nil
+	}
+	return copyRequest(*req), true, nil
+}
+
+func (m *MemStore) ListRequests(ctx context.Context, q ListQuery, cur Cursor, limit int) ([]Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var matched []Request
+	for _, req := range m.requests {
+		if q.matches(req) {
+			matched = append(matched, copyRequest(req))
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool { return q.less(matched[i], matched[j]) })
+
+	// cursors compare against the cursor request even if it no longer
+	// matches; like the SQL subquery, an unknown cursor matches nothing
+	start, end := 0, len(matched)
+	items := []Request{}
+	switch {
+	case cur.After != 0:
+		cursor, ok := m.request(cur.After)
+		if !ok {
+			return items, nil
+		}
+		start = sort.Search(len(matched), func(i int) bool { return q.less(*cursor, matched[i]) })
+	case cur.Before != 0:
+		cursor, ok := m.request(cur.Before)
+		if !ok {
+			return items, nil
+		}
+		end = sort.Search(len(matched), func(i int) bool { return !q.less(matched[i], *cursor) })
+		if limit >= 0 && end-limit > start {
+			start = end - limit
+		}
+	}
+	for i := start; i < end && (limit < 0 || len(items) < limit); i++ {
+		items = append(items, matched[i])
+	}
+	return items, nil
+}
+
+func (m *MemStore) ListRequestIDs(ctx context.Context, q ListQuery, cur Cursor, limit int) ([]int64, error) {
+	items, err := m.ListRequests(ctx, q, cur, limit)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, 0, len(items))
+	for _, req := range items {
+		ids = append(ids, req.ID)
+	}
+	return ids, nil
+}
+
+func (m *MemStore) GetProcessingRequest(ctx context.Context) (Request, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.requests) - 1; i >= 0; i-- {
+		if m.requests[i].Status == StatusProcessing {
+			return copyRequest(m.requests[i]), true, nil
+		}
+	}
+	return Request{}, false, nil
+}
+
+func (m *MemStore) ClaimNextPending(ctx context.Context) (Request, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked() {
+		return Request{}, false, nil
+	}
+	for i := range m.requests {
+		if m.requests[i].Status == StatusPending && m.ready(m.requests[i].ID) {
+			m.requests[i].Status = StatusProcessing
+			m.requests[i].StartedAtMs = time.Now().UnixMilli()
+			return copyRequest(m.requests[i]), true, nil
+		}
+	}
+	return Request{}, false, nil
+}
+
+// ready reports whether everything id depends on has been processed;
+// callers hold mu
+func (m *MemStore) ready(id int64) bool {
+	for _, dep := range m.deps[id] {
+		if req, ok := m.request(dep); ok && req.Status != StatusProcessed {
+			return false
+		}
+	}
+	return true
+}
+
+// skipDependents mirrors Store's: pending requests below id are skipped;
+// callers hold mu
+func (m *MemStore) skipDependents(id int64, status Status) {
+	if !status.Final() || status == StatusProcessed {
+		return
+	}
+	below := map[int64]bool{id: true}
+	// requests depend only on older ones, so one pass in ID order finds all
+	for i := range m.requests {
+		req := &m.requests[i]
+		if !slices.ContainsFunc(m.deps[req.ID], func(dep int64) bool { return below[dep] }) {
+			continue
+		}
+		below[req.ID] = true
+		if req.Status == StatusPending {
+			req.Status = StatusSkipped
+			req.Response = skippedResponse(id, status)
+			req.FinishedAtMs = time.Now().UnixMilli()
+		}
+	}
+}
+
+func (m *MemStore) UpdateRequest(ctx context.Context, id int64, status Status, response string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, ok := m.request(id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if !req.Status.CanTransition(status) {
+		return &TransitionError{ID: id, From: req.Status, To: status}
+	}
+	req.Status = status
+	req.Response = response
+	req.Failure = nil
+	if status.Final() {
+		req.FinishedAtMs = time.Now().UnixMilli()
+	}
+	m.skipDependents(id, status)
+	return nil
+}
+
+func (m *MemStore) FailRequest(ctx context.Context, id int64, f Failure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, ok := m.request(id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	switch {
+	case req.Status.CanTransition(StatusError):
+		req.Status = StatusError
+		req.Response = f.Summary()
+		req.FinishedAtMs = time.Now().UnixMilli()
+		m.skipDependents(id, StatusError)
+	case req.Status != StatusCancelled:
+		return &TransitionError{ID: id, From: req.Status, To: StatusError}
+	}
+	f.StderrTail = slices.Clone(f.StderrTail)
+	req.Failure = &f
+	return nil
+}
+
+func (m *MemStore) CompleteRequest(ctx context.Context, id int64, warnings []string) error {
+	if err := m.UpdateRequest(ctx, id, StatusProcessed, ""); err != nil {
+		return err
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, _ := m.request(id)
+	req.Failure = &Failure{Warnings: slices.Clone(warnings)}
+	return nil
+}
+
+func (m *MemStore) SetRequestModel(ctx context.Context, id int64, model string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if req, ok := m.request(id); ok {
+		req.Model = model
+	}
+	return nil
+}
+
+func (m *MemStore) SetSessionID(ctx context.Context, id int64, sessionID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if req, ok := m.request(id); ok {
+		req.SessionID = sessionID
+	}
+	return nil
+}
+
+func (m *MemStore) GetThread(ctx context.Context, threadID int64) ([]Request, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reqs := []Request{}
+	for _, req := range m.requests {
+		if req.ThreadID == threadID {
+			reqs = append(reqs, copyRequest(req))
+		}
+	}
+	return reqs, nil
+}
+
+func (m *MemStore) AddUsage(ctx context.Context, id int64, inputTokens, outputTokens int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if req, ok := m.request(id); ok {
+		req.InputTokens += inputTokens
+		req.OutputTokens += outputTokens
+	}
+	return nil
+}
+
+func (m *MemStore) CancelRequest(ctx context.Context, id int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	req, ok := m.request(id)
+	if !ok || !req.Status.CanTransition(StatusCancelled) {
+		return false, nil
+	}
+	req.Status = StatusCancelled
+	req.FinishedAtMs = time.Now().UnixMilli()
+	m.skipDependents(id, StatusCancelled)
+	return true, nil
+}
+
+func (m *MemStore) AddOutputLine(ctx context.Context, requestID int64, lineNum int, lineType, content string) error {
+	return m.AddOutputLines(ctx, []OutputLine{{
+		RequestID: requestID,
+		LineNum:   lineNum,
+		LineType:  lineType,
+		Content:   content,
+	}})
+}
+
+func (m *MemStore) AddOutputLines(ctx context.Context, lines []OutputLine) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := memNow()
+	for _, line := range lines {
+		if spilled, ok := splitOversized(line); ok {
+			m.blobs[spilled.BlobHash] = []byte(line.Content)
+			line = spilled
+		}
+		m.lineID++
+		line.ID = m.lineID
+		line.CreatedAt = now
+		m.lines[line.RequestID] = append(m.lines[line.RequestID], line)
+	}
+	for _, line := range lines {
+		stored := m.lines[line.RequestID]
+		sort.SliceStable(stored, func(i, j int) bool { return stored[i].LineNum < stored[j].LineNum })
+	}
+	return nil
+}
+
+func (m *MemStore) GetOutputLine(ctx context.Context, requestID int64, lineNum int) (OutputLine, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, line := range m.lines[requestID] {
+		if line.LineNum == lineNum {
+			return line, true, nil
+		}
+	}
+	return OutputLine{}, false, nil
+}
+
+func (m *MemStore) GetLatestOutputLine(ctx context.Context, requestID int64, lineType string) (OutputLine, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.lines[requestID]
+	for i := len(stored) - 1; i >= 0; i-- {
+		if stored[i].LineType == lineType {
+			return stored[i], true, nil
+		}
+	}
+	return OutputLine{}, false, nil
+}
+
+// GetOutputLines returns lines newest first, like Store.GetOutputLines
+func (m *MemStore) GetOutputLines(ctx context.Context, requestID int64, limit, offset int) ([]OutputLine, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := m.lines[requestID]
+	var lines []OutputLine
+	for i := len(stored) - 1 - offset; i >= 0 && (limit < 0 || len(lines) < limit); i-- {
+		lines = append(lines, stored[i])
+	}
+	return lines, nil
+}
+
+func (m *MemStore) CountOutputLines(ctx context.Context, requestID int64, before int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int
+	for _, line := range m.lines[requestID] {
+		if before <= 0 || line.LineNum < before {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemStore) GetOutputLinesAfter(ctx context.Context, requestID int64, after, limit int) ([]OutputLine, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var lines []OutputLine
+	for _, line := range m.lines[requestID] {
+		if limit >= 0 && len(lines) >= limit {
+			break
+		}
+		if line.LineNum > after {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+func (m *MemStore) GetBlob(ctx context.Context, hash string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.blobs[hash]
+	return data, ok, nil
+}
+
+// Prune applies the policy like Store.Prune. Sizes count stored content
+// and blob bytes since there is no database file.
+func (m *MemStore) Prune(ctx context.Context, policy RetentionPolicy) (PruneReport, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report := PruneReport{BytesBefore: m.size()}
+	now := time.Now()
+
+	finishedBefore := func(req Request, age time.Duration) bool {
+		return req.Finished() && req.FinishedAtMs < now.Add(-age).UnixMilli()
+	}
+	for _, req := range m.requests {
+		lines := m.lines[req.ID]
+		switch {
+		case policy.MaxAge > 0 && finishedBefore(req, policy.MaxAge):
+			m.deleteOutput(req.ID, &report)
+		case policy.FinalOnlyAge > 0 && finishedBefore(req, policy.FinalOnlyAge):
+			var kept []OutputLine
+			for i := len(lines) - 1; i >= 0; i-- {
+				if lines[i].LineType == "message" {
+					kept = append(kept, lines[i])
+					break
+				}
+			}
+			report.LinesDeleted += int64(len(lines) - len(kept))
+			m.lines[req.ID] = kept
+		}
+	}
+	report.BlobsDeleted += m.dropOrphanBlobs()
+
+	if excess := m.size() - policy.MaxDBSize; policy.MaxDBSize > 0 && excess > 0 {
+		// pick the whole set first, oldest finished first, as Store does
+		var finished []Request
+		for _, req := range m.requests {
+			if req.Finished() && (len(m.lines[req.ID]) > 0 || len(m.artifacts[req.ID]) > 0) {
+				finished = append(finished, req)
+			}
+		}
+		slices.SortStableFunc(finished, func(a, b Request) int { return cmp.Compare(a.FinishedAtMs, b.FinishedAtMs) })
+		var freed int64
+		for _, req := range finished {
+			if freed >= excess {
+				break
+			}
+			freed += m.outputSize(req.ID)
+			m.deleteOutput(req.ID, &report)
+		}
+		report.BlobsDeleted += m.dropOrphanBlobs()
+	}
+	report.BytesAfter = m.size()
+	return report, nil
+}
+
+// deleteOutput drops a request's lines and artifacts; callers hold mu
+func (m *MemStore) deleteOutput(id int64, report *PruneReport) {
+	report.LinesDeleted += int64(len(m.lines[id]))
+	report.ArtifactsDeleted += int64(len(m.artifacts[id]))
+	delete(m.lines, id)
+	delete(m.artifacts, id)
+}
+
+// outputSize counts a request's share of size(); callers hold mu
+func (m *MemStore) outputSize(id int64) int64 {
+	var size int64
+	for _, line := range m.lines[id] {
+		size += int64(len(line.Content)) + int64(len(m.blobs[line.BlobHash]))
+	}
+	for _, a := range m.artifacts[id] {
+		size += int64(len(m.blobs[a.hash]))
+	}
+	return size
+}
+
+func (m *MemStore) size() int64 {
+	var size int64
+	for _, lines := range m.lines {
+		for _, line := range lines {
+			size += int64(len(line.Content))
+		}
+	}
+	for _, data := range m.blobs {
+		size += int64(len(data))
+	}
+	return size
+}
+
+func (m *MemStore) dropOrphanBlobs() int64 {
+	used := map[string]bool{}
+	for _, lines := range m.lines {
+		for _, line := range lines {
+			if line.BlobHash != "" {
+				used[line.BlobHash] = true
+			}
+		}
+	}
+	for _, artifacts := range m.artifacts {
+		for _, a := range artifacts {
+			used[a.hash] = true
+		}
+	}
+	var n int64
+	for hash := range m.blobs {
+		if !used[hash] {
+			delete(m.blobs, hash)
+			n++
+		}
+	}
+	return n
+}
+
+func (m *MemStore) RecordFiles(ctx context.Context, files []RequestFile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range files {
+		stored := m.files[f.RequestID]
+		i := sort.Search(len(stored), func(i int) bool { return stored[i].Path >= f.Path })
+		if i < len(stored) && stored[i].Path == f.Path {
+			stored[i].Kind = f.Kind
+			stored[i].Added = max(stored[i].Added, f.Added)
+			stored[i].Removed = max(stored[i].Removed, f.Removed)
+			continue
+		}
+		m.files[f.RequestID] = slices.Insert(stored, i, f)
+	}
+	return nil
+}
+
+func (m *MemStore) GetRequestFiles(ctx context.Context, requestID int64) ([]RequestFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RequestFile{}, m.files[requestID]...), nil
+}
+
+func (m *MemStore) FilesTouched(ctx context.Context, path string, offset, limit int) ([]FileTouch, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	touches := []FileTouch{}
+	for id := int64(len(m.requests)); id >= 1; id-- {
+		for _, f := range m.files[id] {
+			if f.Path != path && !(strings.HasSuffix(path, "/") && strings.HasPrefix(f.Path, path)) {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+			if len(touches) == limit {
+				return touches, nil
+			}
+			req := m.requests[id-1]
+			touches = append(touches, FileTouch{RequestFile: f, Prompt: req.Prompt, Status: req.Status, CreatedAt: req.CreatedAt})
+		}
+	}
+	return touches, nil
+}
+
+// Search matches case-insensitive substrings instead of FTS5 tokens, every
+// term required, newest requests first
+func (m *MemStore) Search(ctx context.Context, query string, offset, limit int) ([]SearchHit, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	terms := strings.Fields(strings.ToLower(query))
+	hits := []SearchHit{}
+	if len(terms) == 0 || limit == 0 {
+		return hits, nil
+	}
+	add := func(hit SearchHit, text string) bool {
+		snippet, ok := memSnippet(text, terms)
+		if !ok {
+			return true
+		}
+		if offset > 0 {
+			offset--
+			return true
+		}
+		hit.Snippet = highlight(snippet)
+		hits = append(hits, hit)
+		return limit < 0 || len(hits) < limit
+	}
+	for i := len(m.requests) - 1; i >= 0; i-- {
+		req := m.requests[i]
+		if !add(SearchHit{RequestID: req.ID, LineType: "prompt", CreatedAt: req.CreatedAt}, req.Prompt) {
+			return hits, nil
+		}
+		for _, line := range m.lines[req.ID] {
+			hit := SearchHit{RequestID: req.ID, LineNum: line.LineNum, LineType: line.LineType, CreatedAt: line.CreatedAt}
+			if !add(hit, line.Content) {
+				return hits, nil
+			}
+		}
+	}
+	return hits, nil
+}
+
+// memSnippet returns text around the first term with every term marked,
+// or false unless all terms occur
+func memSnippet(text string, terms []string) (string, bool) {
+	lower := strings.ToLower(text)
+	first := len(text)
+	for _, term := range terms {
+		i := strings.Index(lower, term)
+		if i < 0 {
+			return "", false
+		}
+		first = min(first, i)
+	}
+	// lowercasing can change byte lengths; fall back to the whole text
+	if len(lower) != len(text) {
+		return text, true
+	}
+	start, end := max(0, first-40), min(len(text), first+80)
+	for start > 0 && !utf8.RuneStart(text[start]) {
+		start--
+	}
+	for end < len(text) && !utf8.RuneStart(text[end]) {
+		end++
+	}
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	for i := start; i < end; {
+		matched := ""
+		for _, term := range terms {
+			if strings.HasPrefix(lower[i:], term) && len(term) > len(matched) {
+				matched = term
+			}
+		}
+		if matched == "" {
+			b.WriteByte(text[i])
+			i++
+			continue
+		}
+		b.WriteString(markStart + text[i:i+len(matched)] + markEnd)
+		i += len(matched)
+	}
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+func (m *MemStore) SaveArtifact(ctx context.Context, a Artifact, content []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hash := blobHash(content)
+	m.blobs[hash] = append([]byte(nil), content...)
+	a.Size = len(content)
+	a.CreatedAt = memNow()
+	if m.artifacts[a.RequestID] == nil {
+		m.artifacts[a.RequestID] = map[string]memArtifact{}
+	}
+	m.artifacts[a.RequestID][a.Name] = memArtifact{Artifact: a, hash: hash}
+	return nil
+}
+
+func (m *MemStore) GetArtifact(ctx context.Context, requestID int64, name string) (Artifact, []byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.artifacts[requestID][name]
+	if !ok {
+		return Artifact{}, nil, false, nil
+	}
+	return a.Artifact, m.blobs[a.hash], true, nil
+}
+
+func (m *MemStore) ListArtifacts(ctx context.Context, requestID int64) ([]Artifact, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	artifacts := []Artifact{}
+	for _, a := range m.artifacts[requestID] {
+		artifacts = append(artifacts, a.Artifact)
+	}
+	slices.SortFunc(artifacts, func(a, b Artifact) int { return strings.Compare(a.Name, b.Name) })
+	return artifacts, nil
+}
+
+func (m *MemStore) SaveBranch(ctx context.Context, b RequestBranch) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b.UpdatedAt = memNow()
+	m.branches[b.RequestID] = b
+	return nil
+}
+
+func (m *MemStore) GetBranch(ctx context.Context, requestID int64) (RequestBranch, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.branches[requestID]
+	return b, ok, nil
+}
+
+func (m *MemStore) SaveSnapshot(ctx context.Context, snap RequestSnapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if snap.CreatedAt == "" {
+		snap.CreatedAt = memNow()
+	}
+	snap.Exclude = slices.Clone(snap.Exclude)
+	m.snapshots[snap.RequestID] = snap
+	return nil
+}
+
+func (m *MemStore) GetSnapshot(ctx context.Context, requestID int64) (RequestSnapshot, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap, ok := m.snapshots[requestID]
+	snap.Exclude = slices.Clone(snap.Exclude)
+	return snap, ok, nil
+}
+
+func (m *MemStore) DeleteSnapshot(ctx context.Context, requestID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.snapshots, requestID)
+	return nil
+}
+
+func (m *MemStore) LockWorkdir(ctx context.Context, requestID, untilMs int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.locked() || slices.ContainsFunc(m.requests, func(r Request) bool { return r.Status == StatusProcessing }) {
+		return false, nil
+	}
+	m.lock = memLock{requestID: requestID, expiresAtMs: untilMs}
+	return true, nil
+}
+
+func (m *MemStore) UnlockWorkdir(ctx context.Context, requestID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lock.requestID == requestID {
+		m.lock = memLock{}
+	}
+	return nil
+}
+
+// locked reports whether a rollback holds the workdir; callers hold mu
+func (m *MemStore) locked() bool {
+	return m.lock.expiresAtMs > time.Now().UnixMilli()
+}
+
+func (m *MemStore) AddEvent(ctx context.Context, e RequestEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.ID = int64(len(m.events)) + 1
+	e.CreatedAt = memNow()
+	m.events = append(m.events, e)
+	return nil
+}
+
+func (m *MemStore) ListEvents(ctx context.Context, requestID int64) ([]RequestEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := []RequestEvent{}
+	for _, e := range m.events {
+		if e.RequestID == requestID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *MemStore) CreatePipeline(ctx context.Context, np NewPipeline) (Pipeline, error) {
+	order, err := np.order()
+	if err != nil {
+		return Pipeline{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := Pipeline{ID: int64(len(m.pipelines)) + 1, Name: np.Name, CreatedAt: memNow()}
+	m.pipelines = append(m.pipelines, p)
+	ids := map[string]int64{}
+	for _, i := range order {
+		step := np.Steps[i]
+		nr := NewRequest{Prompt: step.Prompt, Project: np.Project, Model: np.Model, Tags: np.Tags}
+		req := m.insertRequest(nr, p.ID, step.Name)
+		ids[step.Name] = req.ID
+		for _, dep := range slices.Compact(slices.Sorted(slices.Values(step.DependsOn))) {
+			m.deps[req.ID] = append(m.deps[req.ID], ids[dep])
+		}
+		slices.Sort(m.deps[req.ID])
+	}
+	return m.pipeline(p), nil
+}
+
+func (m *MemStore) GetPipeline(ctx context.Context, id int64) (Pipeline, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.pipelines)) {
+		return Pipeline{}, false, nil
+	}
+	return m.pipeline(m.pipelines[id-1]), true, nil
+}
+
+func (m *MemStore) ListPipelines(ctx context.Context, offset, limit int) ([]Pipeline, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pipelines := []Pipeline{}
+	for i := len(m.pipelines) - 1 - offset; i >= 0 && len(pipelines) < limit; i-- {
+		pipelines = append(pipelines, m.pipeline(m.pipelines[i]))
+	}
+	return pipelines, nil
+}
+
+// pipeline returns p with its steps; callers hold mu
+func (m *MemStore) pipeline(p Pipeline) Pipeline {
+	var reqs []Request
+	for _, req := range m.requests {
+		if req.PipelineID == p.ID {
+			reqs = append(reqs, copyRequest(req))
+		}
+	}
+	buildPipeline(&p, reqs, m.deps)
+	return p
+}
+
+func (m *MemStore) CreateSchedule(ctx context.Context, sched Schedule) (Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scheduleID++
+	sched.ID = m.scheduleID
+	sched.CreatedAt, sched.UpdatedAt = memNow(), memNow()
+	m.schedules[sched.ID] = copySchedule(sched)
+	return sched, nil
+}
+
+func (m *MemStore) UpdateSchedule(ctx context.Context, sched Schedule) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old, ok := m.schedules[sched.ID]
+	if !ok {
+		return false, nil
+	}
+	sched.CreatedAt, sched.UpdatedAt = old.CreatedAt, memNow()
+	sched.LastRunAtMs, sched.SkippedRuns = old.LastRunAtMs, old.SkippedRuns
+	m.schedules[sched.ID] = copySchedule(sched)
+	return true, nil
+}
+
+func (m *MemStore) DeleteSchedule(ctx context.Context, id int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.schedules[id]
+	delete(m.schedules, id)
+	return ok, nil
+}
+
+func (m *MemStore) GetSchedule(ctx context.Context, id int64) (Schedule, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sched, ok := m.schedules[id]
+	return copySchedule(sched), ok, nil
+}
+
+func (m *MemStore) ListSchedules(ctx context.Context) ([]Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	schedules := []Schedule{}
+	for _, sched := range m.schedules {
+		schedules = append(schedules, copySchedule(sched))
+	}
+	slices.SortFunc(schedules, func(a, b Schedule) int { return cmp.Compare(a.ID, b.ID) })
+	return schedules, nil
+}
+
+func (m *MemStore) DueSchedules(ctx context.Context, nowMs int64) ([]Schedule, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	due := []Schedule{}
+	for _, sched := range m.schedules {
+		if sched.Enabled && sched.NextRunAtMs > 0 && sched.NextRunAtMs <= nowMs {
+			due = append(due, copySchedule(sched))
+		}
+	}
+	slices.SortFunc(due, func(a, b Schedule) int {
+		return cmp.Or(cmp.Compare(a.NextRunAtMs, b.NextRunAtMs), cmp.Compare(a.ID, b.ID))
+	})
+	return due, nil
+}
+
+func (m *MemStore) FireSchedule(ctx context.Context, id, due, next int64, skipped int, runs []NewRequest) ([]Request, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sched, ok := m.schedules[id]
+	if !ok || !sched.Enabled || sched.NextRunAtMs != due {
+		return nil, false, nil
+	}
+	sched.NextRunAtMs = next
+	sched.SkippedRuns += int64(skipped)
+	if len(runs) > 0 {
+		sched.LastRunAtMs = lastSlot(runs)
+	}
+	m.schedules[id] = sched
+	var reqs []Request
+	for _, nr := range runs {
+		reqs = append(reqs, m.insertRequest(nr, 0, ""))
+	}
+	return reqs, true, nil
+}
@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations are named NNNN_description.up.sql and NNNN_description.down.sql
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer binary
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes one known migration and whether it is applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt string
+}
+
+var migrations = mustLoadMigrations()
+
+func mustLoadMigrations() []migration {
+	list, err := loadMigrations(migrationsFS)
+	if err != nil {
+		panic(err)
+	}
+	return list
+}
+
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	paths, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*migration{}
+	for _, path := range paths {
+		base := strings.TrimPrefix(path, "migrations/")
+		name, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected .up.sql or .down.sql", base)
+		}
+		numStr, label, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(numStr)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s: invalid version", base)
+		}
+		body, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{Version: version, Name: label}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	list := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d: missing up or down file", m.Version)
+		}
+		list = append(list, *m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	for i, m := range list {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d: versions must be contiguous from 1", m.Version)
+		}
+	}
+	return list, nil
+}
+
+// LatestSchemaVersion is the newest schema this binary knows about
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+func (s *Store) ensureVersionTable(ctx context.Context) error {
+	_, err := s.w.ExecContext(
+		ctx,
+		`CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)`,
+	)
+	return err
+}
+
+// SchemaVersion returns the highest applied migration, or 0 for an empty database
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	if err := s.ensureVersionTable(ctx); err != nil {
+		return 0, err
+	}
+	row := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version")
+	var version int
+	err := row.Scan(&version)
+	return version, err
+}
+
+// MigrationStatus lists every known migration along with any applied
+// versions this binary does not know about
+func (s *Store) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	if err := s.ensureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_version ORDER BY version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]MigrationStatus{}
+	for rows.Next() {
+		var st MigrationStatus
+		if err := rows.Scan(&st.Version, &st.Name, &st.AppliedAt); err != nil {
+			return nil, err
+		}
+		st.Applied = true
+		applied[st.Version] = st
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var list []MigrationStatus
+	for _, m := range migrations {
+		st, ok := applied[m.Version]
+		if !ok {
+			st = MigrationStatus{Version: m.Version, Name: m.Name}
+		}
+		list = append(list, st)
+		delete(applied, m.Version)
+	}
+	for _, st := range applied {
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// MigrateUp applies pending migrations up to target, or all of them when
+// target is 0. Each migration runs in its own transaction.
+func (s *Store) MigrateUp(ctx context.Context, target int) error {
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("%w: database at version %d, binary supports %d", ErrSchemaTooNew, current, LatestSchemaVersion())
+	}
+	if target == 0 || target > LatestSchemaVersion() {
+		target = LatestSchemaVersion()
+	}
+	for _, m := range migrations[current:target] {
+		if err := s.applyMigration(ctx, m, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MigrateDown reverts applied migrations until the schema is at target
+func (s *Store) MigrateDown(ctx context.Context, target int) error {
+	current, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("%w: database at version %d, binary supports %d", ErrSchemaTooNew, current, LatestSchemaVersion())
+	}
+	if target < 0 {
+		target = 0
+	}
+	for v := current; v > target; v-- {
+		if err := s.applyMigration(ctx, migrations[v-1], false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) applyMigration(ctx context.Context, m migration, up bool) error {
+	tx, err := s.w.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// another process may have migrated while we waited for the write lock
+	var current int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return err
+	}
+	if (up && current >= m.Version) || (!up && current != m.Version) {
+		return nil
+	}
+
+	body := m.Down
+	if up {
+		body = m.Up
+		if m.Version == 1 {
+			if err := adoptLegacySchema(ctx, tx); err != nil {
+				return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+	}
+	if _, err := tx.ExecContext(ctx, body); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	if up {
+		_, err = tx.ExecContext(
+			ctx,
+			"INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+			m.Version, m.Name, time.Now().UTC().Format(time.RFC3339),
+		)
+	} else {
+		_, err = tx.ExecContext(ctx, "DELETE FROM schema_version WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// adoptLegacySchema brings databases created before line_type existed up
+// to the shape migration 1 expects
+func adoptLegacySchema(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT name FROM pragma_table_info('output_lines')")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	exists, hasLineType := false, false
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		exists = true
+		if name == "line_type" {
+			hasLineType = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if !exists || hasLineType {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, `ALTER TABLE output_lines ADD COLUMN line_type TEXT NOT NULL DEFAULT 'message'`)
+	return err
+}
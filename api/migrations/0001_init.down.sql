@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_output_lines_request;
+DROP TABLE IF EXISTS output_lines;
+DROP TABLE IF EXISTS requests;
@@ -0,0 +1,24 @@
+-- requests and their codex output; IF NOT EXISTS adopts databases
+-- created before schema versioning
+CREATE TABLE IF NOT EXISTS requests (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	prompt TEXT NOT NULL,
+	status TEXT NOT NULL,
+	response TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+-- output_lines table - each line of codex output stored as a row
+CREATE TABLE IF NOT EXISTS output_lines (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	request_id INTEGER NOT NULL,
+	line_num INTEGER NOT NULL,
+	line_type TEXT NOT NULL DEFAULT 'message',
+	content TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY (request_id) REFERENCES requests(id)
+);
+
+-- index for fast lookup by request_id
+CREATE INDEX IF NOT EXISTS idx_output_lines_request ON output_lines(request_id, line_num);
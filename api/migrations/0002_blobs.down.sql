@@ -0,0 +1,4 @@
+-- spilled lines keep only their preview after a downgrade
+ALTER TABLE output_lines DROP COLUMN full_size;
+ALTER TABLE output_lines DROP COLUMN blob_hash;
+DROP TABLE blobs;
@@ -0,0 +1,11 @@
+-- content-addressed, gzip-compressed storage for oversized output
+CREATE TABLE blobs (
+	hash TEXT PRIMARY KEY,
+	size INTEGER NOT NULL,
+	data BLOB NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+-- lines whose content was spilled keep a preview inline and point at the blob
+ALTER TABLE output_lines ADD COLUMN blob_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE output_lines ADD COLUMN full_size INTEGER NOT NULL DEFAULT 0;
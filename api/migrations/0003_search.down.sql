@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS output_lines_fts_update;
+DROP TRIGGER IF EXISTS output_lines_fts_delete;
+DROP TRIGGER IF EXISTS output_lines_fts_insert;
+DROP TRIGGER IF EXISTS requests_fts_update;
+DROP TRIGGER IF EXISTS requests_fts_delete;
+DROP TRIGGER IF EXISTS requests_fts_insert;
+DROP TABLE IF EXISTS output_lines_fts;
+DROP TABLE IF EXISTS requests_fts;
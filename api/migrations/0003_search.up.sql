@@ -0,0 +1,44 @@
+-- full-text indexes over prompts and output, kept in sync by triggers
+CREATE VIRTUAL TABLE requests_fts USING fts5(
+	prompt,
+	content='requests',
+	content_rowid='id',
+	tokenize='porter unicode61'
+);
+
+CREATE VIRTUAL TABLE output_lines_fts USING fts5(
+	content,
+	content='output_lines',
+	content_rowid='id',
+	tokenize='porter unicode61'
+);
+
+CREATE TRIGGER requests_fts_insert AFTER INSERT ON requests BEGIN
+	INSERT INTO requests_fts (rowid, prompt) VALUES (new.id, new.prompt);
+END;
+
+CREATE TRIGGER requests_fts_delete AFTER DELETE ON requests BEGIN
+	INSERT INTO requests_fts (requests_fts, rowid, prompt) VALUES ('delete', old.id, old.prompt);
+END;
+
+CREATE TRIGGER requests_fts_update AFTER UPDATE OF prompt ON requests BEGIN
+	INSERT INTO requests_fts (requests_fts, rowid, prompt) VALUES ('delete', old.id, old.prompt);
+	INSERT INTO requests_fts (rowid, prompt) VALUES (new.id, new.prompt);
+END;
+
+CREATE TRIGGER output_lines_fts_insert AFTER INSERT ON output_lines BEGIN
+	INSERT INTO output_lines_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+CREATE TRIGGER output_lines_fts_delete AFTER DELETE ON output_lines BEGIN
+	INSERT INTO output_lines_fts (output_lines_fts, rowid, content) VALUES ('delete', old.id, old.content);
+END;
+
+CREATE TRIGGER output_lines_fts_update AFTER UPDATE OF content ON output_lines BEGIN
+	INSERT INTO output_lines_fts (output_lines_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	INSERT INTO output_lines_fts (rowid, content) VALUES (new.id, new.content);
+END;
+
+-- index everything written before this migration
+INSERT INTO requests_fts (requests_fts) VALUES ('rebuild');
+INSERT INTO output_lines_fts (output_lines_fts) VALUES ('rebuild');
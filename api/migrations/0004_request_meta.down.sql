@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS idx_requests_model;
+DROP INDEX IF EXISTS idx_requests_project;
+DROP INDEX IF EXISTS idx_requests_status;
+DROP TABLE IF EXISTS request_tags;
+ALTER TABLE requests DROP COLUMN finished_at_ms;
+ALTER TABLE requests DROP COLUMN started_at_ms;
+ALTER TABLE requests DROP COLUMN output_tokens;
+ALTER TABLE requests DROP COLUMN input_tokens;
+ALTER TABLE requests DROP COLUMN model;
+ALTER TABLE requests DROP COLUMN project;
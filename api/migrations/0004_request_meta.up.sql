@@ -0,0 +1,20 @@
+-- labels and run metrics used to filter and sort the request list
+ALTER TABLE requests ADD COLUMN project TEXT NOT NULL DEFAULT '';
+ALTER TABLE requests ADD COLUMN model TEXT NOT NULL DEFAULT '';
+ALTER TABLE requests ADD COLUMN input_tokens INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE requests ADD COLUMN output_tokens INTEGER NOT NULL DEFAULT 0;
+-- unix milliseconds; 0 until the request starts or finishes
+ALTER TABLE requests ADD COLUMN started_at_ms INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE requests ADD COLUMN finished_at_ms INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE request_tags (
+	request_id INTEGER NOT NULL,
+	tag TEXT NOT NULL,
+	PRIMARY KEY (request_id, tag),
+	FOREIGN KEY (request_id) REFERENCES requests(id)
+);
+
+CREATE INDEX idx_request_tags_tag ON request_tags(tag, request_id);
+CREATE INDEX idx_requests_status ON requests(status, id);
+CREATE INDEX idx_requests_project ON requests(project, id);
+CREATE INDEX idx_requests_model ON requests(model, id);
@@ -0,0 +1 @@
+ALTER TABLE requests DROP COLUMN queued_at_ms;
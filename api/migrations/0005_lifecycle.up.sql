@@ -0,0 +1,4 @@
+-- unix milliseconds when the request was enqueued; older rows fall back
+-- to their second-precision created_at
+ALTER TABLE requests ADD COLUMN queued_at_ms INTEGER NOT NULL DEFAULT 0;
+UPDATE requests SET queued_at_ms = CAST(strftime('%s', created_at) AS INTEGER) * 1000;
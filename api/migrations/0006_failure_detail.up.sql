@@ -0,0 +1,2 @@
+-- JSON Failure record of a failed or cancelled run; empty when none
+ALTER TABLE requests ADD COLUMN error_detail TEXT NOT NULL DEFAULT '';
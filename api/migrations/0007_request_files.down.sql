@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_request_files_path;
+DROP TABLE IF EXISTS request_files;
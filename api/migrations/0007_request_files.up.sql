@@ -0,0 +1,13 @@
+-- files each request changed, from codex file_change items and the
+-- workdir's git diff after the run
+CREATE TABLE request_files (
+	request_id INTEGER NOT NULL,
+	path TEXT NOT NULL,
+	kind TEXT NOT NULL,
+	added INTEGER NOT NULL DEFAULT 0,
+	removed INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (request_id, path),
+	FOREIGN KEY (request_id) REFERENCES requests(id)
+);
+
+CREATE INDEX idx_request_files_path ON request_files(path, request_id);
@@ -0,0 +1,12 @@
+-- files a run produced besides its output, such as the workspace diff,
+-- stored gzip-compressed in blobs
+CREATE TABLE request_artifacts (
+	request_id INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	blob_hash TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	truncated INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	PRIMARY KEY (request_id, name),
+	FOREIGN KEY (request_id) REFERENCES requests(id)
+);
@@ -0,0 +1,14 @@
+-- the git branch a request ran on when the worker's branch mode is on
+CREATE TABLE request_branches (
+	request_id INTEGER PRIMARY KEY,
+	repo_dir TEXT NOT NULL,
+	branch TEXT NOT NULL,
+	target TEXT NOT NULL DEFAULT '',
+	base_sha TEXT NOT NULL,
+	commit_sha TEXT NOT NULL DEFAULT '',
+	state TEXT NOT NULL,
+	merge_sha TEXT NOT NULL DEFAULT '',
+	error TEXT NOT NULL DEFAULT '',
+	updated_at TEXT NOT NULL,
+	FOREIGN KEY (request_id) REFERENCES requests(id)
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_request_events_request;
+DROP TABLE IF EXISTS request_events;
+DROP TABLE IF EXISTS request_snapshots;
@@ -0,0 +1,24 @@
+-- tarballs of the workdir taken before a run, for rolling it back
+CREATE TABLE request_snapshots (
+	request_id INTEGER PRIMARY KEY,
+	dir TEXT NOT NULL,
+	path TEXT NOT NULL,
+	size INTEGER NOT NULL,
+	files INTEGER NOT NULL,
+	exclude TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	restored_at TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (request_id) REFERENCES requests(id)
+);
+
+-- things that happened to a request besides its run, oldest first
+CREATE TABLE request_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	request_id INTEGER NOT NULL,
+	kind TEXT NOT NULL,
+	message TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	FOREIGN KEY (request_id) REFERENCES requests(id)
+);
+
+CREATE INDEX idx_request_events_request ON request_events(request_id, id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_requests_thread;
+ALTER TABLE requests DROP COLUMN thread_id;
+ALTER TABLE requests DROP COLUMN parent_id;
+ALTER TABLE requests DROP COLUMN session_id;
@@ -0,0 +1,8 @@
+-- follow-up requests resume the codex session of the request before them
+ALTER TABLE requests ADD COLUMN session_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE requests ADD COLUMN parent_id INTEGER NOT NULL DEFAULT 0;
+-- the first request of the conversation; a request that starts one has its own ID
+ALTER TABLE requests ADD COLUMN thread_id INTEGER NOT NULL DEFAULT 0;
+UPDATE requests SET thread_id = id;
+
+CREATE INDEX idx_requests_thread ON requests(thread_id, id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_request_deps_depends_on;
+DROP TABLE IF EXISTS request_deps;
+DROP INDEX IF EXISTS idx_requests_pipeline;
+ALTER TABLE requests DROP COLUMN step;
+ALTER TABLE requests DROP COLUMN pipeline_id;
+DROP TABLE IF EXISTS pipelines;
@@ -0,0 +1,21 @@
+-- pipelines are small graphs of prompts; each step runs as a request
+CREATE TABLE pipelines (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL
+);
+
+ALTER TABLE requests ADD COLUMN pipeline_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE requests ADD COLUMN step TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_requests_pipeline ON requests(pipeline_id, id);
+
+-- a request is only claimed once every request it depends on is processed
+CREATE TABLE request_deps (
+	request_id INTEGER NOT NULL,
+	depends_on INTEGER NOT NULL,
+	PRIMARY KEY (request_id, depends_on),
+	FOREIGN KEY (request_id) REFERENCES requests(id),
+	FOREIGN KEY (depends_on) REFERENCES requests(id)
+);
+
+CREATE INDEX idx_request_deps_depends_on ON request_deps(depends_on);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_requests_schedule;
+ALTER TABLE requests DROP COLUMN scheduled_for_ms;
+ALTER TABLE requests DROP COLUMN schedule_id;
+DROP INDEX IF EXISTS idx_schedules_next_run;
+DROP TABLE IF EXISTS schedules;
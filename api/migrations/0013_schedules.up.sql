@@ -0,0 +1,28 @@
+-- schedules enqueue a request from a template prompt on a cron schedule
+CREATE TABLE schedules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL DEFAULT '',
+	cron TEXT NOT NULL,
+	time_zone TEXT NOT NULL DEFAULT 'UTC',
+	enabled INTEGER NOT NULL DEFAULT 1,
+	prompt TEXT NOT NULL,
+	project TEXT NOT NULL DEFAULT '',
+	model TEXT NOT NULL DEFAULT '',
+	-- tags are joined with newlines
+	tags TEXT NOT NULL DEFAULT '',
+	-- missed is what happens to runs missed while the scheduler was down:
+	-- 'skip', 'once' or 'all'
+	missed TEXT NOT NULL DEFAULT 'once',
+	-- next_run_at_ms is the next slot in unix milliseconds, 0 while disabled
+	next_run_at_ms INTEGER NOT NULL DEFAULT 0,
+	last_run_at_ms INTEGER NOT NULL DEFAULT 0,
+	skipped_runs INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+
+CREATE INDEX idx_schedules_next_run ON schedules(enabled, next_run_at_ms);
+
+ALTER TABLE requests ADD COLUMN schedule_id INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE requests ADD COLUMN scheduled_for_ms INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX idx_requests_schedule ON requests(schedule_id, id);
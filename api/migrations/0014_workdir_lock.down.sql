@@ -0,0 +1 @@
+DROP TABLE IF EXISTS workdir_lock;
@@ -0,0 +1,7 @@
+-- a rollback holds the workdir while it restores a snapshot; no request is
+-- claimed while the row exists and has not expired
+CREATE TABLE workdir_lock (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	request_id INTEGER NOT NULL,
+	expires_at_ms INTEGER NOT NULL
+);
@@ -0,0 +1,391 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxPipelineSteps bounds the size of a pipeline
+const maxPipelineSteps = 50
+
+// ErrInvalidPipeline is returned for pipelines whose steps do not form a
+// graph that can run
+var ErrInvalidPipeline = errors.New("invalid pipeline")
+
+// stepName is what a step may be called: no spaces, commas or colons, so
+// names can be listed in the text form of a pipeline
+var stepName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Pipeline is a small graph of prompts. Each step runs as a request that is
+// only claimed once the steps it depends on have been processed; a step
+// that fails or is cancelled skips every step after it.
+type Pipeline struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt string `json:"created_at"`
+	// Status sums up the steps: processing while any step is running or
+	// waiting behind finished ones, processed once all are, and otherwise
+	// the worst way a step ended
+	Status Status         `json:"status"`
+	Steps  []PipelineStep `json:"steps"`
+}
+
+// PipelineStep is one step of a pipeline and the request it runs as
+type PipelineStep struct {
+	Name    string  `json:"name"`
+	Request Request `json:"request"`
+	// DependsOn names the steps that must be processed first
+	DependsOn []string `json:"depends_on"`
+	// Layer is the length of the longest chain of steps before this one
+	Layer int `json:"layer"`
+}
+
+// Waiting lists the steps this one still waits for, empty once it can run
+func (s PipelineStep) Waiting(p Pipeline) []string {
+	var names []string
+	for _, name := range s.DependsOn {
+		if dep, ok := p.Step(name); ok && dep.Request.Status != StatusProcessed {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Step returns the step called name
+func (p Pipeline) Step(name string) (PipelineStep, bool) {
+	for _, s := range p.Steps {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return PipelineStep{}, false
+}
+
+// NewPipeline is a pipeline to enqueue. Project, model and tags apply to
+// every step.
+type NewPipeline struct {
+	Name    string
+	Project string
+	Model   string
+	Tags    []string
+	Steps   []NewStep
+}
+
+// NewStep is a step of a NewPipeline; DependsOn names other steps
+type NewStep struct {
+	Name      string
+	Prompt    string
+	DependsOn []string
+}
+
+// Validate reports why the steps do not form a graph that can run, with
+// an error wrapping ErrInvalidPipeline
+func (np NewPipeline) Validate() error {
+	_, err := np.order()
+	return err
+}
+
+// order checks the steps and returns their indexes with every step after
+// the steps it depends on, keeping the given order where it can
+func (np NewPipeline) order() ([]int, error) {
+	if len(np.Steps) == 0 {
+		return nil, fmt.Errorf("%w: no steps", ErrInvalidPipeline)
+	}
+	if len(np.Steps) > maxPipelineSteps {
+		return nil, fmt.Errorf("%w: more than %d steps", ErrInvalidPipeline, maxPipelineSteps)
+	}
+	index := map[string]int{}
+	for i, step := range np.Steps {
+		if !stepName.MatchString(step.Name) {
+			return nil, fmt.Errorf("%w: step %d: name %q may only hold letters, digits, '.', '-' and '_'", ErrInvalidPipeline, i+1, step.Name)
+		}
+		if _, dup := index[step.Name]; dup {
+			return nil, fmt.Errorf("%w: step %q is defined twice", ErrInvalidPipeline, step.Name)
+		}
+		if strings.TrimSpace(step.Prompt) == "" {
+			return nil, fmt.Errorf("%w: step %q has no prompt", ErrInvalidPipeline, step.Name)
+		}
+		index[step.Name] = i
+	}
+	waiting := make([]int, len(np.Steps))
+	next := make([][]int, len(np.Steps))
+	for i, step := range np.Steps {
+		for _, dep := range slices.Compact(slices.Sorted(slices.Values(step.DependsOn))) {
+			j, ok := index[dep]
+			if !ok {
+				return nil, fmt.Errorf("%w: step %q depends on unknown step %q", ErrInvalidPipeline, step.Name, dep)
+			}
+			if j == i {
+				return nil, fmt.Errorf("%w: step %q depends on itself", ErrInvalidPipeline, step.Name)
+			}
+			waiting[i]++
+			next[j] = append(next[j], i)
+		}
+	}
+	// repeatedly take the first step with nothing left to wait for
+	order := make([]int, 0, len(np.Steps))
+	done := make([]bool, len(np.Steps))
+	for len(order) < len(np.Steps) {
+		i := -1
+		for j := range waiting {
+			if !done[j] && waiting[j] == 0 {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			var cycle []string
+			for j, step := range np.Steps {
+				if !done[j] {
+					cycle = append(cycle, step.Name)
+				}
+			}
+			return nil, fmt.Errorf("%w: steps %s depend on each other", ErrInvalidPipeline, strings.Join(cycle, ", "))
+		}
+		done[i] = true
+		order = append(order, i)
+		for _, j := range next[i] {
+			waiting[j]--
+		}
+	}
+	return order, nil
+}
+
+// ParsePipelineSteps reads the text form of a pipeline's steps, one per
+// line:
+//
+//	tests: write tests for the parser
+//	impl after tests: implement the parser
+//	lint after impl: run lint and fix what it reports
+//
+// Indented lines continue the prompt of the step above, and lines starting
+// with # are ignored.
+func ParsePipelineSteps(text string) ([]NewStep, error) {
+	var steps []NewStep
+	for n, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(steps) == 0 {
+				return nil, fmt.Errorf("%w: line %d: indented line before the first step", ErrInvalidPipeline, n+1)
+			}
+			steps[len(steps)-1].Prompt += "\n" + trimmed
+			continue
+		}
+		head, prompt, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d: expected \"name: prompt\"", ErrInvalidPipeline, n+1)
+		}
+		fields := strings.Fields(head)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("%w: line %d: step has no name", ErrInvalidPipeline, n+1)
+		}
+		step := NewStep{Name: fields[0], Prompt: strings.TrimSpace(prompt)}
+		if len(fields) > 1 {
+			if fields[1] != "after" || len(fields) == 2 {
+				return nil, fmt.Errorf("%w: line %d: expected \"name after step, ...: prompt\"", ErrInvalidPipeline, n+1)
+			}
+			for _, dep := range strings.Split(strings.Join(fields[2:], " "), ",") {
+				if dep = strings.TrimSpace(dep); dep != "" {
+					step.DependsOn = append(step.DependsOn, dep)
+				}
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// buildPipeline fills in p's steps from its requests, oldest first, and the
+// requests each depends on
+func buildPipeline(p *Pipeline, reqs []Request, deps map[int64][]int64) {
+	names := map[int64]string{}
+	layers := map[int64]int{}
+	p.Steps = make([]PipelineStep, 0, len(reqs))
+	for _, req := range reqs {
+		names[req.ID] = req.Step
+		step := PipelineStep{Name: req.Step, Request: req, DependsOn: []string{}}
+		// steps were stored after the steps they depend on
+		for _, dep := range deps[req.ID] {
+			step.DependsOn = append(step.DependsOn, names[dep])
+			step.Layer = max(step.Layer, layers[dep]+1)
+		}
+		layers[req.ID] = step.Layer
+		p.Steps = append(p.Steps, step)
+	}
+	p.Status = pipelineStatus(p.Steps)
+}
+
+func pipelineStatus(steps []PipelineStep) Status {
+	counts := map[Status]int{}
+	for _, s := range steps {
+		counts[s.Request.Status]++
+	}
+	switch {
+	case counts[StatusPending] == len(steps):
+		return StatusPending
+	case counts[StatusProcessing] > 0, counts[StatusPending] > 0:
+		return StatusProcessing
+	case counts[StatusProcessed] == len(steps):
+		return StatusProcessed
+	case counts[StatusError] > 0:
+		return StatusError
+	}
+	return StatusCancelled
+}
+
+// skippedResponse explains why a request was skipped
+func skippedResponse(id int64, status Status) string {
+	return fmt.Sprintf("skipped: request %d it depends on ended as %s", id, status)
+}
+
+// CreatePipeline enqueues every step of np as a request, each after the
+// steps it depends on
+func (s *Store) CreatePipeline(ctx context.Context, np NewPipeline) (Pipeline, error) {
+	order, err := np.order()
+	if err != nil {
+		return Pipeline{}, err
+	}
+	var p Pipeline
+	err = retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		now := time.Now().UTC()
+		p = Pipeline{Name: np.Name, CreatedAt: now.Format(time.RFC3339)}
+		res, err := tx.ExecContext(ctx, "INSERT INTO pipelines (name, created_at) VALUES (?, ?)", p.Name, p.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if p.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+		ids := map[string]int64{}
+		reqs := make([]Request, 0, len(order))
+		deps := map[int64][]int64{}
+		for _, i := range order {
+			step := np.Steps[i]
+			nr := NewRequest{Prompt: step.Prompt, Project: np.Project, Model: np.Model, Tags: np.Tags}
+			req, err := insertRequest(ctx, tx, nr, now, p.ID, step.Name)
+			if err != nil {
+				return err
+			}
+			ids[step.Name] = req.ID
+			for _, dep := range slices.Compact(slices.Sorted(slices.Values(step.DependsOn))) {
+				if _, err := tx.ExecContext(ctx, "INSERT INTO request_deps (request_id, depends_on) VALUES (?, ?)", req.ID, ids[dep]); err != nil {
+					return err
+				}
+				deps[req.ID] = append(deps[req.ID], ids[dep])
+			}
+			reqs = append(reqs, req)
+		}
+		buildPipeline(&p, reqs, deps)
+		return tx.Commit()
+	})
+	if err != nil {
+		return Pipeline{}, err
+	}
+	return p, nil
+}
+
+// GetPipeline returns a pipeline with its steps in the order they were
+// stored
+func (s *Store) GetPipeline(ctx context.Context, id int64) (Pipeline, bool, error) {
+	var p Pipeline
+	err := s.db.QueryRowContext(ctx, "SELECT id, name, created_at FROM pipelines WHERE id = ?", id).Scan(&p.ID, &p.Name, &p.CreatedAt)
+	if err == sql.ErrNoRows {
+		return Pipeline{}, false, nil
+	}
+	if err != nil {
+		return Pipeline{}, false, err
+	}
+	if err := s.loadSteps(ctx, &p); err != nil {
+		return Pipeline{}, false, err
+	}
+	return p, true, nil
+}
+
+// ListPipelines returns pipelines newest first
+func (s *Store) ListPipelines(ctx context.Context, offset, limit int) ([]Pipeline, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT id, name, created_at FROM pipelines ORDER BY id DESC LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	pipelines := []Pipeline{}
+	for rows.Next() {
+		var p Pipeline
+		if err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt); err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	for i := range pipelines {
+		if err := s.loadSteps(ctx, &pipelines[i]); err != nil {
+			return nil, err
+		}
+	}
+	return pipelines, nil
+}
+
+// loadSteps reads the requests of a pipeline and what they depend on
+func (s *Store) loadSteps(ctx context.Context, p *Pipeline) error {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+requestColumns+" FROM requests WHERE pipeline_id = ? ORDER BY id", p.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	reqs := []Request{}
+	for rows.Next() {
+		req, err := scanRequest(rows)
+		if err != nil {
+			return err
+		}
+		reqs = append(reqs, req)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+	if err := s.loadTags(ctx, reqs); err != nil {
+		return err
+	}
+
+	depRows, err := s.db.QueryContext(
+		ctx,
+		`SELECT d.request_id, d.depends_on FROM request_deps d JOIN requests r ON r.id = d.request_id
+		WHERE r.pipeline_id = ? ORDER BY d.request_id, d.depends_on`,
+		p.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer depRows.Close()
+	deps := map[int64][]int64{}
+	for depRows.Next() {
+		var id, dep int64
+		if err := depRows.Scan(&id, &dep); err != nil {
+			return err
+		}
+		deps[id] = append(deps[id], dep)
+	}
+	if err := depRows.Err(); err != nil {
+		return err
+	}
+	buildPipeline(p, reqs, deps)
+	return nil
+}
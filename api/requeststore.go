@@ -0,0 +1,71 @@
+package api
+
+import "context"
+
+// RequestStore is the persistence used by Service and the worker.
+// Store implements it on SQLite and MemStore in memory.
+type RequestStore interface {
+	CreateRequest(ctx context.Context, nr NewRequest) (Request, error)
+	GetRequest(ctx context.Context, id int64) (Request, bool, error)
+	ListRequests(ctx context.Context, q ListQuery, cur Cursor, limit int) ([]Request, error)
+	ListRequestIDs(ctx context.Context, q ListQuery, cur Cursor, limit int) ([]int64, error)
+	GetProcessingRequest(ctx context.Context) (Request, bool, error)
+	ClaimNextPending(ctx context.Context) (Request, bool, error)
+	UpdateRequest(ctx context.Context, id int64, status Status, response string) error
+	FailRequest(ctx context.Context, id int64, f Failure) error
+	CompleteRequest(ctx context.Context, id int64, warnings []string) error
+	CancelRequest(ctx context.Context, id int64) (bool, error)
+	SetRequestModel(ctx context.Context, id int64, model string) error
+	AddUsage(ctx context.Context, id int64, inputTokens, outputTokens int64) error
+	SetSessionID(ctx context.Context, id int64, sessionID string) error
+	GetThread(ctx context.Context, threadID int64) ([]Request, error)
+
+	CreatePipeline(ctx context.Context, np NewPipeline) (Pipeline, error)
+	GetPipeline(ctx context.Context, id int64) (Pipeline, bool, error)
+	ListPipelines(ctx context.Context, offset, limit int) ([]Pipeline, error)
+
+	CreateSchedule(ctx context.Context, sched Schedule) (Schedule, error)
+	UpdateSchedule(ctx context.Context, sched Schedule) (bool, error)
+	DeleteSchedule(ctx context.Context, id int64) (bool, error)
+	GetSchedule(ctx context.Context, id int64) (Schedule, bool, error)
+	ListSchedules(ctx context.Context) ([]Schedule, error)
+	DueSchedules(ctx context.Context, nowMs int64) ([]Schedule, error)
+	FireSchedule(ctx context.Context, id, due, next int64, skipped int, runs []NewRequest) ([]Request, bool, error)
+
+	AddOutputLine(ctx context.Context, requestID int64, lineNum int, lineType, content string) error
+	AddOutputLines(ctx context.Context, lines []OutputLine) error
+	GetOutputLine(ctx context.Context, requestID int64, lineNum int) (OutputLine, bool, error)
+	GetLatestOutputLine(ctx context.Context, requestID int64, lineType string) (OutputLine, bool, error)
+	GetOutputLines(ctx context.Context, requestID int64, limit, offset int) ([]OutputLine, error)
+	CountOutputLines(ctx context.Context, requestID int64, before int) (int, error)
+	GetOutputLinesAfter(ctx context.Context, requestID int64, after, limit int) ([]OutputLine, error)
+	GetBlob(ctx context.Context, hash string) ([]byte, bool, error)
+
+	Search(ctx context.Context, query string, offset, limit int) ([]SearchHit, error)
+
+	RecordFiles(ctx context.Context, files []RequestFile) error
+	GetRequestFiles(ctx context.Context, requestID int64) ([]RequestFile, error)
+	FilesTouched(ctx context.Context, path string, offset, limit int) ([]FileTouch, error)
+
+	SaveArtifact(ctx context.Context, a Artifact, content []byte) error
+	GetArtifact(ctx context.Context, requestID int64, name string) (Artifact, []byte, bool, error)
+	ListArtifacts(ctx context.Context, requestID int64) ([]Artifact, error)
+
+	SaveBranch(ctx context.Context, b RequestBranch) error
+	GetBranch(ctx context.Context, requestID int64) (RequestBranch, bool, error)
+
+	SaveSnapshot(ctx context.Context, snap RequestSnapshot) error
+	GetSnapshot(ctx context.Context, requestID int64) (RequestSnapshot, bool, error)
+	DeleteSnapshot(ctx context.Context, requestID int64) error
+	LockWorkdir(ctx context.Context, requestID, untilMs int64) (bool, error)
+	UnlockWorkdir(ctx context.Context, requestID int64) error
+	AddEvent(ctx context.Context, e RequestEvent) error
+	ListEvents(ctx context.Context, requestID int64) ([]RequestEvent, error)
+
+	Prune(ctx context.Context, policy RetentionPolicy) (PruneReport, error)
+}
+
+var (
+	_ RequestStore = (*Store)(nil)
+	_ RequestStore = (*MemStore)(nil)
+)
@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy decides which output of finished requests is deleted.
+// Requests themselves are always kept; zero values disable a rule.
+type RetentionPolicy struct {
+	// MaxAge deletes every output line of requests finished longer ago
+	MaxAge time.Duration
+	// FinalOnlyAge keeps only the final message of requests finished longer ago
+	FinalOnlyAge time.Duration
+	// MaxDBSize deletes output of the oldest finished requests, as much as
+	// their share of the stored output says will bring the database file
+	// down to this many bytes
+	MaxDBSize int64
+}
+
+// Empty reports whether the policy has no rules enabled
+func (p RetentionPolicy) Empty() bool {
+	return p.MaxAge <= 0 && p.FinalOnlyAge <= 0 && p.MaxDBSize <= 0
+}
+
+// PruneReport describes what a Prune call removed
+type PruneReport struct {
+	LinesDeleted     int64 `json:"lines_deleted"`
+	ArtifactsDeleted int64 `json:"artifacts_deleted"`
+	BlobsDeleted     int64 `json:"blobs_deleted"`
+	BytesBefore      int64 `json:"bytes_before"`
+	BytesAfter       int64 `json:"bytes_after"`
+}
+
+// Freed is the number of bytes reclaimed
+func (r PruneReport) Freed() int64 {
+	return r.BytesBefore - r.BytesAfter
+}
+
+// finishedBefore selects finished requests whose finished_at_ms is before
+// a cutoff. Requests finished before the column existed have 0 there and
+// count as the oldest.
+const finishedBefore = `SELECT id FROM requests
+	WHERE status NOT IN ('pending', 'processing') AND finished_at_ms < ?`
+
+// Prune applies the policy, removes blobs no line refers to any more and
+// VACUUMs the database once so the space is returned to the filesystem
+func (s *Store) Prune(ctx context.Context, policy RetentionPolicy) (PruneReport, error) {
+	var report PruneReport
+	var err error
+	if report.BytesBefore, err = s.dbSize(ctx); err != nil {
+		return report, err
+	}
+
+	now := time.Now()
+	if policy.MaxAge > 0 {
+		cutoff := now.Add(-policy.MaxAge).UnixMilli()
+		if err := s.deleteOutput(ctx, &report, `IN (`+finishedBefore+`)`, cutoff); err != nil {
+			return report, err
+		}
+	}
+	if policy.FinalOnlyAge > 0 {
+		cutoff := now.Add(-policy.FinalOnlyAge).UnixMilli()
+		n, err := s.execCount(
+			ctx,
+			`DELETE FROM output_lines
+			WHERE request_id IN (`+finishedBefore+`)
+			AND id NOT IN (
+				SELECT MAX(id) FROM output_lines WHERE line_type = 'message' GROUP BY request_id
+			)`,
+			cutoff,
+		)
+		if err != nil {
+			return report, err
+		}
+		report.LinesDeleted += n
+	}
+	if err := s.dropOrphanBlobs(ctx, &report); err != nil {
+		return report, err
+	}
+
+	if policy.MaxDBSize > 0 {
+		ids, err := s.oversizeRequests(ctx, policy.MaxDBSize)
+		if err != nil {
+			return report, err
+		}
+		if len(ids) > 0 {
+			in := "IN (?" + strings.Repeat(", ?", len(ids)-1) + ")"
+			if err := s.deleteOutput(ctx, &report, in, ids...); err != nil {
+				return report, err
+			}
+			if err := s.dropOrphanBlobs(ctx, &report); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	// merge the search index so deleted lines leave it before the VACUUM
+	if report.LinesDeleted > 0 {
+		if _, err := s.execCount(ctx, "INSERT INTO output_lines_fts (output_lines_fts) VALUES ('optimize')"); err != nil {
+			return report, err
+		}
+	}
+	if err := retry(ctx, func() error {
+		_, err := s.w.ExecContext(ctx, "VACUUM")
+		return err
+	}); err != nil {
+		return report, err
+	}
+	report.BytesAfter, err = s.dbSize(ctx)
+	return report, err
+}
+
+// oversizeRequests picks the oldest finished requests whose output must go
+// for the database to shrink to maxSize. Each request's share of the file
+// is estimated from its share of the stored output, so that one delete and
+// one VACUUM suffice.
+func (s *Store) oversizeRequests(ctx context.Context, maxSize int64) ([]any, error) {
+	var ids []any
+	err := retry(ctx, func() error {
+		ids = ids[:0]
+		row := s.w.QueryRowContext(ctx, "SELECT (page_count - freelist_count) * page_size FROM pragma_page_count(), pragma_freelist_count(), pragma_page_size()")
+		var used int64
+		if err := row.Scan(&used); err != nil {
+			return err
+		}
+		if used <= maxSize {
+			return nil
+		}
+		var total int64
+		row = s.w.QueryRowContext(
+			ctx,
+			`SELECT
+				(SELECT COALESCE(SUM(length(CAST(content AS BLOB))), 0) FROM output_lines)
+				+ (SELECT COALESCE(SUM(size), 0) FROM blobs)`,
+		)
+		if err := row.Scan(&total); err != nil {
+			return err
+		}
+		// the output bytes that make up the excess share of the file
+		excess := int64(float64(total) * float64(used-maxSize) / float64(used))
+		rows, err := s.w.QueryContext(
+			ctx,
+			`SELECT r.id,
+				(SELECT COALESCE(SUM(length(CAST(l.content AS BLOB)) + COALESCE(b.size, 0)), 0)
+					FROM output_lines l LEFT JOIN blobs b ON b.hash = l.blob_hash AND l.blob_hash != ''
+					WHERE l.request_id = r.id)
+				+ (SELECT COALESCE(SUM(a.size), 0) FROM request_artifacts a WHERE a.request_id = r.id)
+			FROM requests r
+			WHERE r.status NOT IN ('pending', 'processing')
+			AND (r.id IN (SELECT request_id FROM output_lines) OR r.id IN (SELECT request_id FROM request_artifacts))
+			ORDER BY r.finished_at_ms, r.id`,
+		)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		var freed int64
+		for freed < excess && rows.Next() {
+			var id, size int64
+			if err := rows.Scan(&id, &size); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+			freed += size
+		}
+		return rows.Err()
+	})
+	return ids, err
+}
+
+// deleteOutput deletes the output lines and artifacts of the requests
+// whose ID matches cond, e.g. "IN (...)"
+func (s *Store) deleteOutput(ctx context.Context, report *PruneReport, cond string, args ...any) error {
+	n, err := s.execCount(ctx, "DELETE FROM output_lines WHERE request_id "+cond, args...)
+	if err != nil {
+		return err
+	}
+	report.LinesDeleted += n
+	n, err = s.execCount(ctx, "DELETE FROM request_artifacts WHERE request_id "+cond, args...)
+	if err != nil {
+		return err
+	}
+	report.ArtifactsDeleted += n
+	return nil
+}
+
+// dropOrphanBlobs deletes blobs no output line or artifact refers to
+func (s *Store) dropOrphanBlobs(ctx context.Context, report *PruneReport) error {
+	n, err := s.execCount(
+		ctx,
+		`DELETE FROM blobs
+		WHERE hash NOT IN (SELECT blob_hash FROM output_lines WHERE blob_hash != '')
+		AND hash NOT IN (SELECT blob_hash FROM request_artifacts)`,
+	)
+	if err != nil {
+		return err
+	}
+	report.BlobsDeleted += n
+	return nil
+}
+
+func (s *Store) execCount(ctx context.Context, query string, args ...any) (int64, error) {
+	var res sql.Result
+	err := retry(ctx, func() (err error) {
+		res, err = s.w.ExecContext(ctx, query, args...)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// dbSize returns the size of the main database file in bytes
+func (s *Store) dbSize(ctx context.Context) (int64, error) {
+	row := s.w.QueryRowContext(ctx, "SELECT page_count * page_size FROM pragma_page_count(), pragma_page_size()")
+	var size int64
+	err := row.Scan(&size)
+	return size, err
+}
@@ -0,0 +1,83 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"almono/api"
+)
+
+// TestPruneMaxDBSize checks the size rule empties the oldest finished
+// requests first and gets the file under the limit with a single pass
+func TestPruneMaxDBSize(t *testing.T) {
+	ctx := context.Background()
+	store, err := api.OpenStore(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if err := store.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	const requests = 20
+	// lines are unique so spilled ones do not share blobs
+	content := strings.Repeat("output ", 200)
+	for i := range requests {
+		req, err := store.CreateRequest(ctx, api.NewRequest{Prompt: fmt.Sprintf("request %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := store.ClaimNextPending(ctx); err != nil {
+			t.Fatal(err)
+		}
+		var lines []api.OutputLine
+		for n := 1; n <= 50; n++ {
+			lines = append(lines, api.OutputLine{RequestID: req.ID, LineNum: n, LineType: "message", Content: fmt.Sprintf("%d %d %s", i, n, content)})
+		}
+		if err := store.AddOutputLines(ctx, lines); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.UpdateRequest(ctx, req.ID, api.StatusProcessed, "done"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before, err := store.Prune(ctx, api.RetentionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := before.BytesAfter / 2
+	report, err := store.Prune(ctx, api.RetentionPolicy{MaxDBSize: limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.BytesAfter > limit {
+		t.Errorf("database is %d bytes after pruning, want at most %d", report.BytesAfter, limit)
+	}
+	if report.BytesAfter < limit/2 {
+		t.Errorf("database is %d bytes after pruning to %d; too much was deleted", report.BytesAfter, limit)
+	}
+
+	// output goes oldest first: once a request keeps its lines, all later
+	// ones do too
+	kept := false
+	for id := int64(1); id <= requests; id++ {
+		total, err := store.CountOutputLines(ctx, id, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case total > 0:
+			kept = true
+		case kept:
+			t.Errorf("request %d lost its output after a newer one kept its own", id)
+		}
+	}
+	if !kept {
+		t.Error("every request lost its output")
+	}
+}
@@ -0,0 +1,420 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// what a schedule does with runs it missed while the scheduler was down
+const (
+	// MissedSkip drops missed runs and waits for the next slot
+	MissedSkip = "skip"
+	// MissedOnce runs once for the latest missed slot
+	MissedOnce = "once"
+	// MissedAll runs every missed slot, up to maxCatchUp of them
+	MissedAll = "all"
+)
+
+const (
+	// missedGrace is how late a slot may be picked up and still count as
+	// on time rather than missed
+	missedGrace = 2 * time.Minute
+	// maxCatchUp bounds the runs MissedAll enqueues at once
+	maxCatchUp = 10
+	// maxMissedSlots bounds how many missed slots are counted one by one
+	// before the rest are skipped in a single jump
+	maxMissedSlots = 10000
+)
+
+var (
+	// ErrInvalidSchedule is returned for schedules that cannot run
+	ErrInvalidSchedule = errors.New("invalid schedule")
+	// ErrScheduleNotFound is returned for schedules that do not exist
+	ErrScheduleNotFound = errors.New("schedule not found")
+)
+
+// Schedule enqueues a request from a template prompt on a cron schedule.
+// Slots are computed in the schedule's time zone.
+type Schedule struct {
+	ID       int64    `json:"id"`
+	Name     string   `json:"name"`
+	Cron     string   `json:"cron"`
+	TimeZone string   `json:"time_zone"`
+	Enabled  bool     `json:"enabled"`
+	Prompt   string   `json:"prompt"`
+	Project  string   `json:"project"`
+	Model    string   `json:"model"`
+	Tags     []string `json:"tags"`
+	// Missed is MissedSkip, MissedOnce or MissedAll
+	Missed string `json:"missed"`
+	// NextRunAtMs is the next slot in unix milliseconds, 0 while disabled
+	NextRunAtMs int64 `json:"next_run_at_ms"`
+	// LastRunAtMs is the slot of the latest run enqueued, 0 before the first
+	LastRunAtMs int64 `json:"last_run_at_ms"`
+	// SkippedRuns counts the slots dropped under the missed-run policy
+	SkippedRuns int64  `json:"skipped_runs"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+// NewSchedule describes a schedule to create or the new settings of one;
+// Cron and Prompt are required
+type NewSchedule struct {
+	Name string
+	Cron string
+	// TimeZone is an IANA name such as Europe/Berlin, UTC when empty
+	TimeZone string
+	// Prompt may use {date}, {time}, {datetime}, {weekday} and {name},
+	// filled in with the slot the run is for
+	Prompt  string
+	Project string
+	Model   string
+	Tags    []string
+	// Missed defaults to MissedOnce
+	Missed   string
+	Disabled bool
+}
+
+// Validate checks the cron expression, time zone and policy
+func (ns NewSchedule) Validate() error {
+	if strings.TrimSpace(ns.Prompt) == "" {
+		return fmt.Errorf("%w: prompt is required", ErrInvalidSchedule)
+	}
+	c, err := ParseCron(ns.Cron)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+	}
+	loc, err := time.LoadLocation(ns.zone())
+	if err != nil {
+		return fmt.Errorf("%w: unknown time zone %q", ErrInvalidSchedule, ns.TimeZone)
+	}
+	if c.Next(time.Now().In(loc)).IsZero() {
+		return fmt.Errorf("%w: %q never runs", ErrInvalidSchedule, ns.Cron)
+	}
+	switch ns.missed() {
+	case MissedSkip, MissedOnce, MissedAll:
+	default:
+		return fmt.Errorf("%w: missed must be %s, %s or %s", ErrInvalidSchedule, MissedSkip, MissedOnce, MissedAll)
+	}
+	return nil
+}
+
+func (ns NewSchedule) zone() string {
+	if zone := strings.TrimSpace(ns.TimeZone); zone != "" {
+		return zone
+	}
+	return "UTC"
+}
+
+func (ns NewSchedule) missed() string {
+	if ns.Missed == "" {
+		return MissedOnce
+	}
+	return ns.Missed
+}
+
+// apply copies the settings onto sched and works out its next slot after
+// now; ns must be valid
+func (ns NewSchedule) apply(sched *Schedule, now time.Time) {
+	sched.Name = strings.TrimSpace(ns.Name)
+	sched.Cron = strings.Join(strings.Fields(ns.Cron), " ")
+	sched.TimeZone = ns.zone()
+	sched.Enabled = !ns.Disabled
+	sched.Prompt = ns.Prompt
+	sched.Project = ns.Project
+	sched.Model = ns.Model
+	sched.Tags = NormalizeTags(ns.Tags)
+	sched.Missed = ns.missed()
+	sched.NextRunAtMs = sched.nextAfter(now)
+}
+
+// nextAfter returns the first slot after t in unix milliseconds, or 0 when
+// the schedule is disabled or never runs again
+func (s Schedule) nextAfter(t time.Time) int64 {
+	c, loc, err := s.parse()
+	if err != nil || !s.Enabled {
+		return 0
+	}
+	next := c.Next(t.In(loc))
+	if next.IsZero() {
+		return 0
+	}
+	return next.UnixMilli()
+}
+
+func (s Schedule) parse() (Cron, *time.Location, error) {
+	c, err := ParseCron(s.Cron)
+	if err != nil {
+		return Cron{}, nil, err
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return Cron{}, nil, err
+	}
+	return c, loc, nil
+}
+
+// Location returns the schedule's time zone, UTC if it no longer loads
+func (s Schedule) Location() *time.Location {
+	if loc, err := time.LoadLocation(s.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// Render fills in the prompt's placeholders for the slot at, in the
+// schedule's time zone
+func (s Schedule) Render(at time.Time) string {
+	at = at.In(s.Location())
+	return strings.NewReplacer(
+		"{date}", at.Format("2006-01-02"),
+		"{time}", at.Format("15:04"),
+		"{datetime}", at.Format("2006-01-02 15:04 MST"),
+		"{weekday}", at.Weekday().String(),
+		"{name}", s.Name,
+	).Replace(s.Prompt)
+}
+
+// run is the request a schedule enqueues for the slot at
+func (s Schedule) run(at time.Time) NewRequest {
+	return NewRequest{
+		Prompt:         s.Render(at),
+		Project:        s.Project,
+		Model:          s.Model,
+		Tags:           s.Tags,
+		ScheduleID:     s.ID,
+		ScheduledForMs: at.UnixMilli(),
+	}
+}
+
+// schedulePlan is what firing a due schedule does
+type schedulePlan struct {
+	runs    []NewRequest
+	skipped int
+	next    int64
+}
+
+// plan works out the runs for every slot from NextRunAtMs up to now and
+// the slot after, applying the missed-run policy to the slots that are
+// more than missedGrace late
+func (s Schedule) plan(now time.Time) (schedulePlan, error) {
+	c, loc, err := s.parse()
+	if err != nil {
+		return schedulePlan{}, err
+	}
+	var slots []time.Time
+	var p schedulePlan
+	t := time.UnixMilli(s.NextRunAtMs).In(loc)
+	for !t.IsZero() && !t.After(now) {
+		if len(slots) == maxMissedSlots {
+			// too far behind to count; skip straight to the present
+			p.skipped++
+			t = c.Next(now.In(loc))
+			break
+		}
+		slots = append(slots, t)
+		t = c.Next(t)
+	}
+	if !t.IsZero() {
+		p.next = t.UnixMilli()
+	}
+
+	var run []time.Time
+	switch s.Missed {
+	case MissedAll:
+		run = slots[max(0, len(slots)-maxCatchUp):]
+	case MissedSkip:
+		for _, slot := range slots {
+			if now.Sub(slot) <= missedGrace {
+				run = append(run, slot)
+			}
+		}
+	default:
+		if len(slots) > 0 {
+			run = slots[len(slots)-1:]
+		}
+	}
+	p.skipped += len(slots) - len(run)
+	for _, slot := range run {
+		p.runs = append(p.runs, s.run(slot))
+	}
+	return p, nil
+}
+
+const scheduleColumns = `id, name, cron, time_zone, enabled, prompt, project, model, tags, missed,
+	next_run_at_ms, last_run_at_ms, skipped_runs, created_at, updated_at`
+
+func scanSchedule(row rowScanner) (Schedule, error) {
+	var s Schedule
+	var tags string
+	err := row.Scan(
+		&s.ID, &s.Name, &s.Cron, &s.TimeZone, &s.Enabled, &s.Prompt, &s.Project, &s.Model, &tags, &s.Missed,
+		&s.NextRunAtMs, &s.LastRunAtMs, &s.SkippedRuns, &s.CreatedAt, &s.UpdatedAt,
+	)
+	s.Tags = splitLines(tags)
+	return s, err
+}
+
+func (s *Store) CreateSchedule(ctx context.Context, sched Schedule) (Schedule, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	sched.CreatedAt, sched.UpdatedAt = now, now
+	err := retry(ctx, func() error {
+		res, err := s.w.ExecContext(
+			ctx,
+			`INSERT INTO schedules (name, cron, time_zone, enabled, prompt, project, model, tags, missed,
+				next_run_at_ms, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			sched.Name, sched.Cron, sched.TimeZone, sched.Enabled, sched.Prompt, sched.Project, sched.Model,
+			strings.Join(sched.Tags, "\n"), sched.Missed, sched.NextRunAtMs, now, now,
+		)
+		if err != nil {
+			return err
+		}
+		sched.ID, err = res.LastInsertId()
+		return err
+	})
+	if err != nil {
+		return Schedule{}, err
+	}
+	return sched, nil
+}
+
+// UpdateSchedule saves a schedule's settings and next slot, leaving its run
+// history alone
+func (s *Store) UpdateSchedule(ctx context.Context, sched Schedule) (bool, error) {
+	var n int64
+	err := retry(ctx, func() error {
+		res, err := s.w.ExecContext(
+			ctx,
+			`UPDATE schedules SET name = ?, cron = ?, time_zone = ?, enabled = ?, prompt = ?, project = ?,
+				model = ?, tags = ?, missed = ?, next_run_at_ms = ?, updated_at = ?
+			WHERE id = ?`,
+			sched.Name, sched.Cron, sched.TimeZone, sched.Enabled, sched.Prompt, sched.Project,
+			sched.Model, strings.Join(sched.Tags, "\n"), sched.Missed, sched.NextRunAtMs,
+			time.Now().UTC().Format(time.RFC3339), sched.ID,
+		)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n > 0, err
+}
+
+// DeleteSchedule removes a schedule; the requests it enqueued stay
+func (s *Store) DeleteSchedule(ctx context.Context, id int64) (bool, error) {
+	var n int64
+	err := retry(ctx, func() error {
+		res, err := s.w.ExecContext(ctx, "DELETE FROM schedules WHERE id = ?", id)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n > 0, err
+}
+
+func (s *Store) GetSchedule(ctx context.Context, id int64) (Schedule, bool, error) {
+	sched, err := scanSchedule(s.db.QueryRowContext(ctx, "SELECT "+scheduleColumns+" FROM schedules WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return Schedule{}, false, nil
+	}
+	if err != nil {
+		return Schedule{}, false, err
+	}
+	return sched, true, nil
+}
+
+// ListSchedules returns every schedule, oldest first
+func (s *Store) ListSchedules(ctx context.Context) ([]Schedule, error) {
+	return s.querySchedules(ctx, "SELECT "+scheduleColumns+" FROM schedules ORDER BY id")
+}
+
+// DueSchedules returns the enabled schedules whose next slot is at or
+// before nowMs
+func (s *Store) DueSchedules(ctx context.Context, nowMs int64) ([]Schedule, error) {
+	return s.querySchedules(
+		ctx,
+		`SELECT `+scheduleColumns+` FROM schedules
+		WHERE enabled = 1 AND next_run_at_ms > 0 AND next_run_at_ms <= ?
+		ORDER BY next_run_at_ms, id`,
+		nowMs,
+	)
+}
+
+func (s *Store) querySchedules(ctx context.Context, query string, args ...any) ([]Schedule, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	schedules := []Schedule{}
+	for rows.Next() {
+		sched, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, sched)
+	}
+	return schedules, rows.Err()
+}
+
+// FireSchedule moves a due schedule on from the slot due to next and
+// enqueues runs, all in one transaction. It does nothing and reports false
+// when the schedule is no longer enabled at due, because another scheduler
+// fired it first or it was edited meanwhile.
+func (s *Store) FireSchedule(ctx context.Context, id, due, next int64, skipped int, runs []NewRequest) ([]Request, bool, error) {
+	var reqs []Request
+	var fired bool
+	err := retry(ctx, func() error {
+		reqs, fired = nil, false
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		now := time.Now().UTC()
+		res, err := tx.ExecContext(
+			ctx,
+			`UPDATE schedules SET next_run_at_ms = ?, skipped_runs = skipped_runs + ?,
+				last_run_at_ms = CASE WHEN ? > 0 THEN ? ELSE last_run_at_ms END
+			WHERE id = ? AND enabled = 1 AND next_run_at_ms = ?`,
+			next, skipped, len(runs), lastSlot(runs), id, due,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		for _, nr := range runs {
+			req, err := insertRequest(ctx, tx, nr, now, 0, "")
+			if err != nil {
+				return err
+			}
+			reqs = append(reqs, req)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		fired = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return reqs, fired, nil
+}
+
+func lastSlot(runs []NewRequest) int64 {
+	if len(runs) == 0 {
+		return 0
+	}
+	return runs[len(runs)-1].ScheduledForMs
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSchedulePlan(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(s string) time.Time {
+		t.Helper()
+		v, err := time.ParseInLocation("2006-01-02 15:04:05", s, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	every := func(step time.Duration, from time.Time, n int) []time.Time {
+		var slots []time.Time
+		for i := range n {
+			slots = append(slots, from.Add(time.Duration(i)*step))
+		}
+		return slots
+	}
+	hours := func(from string, n int) []time.Time { return every(time.Hour, at(from), n) }
+	// a schedule too far behind counts maxMissedSlots minutes from here
+	behind := at("2026-03-01 00:00:00")
+
+	tests := []struct {
+		name    string
+		cron    string
+		missed  string
+		nextRun time.Time
+		now     time.Time
+		runs    []time.Time
+		skipped int
+		next    time.Time
+	}{
+		{"on time", "0 * * * *", MissedOnce, at("2026-03-10 12:00:00"), at("2026-03-10 12:00:30"),
+			hours("2026-03-10 12:00:00", 1), 0, at("2026-03-10 13:00:00")},
+		{"not due", "0 * * * *", MissedOnce, at("2026-03-10 13:00:00"), at("2026-03-10 12:00:30"),
+			nil, 0, at("2026-03-10 13:00:00")},
+		{"once runs the latest", "0 * * * *", MissedOnce, at("2026-03-10 09:00:00"), at("2026-03-10 12:00:30"),
+			hours("2026-03-10 12:00:00", 1), 3, at("2026-03-10 13:00:00")},
+		{"all runs every slot", "0 * * * *", MissedAll, at("2026-03-10 10:00:00"), at("2026-03-10 12:00:30"),
+			hours("2026-03-10 10:00:00", 3), 0, at("2026-03-10 13:00:00")},
+		{"all runs the latest maxCatchUp", "0 * * * *", MissedAll, at("2026-03-09 22:00:00"), at("2026-03-10 12:00:30"),
+			hours("2026-03-10 03:00:00", maxCatchUp), 5, at("2026-03-10 13:00:00")},
+		{"skip runs a slot within the grace", "0 * * * *", MissedSkip, at("2026-03-10 10:00:00"), at("2026-03-10 12:01:30"),
+			hours("2026-03-10 12:00:00", 1), 2, at("2026-03-10 13:00:00")},
+		{"skip runs a slot exactly at the grace", "0 * * * *", MissedSkip, at("2026-03-10 12:00:00"), at("2026-03-10 12:02:00"),
+			hours("2026-03-10 12:00:00", 1), 0, at("2026-03-10 13:00:00")},
+		{"skip drops late slots", "0 * * * *", MissedSkip, at("2026-03-10 10:00:00"), at("2026-03-10 12:05:00"),
+			nil, 3, at("2026-03-10 13:00:00")},
+		// clocks go forward on 2026-03-29, so there is no 02:30 that day
+		{"all across the gap", "30 2 * * *", MissedAll, at("2026-03-28 02:30:00"), at("2026-03-30 03:00:00"),
+			[]time.Time{at("2026-03-28 02:30:00"), at("2026-03-30 02:30:00")}, 0, at("2026-03-31 02:30:00")},
+		{"once too far behind to count", "* * * * *", MissedOnce, behind, at("2026-03-10 12:00:30"),
+			every(time.Minute, behind.Add((maxMissedSlots-1)*time.Minute), 1), maxMissedSlots, at("2026-03-10 12:01:00")},
+		{"all too far behind to count", "* * * * *", MissedAll, behind, at("2026-03-10 12:00:30"),
+			every(time.Minute, behind.Add((maxMissedSlots-maxCatchUp)*time.Minute), maxCatchUp), maxMissedSlots - maxCatchUp + 1, at("2026-03-10 12:01:00")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Schedule{ID: 1, Cron: tt.cron, TimeZone: "Europe/Berlin", Enabled: true, Missed: tt.missed, NextRunAtMs: tt.nextRun.UnixMilli()}
+			p, err := s.plan(tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var runs []time.Time
+			for _, run := range p.runs {
+				runs = append(runs, time.UnixMilli(run.ScheduledForMs).In(berlin))
+				if run.ScheduleID != s.ID {
+					t.Errorf("run %+v is not for the schedule", run)
+				}
+			}
+			if !slices.EqualFunc(runs, tt.runs, time.Time.Equal) {
+				t.Errorf("runs for %v, want %v", runs, tt.runs)
+			}
+			if p.skipped != tt.skipped {
+				t.Errorf("skipped %d, want %d", p.skipped, tt.skipped)
+			}
+			if p.next != tt.next.UnixMilli() {
+				t.Errorf("next slot is %v, want %v", time.UnixMilli(p.next).In(berlin), tt.next)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"html"
+	"strings"
+)
+
+const (
+	// markStart and markEnd bracket matched terms in raw snippets; they
+	// are private-use runes so they survive HTML escaping unchanged
+	markStart = "\ue000"
+	markEnd   = "\ue001"
+	// snippetTokens is roughly how many words a snippet shows
+	snippetTokens = 16
+)
+
+// SearchHit is one prompt or output line matching a search. Snippet is
+// HTML: the matched text is escaped and terms are wrapped in <mark>.
+type SearchHit struct {
+	RequestID int64 `json:"request_id"`
+	// LineNum is 0 when the prompt matched
+	LineNum int `json:"line_num"`
+	// LineType is "prompt" or the type of the matching output line
+	LineType  string `json:"line_type"`
+	Snippet   string `json:"snippet"`
+	URL       string `json:"url"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Search returns prompts and output lines matching every term in query,
+// best matches first. Spilled lines are matched on their preview only.
+func (s *Store) Search(ctx context.Context, query string, offset, limit int) ([]SearchHit, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return []SearchHit{}, nil
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT request_id, line_num, line_type, snip, created_at FROM (
+			SELECT r.id AS request_id, 0 AS line_num, 'prompt' AS line_type,
+				snippet(requests_fts, 0, ?, ?, '…', ?) AS snip,
+				r.created_at AS created_at, bm25(requests_fts) AS rank
+			FROM requests_fts JOIN requests r ON r.id = requests_fts.rowid
+			WHERE requests_fts MATCH ?
+			UNION ALL
+			SELECT l.request_id, l.line_num, l.line_type,
+				snippet(output_lines_fts, 0, ?, ?, '…', ?),
+				l.created_at, bm25(output_lines_fts)
+			FROM output_lines_fts JOIN output_lines l ON l.id = output_lines_fts.rowid
+			WHERE output_lines_fts MATCH ?
+		)
+		ORDER BY rank, request_id DESC, line_num
+		LIMIT ? OFFSET ?`,
+		markStart, markEnd, snippetTokens, match,
+		markStart, markEnd, snippetTokens, match,
+		limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hits := []SearchHit{}
+	for rows.Next() {
+		var hit SearchHit
+		if err := rows.Scan(&hit.RequestID, &hit.LineNum, &hit.LineType, &hit.Snippet, &hit.CreatedAt); err != nil {
+			return nil, err
+		}
+		hit.Snippet = highlight(hit.Snippet)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// ftsQuery turns free text into an FTS5 query matching every word, quoting
+// each one so punctuation in user input is never parsed as syntax
+func ftsQuery(query string) string {
+	terms := strings.Fields(query)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
+
+// highlight escapes a raw snippet and turns its markers into <mark> tags
+func highlight(raw string) string {
+	escaped := html.EscapeString(raw)
+	escaped = strings.ReplaceAll(escaped, markStart, "<mark>")
+	return strings.ReplaceAll(escaped, markEnd, "</mark>")
+}
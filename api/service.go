@@ -1,54 +1,418 @@
 package api
 
-import "context"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
 
 type Service struct {
-	store *Store
+	store    RequestStore
+	notifier Notifier
+	branches Branches
+	// branchMu serialises merges and discards
+	branchMu  sync.Mutex
+	snapshots Snapshots
+	// followMu keeps threads linear by serialising follow-ups
+	followMu sync.Mutex
 }
 
+// Notifier is told whenever a new request is enqueued
+type Notifier interface {
+	Notify()
+}
+
+// Branches does the git side of finishing a request branch. Merge returns
+// the merge commit.
+type Branches interface {
+	Merge(ctx context.Context, b RequestBranch, target string) (string, error)
+	Discard(ctx context.Context, b RequestBranch) error
+}
+
+// Snapshots restores a workdir from the snapshot taken before a request
+type Snapshots interface {
+	Restore(ctx context.Context, snap RequestSnapshot) error
+}
+
+var (
+	// ErrBranchNotOpen is returned for requests without an open branch
+	ErrBranchNotOpen = errors.New("request has no open branch")
+	// ErrNoMergeTarget is returned when neither the caller nor the branch
+	// names a target
+	ErrNoMergeTarget = errors.New("no merge target")
+	// ErrBranchGit is returned when git refused a merge or discard; the
+	// reason is recorded in the branch's Error
+	ErrBranchGit = errors.New("git failed")
+	// ErrNoSnapshot is returned for requests without a snapshot to roll
+	// back to
+	ErrNoSnapshot = errors.New("request has no snapshot")
+	// ErrWorkdirBusy is returned when a rollback would overwrite the
+	// workdir of a request that is still running, or another rollback
+	// holds it
+	ErrWorkdirBusy = errors.New("the workdir is in use")
+	// ErrRestore is returned when the snapshot could not be restored; the
+	// reason is recorded in the request's history
+	ErrRestore = errors.New("restore failed")
+	// ErrNotFound is returned for requests that do not exist
+	ErrNotFound = errors.New("request not found")
+	// ErrNotFinished is returned for follow-ups to a request that is
+	// still pending or running
+	ErrNotFinished = errors.New("request has not finished")
+	// ErrNoSession is returned for follow-ups to a request whose run never
+	// reported a codex session
+	ErrNoSession = errors.New("request has no codex session to resume")
+	// ErrHasFollowUp is returned for follow-ups to a request that is not
+	// the latest of its thread
+	ErrHasFollowUp = errors.New("request already has a follow-up")
+)
+
+// Page is one page of the request list. Next and Prev are cursors for the
+// neighbouring pages, 0 at either end: pass Next as Cursor.After and Prev
+// as Cursor.Before.
 type Page struct {
 	Requests []Request
 	Page     int
-	Pages    int
-	Total    int
+	Next     int64
+	Prev     int64
+	// Links are up to pageLinks numbered pages around this one, this one
+	// included, each with the cursor that reaches it
+	Links []PageLink
+}
+
+// PageLink is a numbered page of the request list. The first page and
+// the current one need no cursor, so both After and Before are 0.
+type PageLink struct {
+	Page   int
+	After  int64
+	Before int64
 }
 
-func NewService(store *Store) *Service {
+// pageLinks is how many numbered pages a Page links to
+const pageLinks = 5
+
+// rollbackLease is how long the workdir lock outlives a rollback whose
+// process died holding it. It does not limit the restore itself, and is
+// far longer than restoring the largest snapshot takes.
+const rollbackLease = time.Hour
+
+func NewService(store RequestStore) *Service {
 	return &Service{store: store}
 }
 
-func (s *Service) CreateRequest(ctx context.Context, prompt string) (Request, error) {
-	return s.store.CreateRequest(ctx, prompt)
+// SetBranches enables merging and discarding request branches
+func (s *Service) SetBranches(b Branches) {
+	s.branches = b
+}
+
+// SetSnapshots enables rolling workdirs back to request snapshots
+func (s *Service) SetSnapshots(snaps Snapshots) {
+	s.snapshots = snaps
+}
+
+// SetNotifier registers n to be woken after every successful CreateRequest
+func (s *Service) SetNotifier(n Notifier) {
+	s.notifier = n
+}
+
+func (s *Service) CreateRequest(ctx context.Context, nr NewRequest) (Request, error) {
+	req, err := s.store.CreateRequest(ctx, nr)
+	if err == nil && s.notifier != nil {
+		s.notifier.Notify()
+	}
+	return req, err
 }
 
-func (s *Service) ListRequests(ctx context.Context, page, pageSize int) (Page, error) {
+// FollowUp enqueues nr as the next turn of parentID's thread, resuming its
+// codex session. Only the latest request of a thread can be followed up,
+// once it has finished. Project and tags default to the parent's, and the
+// model to the one it ran with.
+func (s *Service) FollowUp(ctx context.Context, parentID int64, nr NewRequest) (Request, error) {
+	s.followMu.Lock()
+	defer s.followMu.Unlock()
+	parent, ok, err := s.store.GetRequest(ctx, parentID)
+	if err != nil {
+		return Request{}, err
+	}
+	if !ok {
+		return Request{}, ErrNotFound
+	}
+	thread, err := s.store.GetThread(ctx, parent.ThreadID)
+	if err != nil {
+		return parent, err
+	}
+	if err := CheckFollowUp(parent, thread); err != nil {
+		return parent, err
+	}
+	nr.ParentID = parent.ID
+	if nr.Project == "" {
+		nr.Project = parent.Project
+	}
+	if nr.Model == "" {
+		nr.Model = parent.Model
+	}
+	if len(nr.Tags) == 0 {
+		nr.Tags = parent.Tags
+	}
+	return s.CreateRequest(ctx, nr)
+}
+
+// CheckFollowUp returns why parent cannot be followed up, given the
+// requests of its thread, or nil if it can
+func CheckFollowUp(parent Request, thread []Request) error {
+	switch {
+	case !parent.Finished():
+		return ErrNotFinished
+	case parent.SessionID == "":
+		return ErrNoSession
+	case len(thread) > 0 && thread[len(thread)-1].ID != parent.ID:
+		return ErrHasFollowUp
+	}
+	return nil
+}
+
+// GetThread returns the requests of the thread id belongs to, oldest
+// first
+func (s *Service) GetThread(ctx context.Context, id int64) ([]Request, bool, error) {
+	req, ok, err := s.store.GetRequest(ctx, id)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	thread, err := s.store.GetThread(ctx, req.ThreadID)
+	return thread, true, err
+}
+
+// CreatePipeline enqueues the steps of np. Steps that do not form a graph
+// that can run return an error wrapping ErrInvalidPipeline.
+func (s *Service) CreatePipeline(ctx context.Context, np NewPipeline) (Pipeline, error) {
+	p, err := s.store.CreatePipeline(ctx, np)
+	if err == nil && s.notifier != nil {
+		s.notifier.Notify()
+	}
+	return p, err
+}
+
+func (s *Service) GetPipeline(ctx context.Context, id int64) (Pipeline, bool, error) {
+	return s.store.GetPipeline(ctx, id)
+}
+
+// PipelinesPage is one page of pipelines, newest first
+type PipelinesPage struct {
+	Pipelines []Pipeline `json:"pipelines"`
+	Page      int        `json:"page"`
+	More      bool       `json:"more"`
+}
+
+func (s *Service) ListPipelines(ctx context.Context, page, pageSize int) (PipelinesPage, error) {
 	if page < 1 {
 		page = 1
 	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	// one extra pipeline tells whether another page exists
+	pipelines, err := s.store.ListPipelines(ctx, (page-1)*pageSize, pageSize+1)
+	if err != nil {
+		return PipelinesPage{}, err
+	}
+	result := PipelinesPage{Page: page}
+	if len(pipelines) > pageSize {
+		pipelines, result.More = pipelines[:pageSize], true
+	}
+	result.Pipelines = pipelines
+	return result, nil
+}
+
+// CreateSchedule adds a schedule; settings that cannot run return an
+// error wrapping ErrInvalidSchedule
+func (s *Service) CreateSchedule(ctx context.Context, ns NewSchedule) (Schedule, error) {
+	if err := ns.Validate(); err != nil {
+		return Schedule{}, err
+	}
+	var sched Schedule
+	ns.apply(&sched, time.Now())
+	return s.store.CreateSchedule(ctx, sched)
+}
+
+// UpdateSchedule replaces a schedule's settings. The next slot is worked
+// out afresh from now, so runs missed under the old settings are dropped.
+func (s *Service) UpdateSchedule(ctx context.Context, id int64, ns NewSchedule) (Schedule, error) {
+	if err := ns.Validate(); err != nil {
+		return Schedule{}, err
+	}
+	return s.updateSchedule(ctx, id, func(sched *Schedule) {
+		ns.apply(sched, time.Now())
+	})
+}
+
+// SetScheduleEnabled turns a schedule on or off. A schedule turned back on
+// waits for its next slot rather than catching up.
+func (s *Service) SetScheduleEnabled(ctx context.Context, id int64, enabled bool) (Schedule, error) {
+	return s.updateSchedule(ctx, id, func(sched *Schedule) {
+		sched.Enabled = enabled
+		sched.NextRunAtMs = sched.nextAfter(time.Now())
+	})
+}
+
+func (s *Service) updateSchedule(ctx context.Context, id int64, fn func(sched *Schedule)) (Schedule, error) {
+	sched, ok, err := s.store.GetSchedule(ctx, id)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if !ok {
+		return Schedule{}, ErrScheduleNotFound
+	}
+	fn(&sched)
+	if ok, err = s.store.UpdateSchedule(ctx, sched); err != nil {
+		return Schedule{}, err
+	}
+	if !ok {
+		return Schedule{}, ErrScheduleNotFound
+	}
+	sched, _, err = s.store.GetSchedule(ctx, id)
+	return sched, err
+}
+
+func (s *Service) DeleteSchedule(ctx context.Context, id int64) (bool, error) {
+	return s.store.DeleteSchedule(ctx, id)
+}
+
+func (s *Service) GetSchedule(ctx context.Context, id int64) (Schedule, bool, error) {
+	return s.store.GetSchedule(ctx, id)
+}
+
+func (s *Service) ListSchedules(ctx context.Context) ([]Schedule, error) {
+	return s.store.ListSchedules(ctx)
+}
+
+// RunSchedule enqueues a run of a schedule now, outside its cron slots
+func (s *Service) RunSchedule(ctx context.Context, id int64) (Request, error) {
+	sched, ok, err := s.store.GetSchedule(ctx, id)
+	if err != nil {
+		return Request{}, err
+	}
+	if !ok {
+		return Request{}, ErrScheduleNotFound
+	}
+	return s.CreateRequest(ctx, sched.run(time.Now().Truncate(time.Minute)))
+}
+
+// RunDueSchedules enqueues the runs of every schedule due by now, applying
+// each one's missed-run policy, and returns how many it enqueued. A
+// schedule another scheduler fired first is left alone.
+func (s *Service) RunDueSchedules(ctx context.Context, now time.Time) (int, error) {
+	due, err := s.store.DueSchedules(ctx, now.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	enqueued := 0
+	var errs []error
+	for _, sched := range due {
+		plan, err := sched.plan(now)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule %d: %w", sched.ID, err))
+			continue
+		}
+		reqs, _, err := s.store.FireSchedule(ctx, sched.ID, sched.NextRunAtMs, plan.next, plan.skipped, plan.runs)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("schedule %d: %w", sched.ID, err))
+			continue
+		}
+		enqueued += len(reqs)
+	}
+	if enqueued > 0 && s.notifier != nil {
+		s.notifier.Notify()
+	}
+	return enqueued, errors.Join(errs...)
+}
+
+// ListRequests returns one page of the requests matching q from the
+// position cur. page is the number the caller showed for the page the
+// cursor leads to; it is corrected when the start of the list is near
+// enough to count. Nothing is counted or skipped by offset, so deep pages
+// cost the same as the first.
+func (s *Service) ListRequests(ctx context.Context, q ListQuery, cur Cursor, page, pageSize int) (Page, error) {
 	if pageSize < 1 {
 		pageSize = 10
 	}
-	offset := (page - 1) * pageSize
-	items, total, err := s.store.ListRequests(ctx, offset, pageSize)
+	keyset := cur.After != 0 || cur.Before != 0
+	if !keyset || page < 1 {
+		page = 1
+	}
+	// one extra request tells whether the page has a neighbour beyond it
+	items, err := s.store.ListRequests(ctx, q, cur, pageSize+1)
 	if err != nil {
 		return Page{}, err
 	}
-	pages := total / pageSize
-	if total%pageSize != 0 {
-		pages++
+	more := len(items) > pageSize
+	backward := cur.Before != 0 && cur.After == 0
+	if keyset && (len(items) == 0 || (backward && !more && len(items) < pageSize)) {
+		// the cursor request is gone, or requests were added since the
+		// link was made and the first page would come up short
+		return s.ListRequests(ctx, q, Cursor{}, 1, pageSize)
 	}
-	if pages < 1 {
-		pages = 1
+	if len(items) == 0 {
+		return Page{Requests: items, Page: 1, Links: []PageLink{{Page: 1}}}, nil
 	}
-	if page > pages {
-		page = pages
-		offset = (page - 1) * pageSize
-		items, _, err = s.store.ListRequests(ctx, offset, pageSize)
-		if err != nil {
+	if more {
+		if backward {
+			items = items[1:]
+		} else {
+			items = items[:pageSize]
+		}
+	}
+	first, last := items[0].ID, items[len(items)-1].ID
+
+	// the ids of the pages on either side give their cursors, and near
+	// the start of the list the real number of this one
+	span := pageSize * (pageLinks - 1)
+	var before, after []int64
+	if keyset && (!backward || more) {
+		if before, err = s.store.ListRequestIDs(ctx, q, Cursor{Before: first}, span); err != nil {
 			return Page{}, err
 		}
 	}
-	return Page{Requests: items, Page: page, Pages: pages, Total: total}, nil
+	if more || backward {
+		if after, err = s.store.ListRequestIDs(ctx, q, Cursor{After: last}, span); err != nil {
+			return Page{}, err
+		}
+	}
+	pagesBefore := (len(before) + pageSize - 1) / pageSize
+	pagesAfter := (len(after) + pageSize - 1) / pageSize
+	if len(before) < span {
+		page = pagesBefore + 1
+	} else {
+		page = max(page, pagesBefore+1)
+	}
+
+	result := Page{Requests: items, Page: page}
+	if page > 1 {
+		result.Prev = first
+	}
+	if len(after) > 0 {
+		result.Next = last
+	}
+	start := max(page-pagesBefore, page-pageLinks/2)
+	end := min(page+pagesAfter, start+pageLinks-1)
+	start = max(page-pagesBefore, end-pageLinks+1)
+	for n := start; n <= end; n++ {
+		link := PageLink{Page: n}
+		switch {
+		case n == 1 || n == page:
+		case n == page-1:
+			link.Before = first
+		case n < page:
+			link.Before = before[len(before)-(page-n-1)*pageSize]
+		case n == page+1:
+			link.After = last
+		default:
+			link.After = after[(n-page-1)*pageSize-1]
+		}
+		result.Links = append(result.Links, link)
+	}
+	return result, nil
 }
 
 func (s *Service) GetProcessingRequest(ctx context.Context) (Request, bool, error) {
@@ -59,6 +423,256 @@ func (s *Service) GetRequest(ctx context.Context, id int64) (Request, bool, erro
 	return s.store.GetRequest(ctx, id)
 }
 
-func (s *Service) GetOutputLines(ctx context.Context, requestID int64, limit, offset int) ([]OutputLine, int, error) {
+func (s *Service) GetOutputLines(ctx context.Context, requestID int64, limit, offset int) ([]OutputLine, error) {
 	return s.store.GetOutputLines(ctx, requestID, limit, offset)
 }
+
+func (s *Service) CountOutputLines(ctx context.Context, requestID int64, before int) (int, error) {
+	return s.store.CountOutputLines(ctx, requestID, before)
+}
+
+func (s *Service) GetLatestOutputLine(ctx context.Context, requestID int64, lineType string) (OutputLine, bool, error) {
+	return s.store.GetLatestOutputLine(ctx, requestID, lineType)
+}
+
+// GetPlan returns the latest state of the todo list codex keeps during a
+// run, or nil if it never made one
+func (s *Service) GetPlan(ctx context.Context, requestID int64) ([]TodoItem, error) {
+	line, ok, err := s.store.GetLatestOutputLine(ctx, requestID, LineTodoList)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return ParseTodoList(line.Content), nil
+}
+
+func (s *Service) CancelRequest(ctx context.Context, id int64) (bool, error) {
+	return s.store.CancelRequest(ctx, id)
+}
+
+func (s *Service) GetOutputLinesAfter(ctx context.Context, requestID int64, after, limit int) ([]OutputLine, error) {
+	return s.store.GetOutputLinesAfter(ctx, requestID, after, limit)
+}
+
+// GetFullOutput returns a line's complete content, reading spilled output
+// back from the blob store
+func (s *Service) GetFullOutput(ctx context.Context, requestID int64, lineNum int) (string, bool, error) {
+	line, ok, err := s.store.GetOutputLine(ctx, requestID, lineNum)
+	if err != nil || !ok {
+		return "", ok, err
+	}
+	if !line.Truncated() {
+		return line.Content, true, nil
+	}
+	data, ok, err := s.store.GetBlob(ctx, line.BlobHash)
+	if err != nil || !ok {
+		return "", ok, err
+	}
+	return string(data), true, nil
+}
+
+// Prune deletes output according to policy and reports what was freed
+func (s *Service) Prune(ctx context.Context, policy RetentionPolicy) (PruneReport, error) {
+	return s.store.Prune(ctx, policy)
+}
+
+// SearchPage is one page of search results
+type SearchPage struct {
+	Query string      `json:"query"`
+	Hits  []SearchHit `json:"hits"`
+	Page  int         `json:"page"`
+	More  bool        `json:"more"`
+}
+
+// Search finds prompts and output lines matching query. Each hit links to
+// the request page for prompts, or to the transcript line otherwise.
+func (s *Service) Search(ctx context.Context, query string, page, pageSize int) (SearchPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	// one extra hit tells whether another page exists
+	hits, err := s.store.Search(ctx, query, (page-1)*pageSize, pageSize+1)
+	if err != nil {
+		return SearchPage{}, err
+	}
+	result := SearchPage{Query: query, Page: page}
+	if len(hits) > pageSize {
+		hits, result.More = hits[:pageSize], true
+	}
+	for i, hit := range hits {
+		hits[i].URL = "/requests/" + strconv.FormatInt(hit.RequestID, 10)
+		if hit.LineNum > 0 {
+			hits[i].URL += "/transcript?line=" + strconv.Itoa(hit.LineNum) + "#line-" + strconv.Itoa(hit.LineNum)
+		}
+	}
+	result.Hits = hits
+	return result, nil
+}
+
+// FilesPage is one page of the requests that changed a file
+type FilesPage struct {
+	Path  string      `json:"path"`
+	Files []FileTouch `json:"files"`
+	Page  int         `json:"page"`
+	More  bool        `json:"more"`
+}
+
+// FilesTouched lists the requests that changed path, newest first
+func (s *Service) FilesTouched(ctx context.Context, path string, page, pageSize int) (FilesPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 20
+	}
+	// one extra file tells whether another page exists
+	files, err := s.store.FilesTouched(ctx, path, (page-1)*pageSize, pageSize+1)
+	if err != nil {
+		return FilesPage{}, err
+	}
+	result := FilesPage{Path: path, Page: page}
+	if len(files) > pageSize {
+		files, result.More = files[:pageSize], true
+	}
+	result.Files = files
+	return result, nil
+}
+
+func (s *Service) GetRequestFiles(ctx context.Context, requestID int64) ([]RequestFile, error) {
+	return s.store.GetRequestFiles(ctx, requestID)
+}
+
+// GetDiff returns the workspace diff recorded for a request
+func (s *Service) GetDiff(ctx context.Context, requestID int64) (Artifact, string, bool, error) {
+	a, content, ok, err := s.store.GetArtifact(ctx, requestID, ArtifactDiff)
+	return a, string(content), ok, err
+}
+
+func (s *Service) ListArtifacts(ctx context.Context, requestID int64) ([]Artifact, error) {
+	return s.store.ListArtifacts(ctx, requestID)
+}
+
+func (s *Service) GetBranch(ctx context.Context, requestID int64) (RequestBranch, bool, error) {
+	return s.store.GetBranch(ctx, requestID)
+}
+
+// MergeBranch merges a request's open branch into target, or into the
+// branch it was created from when target is empty
+func (s *Service) MergeBranch(ctx context.Context, requestID int64, target string) (RequestBranch, error) {
+	return s.finishBranch(ctx, requestID, func(b *RequestBranch) error {
+		if target == "" {
+			target = b.Target
+		}
+		if target == "" {
+			return ErrNoMergeTarget
+		}
+		sha, err := s.branches.Merge(ctx, *b, target)
+		if err != nil {
+			return err
+		}
+		b.State, b.Target, b.MergeSHA = BranchMerged, target, sha
+		return nil
+	})
+}
+
+// DiscardBranch deletes a request's open branch without merging it
+func (s *Service) DiscardBranch(ctx context.Context, requestID int64) (RequestBranch, error) {
+	return s.finishBranch(ctx, requestID, func(b *RequestBranch) error {
+		if err := s.branches.Discard(ctx, *b); err != nil {
+			return err
+		}
+		b.State = BranchDiscarded
+		return nil
+	})
+}
+
+// finishBranch applies fn to an open branch and records the outcome. A
+// git failure is kept on the branch and returned as ErrBranchGit.
+func (s *Service) finishBranch(ctx context.Context, requestID int64, fn func(b *RequestBranch) error) (RequestBranch, error) {
+	s.branchMu.Lock()
+	defer s.branchMu.Unlock()
+	b, ok, err := s.store.GetBranch(ctx, requestID)
+	if err != nil {
+		return b, err
+	}
+	if !ok || b.State != BranchOpen || s.branches == nil {
+		return b, ErrBranchNotOpen
+	}
+	if err := fn(&b); errors.Is(err, ErrNoMergeTarget) {
+		return b, err
+	} else if err != nil {
+		b.Error = err.Error()
+		if err := s.store.SaveBranch(ctx, b); err != nil {
+			return b, err
+		}
+		return b, fmt.Errorf("%w: %v", ErrBranchGit, err)
+	}
+	b.Error = ""
+	if err := s.store.SaveBranch(ctx, b); err != nil {
+		return b, err
+	}
+	event := RequestEvent{RequestID: requestID, Kind: EventBranchDiscarded, Message: "Branch " + b.Branch + " discarded"}
+	if b.State == BranchMerged {
+		event.Kind, event.Message = EventBranchMerged, "Branch "+b.Branch+" merged into "+b.Target
+	}
+	if err := s.store.AddEvent(ctx, event); err != nil {
+		return b, err
+	}
+	b, _, err = s.store.GetBranch(ctx, requestID)
+	return b, err
+}
+
+func (s *Service) GetSnapshot(ctx context.Context, requestID int64) (RequestSnapshot, bool, error) {
+	return s.store.GetSnapshot(ctx, requestID)
+}
+
+func (s *Service) ListEvents(ctx context.Context, requestID int64) ([]RequestEvent, error) {
+	return s.store.ListEvents(ctx, requestID)
+}
+
+// Rollback restores the workdir to the snapshot taken before a request
+// ran, undoing that request and every later one, and records it in the
+// request's history. It is refused while any request is running or
+// another rollback is under way, and no request starts until it is done.
+func (s *Service) Rollback(ctx context.Context, requestID int64) (snap RequestSnapshot, err error) {
+	snap, ok, err := s.store.GetSnapshot(ctx, requestID)
+	if err != nil {
+		return snap, err
+	}
+	if !ok || s.snapshots == nil {
+		return snap, ErrNoSnapshot
+	}
+	// the lock expires only in case this process dies holding it
+	until := time.Now().Add(rollbackLease)
+	if locked, err := s.store.LockWorkdir(ctx, requestID, until.UnixMilli()); err != nil {
+		return snap, err
+	} else if !locked {
+		return snap, ErrWorkdirBusy
+	}
+	// a restore stopped halfway leaves the workdir worse off than before,
+	// so from here on the rollback runs to the end and is recorded even
+	// if the caller goes away
+	ctx = context.WithoutCancel(ctx)
+	defer func() {
+		err = errors.Join(err, s.store.UnlockWorkdir(ctx, requestID))
+	}()
+	if err := s.snapshots.Restore(ctx, snap); err != nil {
+		event := RequestEvent{RequestID: requestID, Kind: EventRollbackFailed, Message: "Rollback failed: " + err.Error()}
+		if err := s.store.AddEvent(ctx, event); err != nil {
+			return snap, err
+		}
+		return snap, fmt.Errorf("%w: %v", ErrRestore, err)
+	}
+	snap.RestoredAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.store.SaveSnapshot(ctx, snap); err != nil {
+		return snap, err
+	}
+	event := RequestEvent{RequestID: requestID, Kind: EventRollback, Message: "Rolled " + snap.Dir + " back to before this request"}
+	if err := s.store.AddEvent(ctx, event); err != nil {
+		return snap, err
+	}
+	snap, _, err = s.store.GetSnapshot(ctx, requestID)
+	return snap, err
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// RequestSnapshot is a tarball of the workdir taken before a request ran.
+// Files matching Exclude were left out and are left alone by a rollback.
+type RequestSnapshot struct {
+	RequestID int64    `json:"request_id"`
+	Dir       string   `json:"dir"`
+	Path      string   `json:"path"`
+	Size      int64    `json:"size"`
+	Files     int      `json:"files"`
+	Exclude   []string `json:"exclude"`
+	CreatedAt string   `json:"created_at"`
+	// RestoredAt is when the workdir was last rolled back to it
+	RestoredAt string `json:"restored_at"`
+}
+
+// SaveSnapshot records a request's snapshot, replacing what was recorded
+func (s *Store) SaveSnapshot(ctx context.Context, snap RequestSnapshot) error {
+	if snap.CreatedAt == "" {
+		snap.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	return retry(ctx, func() error {
+		_, err := s.w.ExecContext(
+			ctx,
+			`INSERT INTO request_snapshots (request_id, dir, path, size, files, exclude, created_at, restored_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (request_id) DO UPDATE SET
+				dir = excluded.dir,
+				path = excluded.path,
+				size = excluded.size,
+				files = excluded.files,
+				exclude = excluded.exclude,
+				created_at = excluded.created_at,
+				restored_at = excluded.restored_at`,
+			snap.RequestID, snap.Dir, snap.Path, snap.Size, snap.Files, strings.Join(snap.Exclude, "\n"), snap.CreatedAt, snap.RestoredAt,
+		)
+		return err
+	})
+}
+
+// GetSnapshot returns the snapshot taken before a request ran
+func (s *Store) GetSnapshot(ctx context.Context, requestID int64) (RequestSnapshot, bool, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT request_id, dir, path, size, files, exclude, created_at, restored_at FROM request_snapshots WHERE request_id = ?",
+		requestID,
+	)
+	var snap RequestSnapshot
+	var exclude string
+	err := row.Scan(&snap.RequestID, &snap.Dir, &snap.Path, &snap.Size, &snap.Files, &exclude, &snap.CreatedAt, &snap.RestoredAt)
+	if err == sql.ErrNoRows {
+		return RequestSnapshot{}, false, nil
+	}
+	if err != nil {
+		return RequestSnapshot{}, false, err
+	}
+	snap.Exclude = splitLines(exclude)
+	return snap, true, nil
+}
+
+// DeleteSnapshot forgets a request's snapshot once its tarball is removed
+func (s *Store) DeleteSnapshot(ctx context.Context, requestID int64) error {
+	return retry(ctx, func() error {
+		_, err := s.w.ExecContext(ctx, "DELETE FROM request_snapshots WHERE request_id = ?", requestID)
+		return err
+	})
+}
+
+// LockWorkdir takes the workdir for a rollback of requestID until the
+// lock expires at untilMs. It reports false, taking nothing, while a
+// request is running or another rollback holds the lock. Claims are
+// refused while the lock is held, and both run in write transactions,
+// so a request cannot start between the check and the restore.
+func (s *Store) LockWorkdir(ctx context.Context, requestID, untilMs int64) (locked bool, err error) {
+	err = retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		var running bool
+		if err := tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM requests WHERE status = ?)", StatusProcessing).Scan(&running); err != nil {
+			return err
+		}
+		if running {
+			locked = false
+			return nil
+		}
+		res, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO workdir_lock (id, request_id, expires_at_ms) VALUES (1, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET request_id = excluded.request_id, expires_at_ms = excluded.expires_at_ms
+			WHERE workdir_lock.expires_at_ms <= ?`,
+			requestID, untilMs, time.Now().UnixMilli(),
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		locked = n == 1
+		return tx.Commit()
+	})
+	return locked, err
+}
+
+// UnlockWorkdir releases the lock LockWorkdir took for requestID
+func (s *Store) UnlockWorkdir(ctx context.Context, requestID int64) error {
+	return retry(ctx, func() error {
+		_, err := s.w.ExecContext(ctx, "DELETE FROM workdir_lock WHERE request_id = ?", requestID)
+		return err
+	})
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"runtime"
+	"strconv"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	// busyTimeout is how long SQLite itself waits on a locked database
+	busyTimeout = 5 * time.Second
+	// busyRetries bounds the retries after SQLite gives up with SQLITE_BUSY
+	busyRetries = 5
+)
+
+// OpenStore opens the database at path for shared use by the web server and
+// workers, in one process or several. Connections use WAL so readers never
+// block the writer, a busy timeout instead of failing fast, and a single
+// writer connection whose transactions take the write lock up front.
+// Reads go through a separate pool.
+func OpenStore(path string) (*Store, error) {
+	pragmas := url.Values{}
+	pragmas.Add("_pragma", "busy_timeout("+strconv.Itoa(int(busyTimeout/time.Millisecond))+")")
+	pragmas.Add("_pragma", "journal_mode(WAL)")
+	pragmas.Add("_pragma", "synchronous(NORMAL)")
+
+	if path == ":memory:" {
+		// every connection would see its own empty database
+		db, err := sql.Open("sqlite", path+"?"+pragmas.Encode())
+		if err != nil {
+			return nil, err
+		}
+		db.SetMaxOpenConns(1)
+		return NewStore(db), nil
+	}
+
+	writerParams := url.Values{}
+	for k, v := range pragmas {
+		writerParams[k] = v
+	}
+	writerParams.Set("_txlock", "immediate")
+	writer, err := sql.Open("sqlite", path+"?"+writerParams.Encode())
+	if err != nil {
+		return nil, err
+	}
+	writer.SetMaxOpenConns(1)
+	writer.SetMaxIdleConns(1)
+	writer.SetConnMaxIdleTime(0)
+
+	reader, err := sql.Open("sqlite", path+"?"+pragmas.Encode())
+	if err != nil {
+		writer.Close()
+		return nil, err
+	}
+	reader.SetMaxOpenConns(max(4, runtime.NumCPU()))
+
+	// switch the file to WAL through the writer before readers race to do it
+	if err := writer.Ping(); err != nil {
+		writer.Close()
+		reader.Close()
+		return nil, err
+	}
+	return &Store{db: reader, w: writer}, nil
+}
+
+// Close closes the underlying connection pools
+func (s *Store) Close() error {
+	err := s.db.Close()
+	if s.w != s.db {
+		if werr := s.w.Close(); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// retry runs fn again while it fails with SQLITE_BUSY or SQLITE_LOCKED,
+// backing off between attempts. Lock contention that outlasts the busy
+// timeout is rare, but losing an output line to it is not acceptable.
+func retry(ctx context.Context, fn func() error) error {
+	backoff := 10 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isBusy(err) || attempt >= busyRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func isBusy(err error) bool {
+	var se *sqlite.Error
+	if !errors.As(err, &se) {
+		return false
+	}
+	code := se.Code() & 0xff
+	return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+}
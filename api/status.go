@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Status is where a request is in its lifecycle
+type Status string
+
+const (
+	StatusPending    Status = "pending"
+	StatusProcessing Status = "processing"
+	StatusProcessed  Status = "processed"
+	StatusError      Status = "error"
+	StatusCancelled  Status = "cancelled"
+	// StatusSkipped marks a pipeline step whose dependency did not succeed
+	StatusSkipped Status = "skipped"
+)
+
+// Statuses lists every status in lifecycle order
+var Statuses = []Status{StatusPending, StatusProcessing, StatusProcessed, StatusError, StatusCancelled, StatusSkipped}
+
+// transitions maps each status to the statuses it may move to. Final
+// statuses have no way out.
+var transitions = map[Status][]Status{
+	StatusPending:    {StatusProcessing, StatusCancelled, StatusSkipped},
+	StatusProcessing: {StatusProcessed, StatusError, StatusCancelled},
+}
+
+// ErrInvalidTransition is returned when a status change is not allowed
+// from the request's current status
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// TransitionError reports a rejected status change
+type TransitionError struct {
+	ID       int64
+	From, To Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("request %d: %s from %s to %s", e.ID, ErrInvalidTransition, e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrInvalidTransition
+}
+
+// CanTransition reports whether a request may move from s to next
+func (s Status) CanTransition(next Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Final reports whether s is a terminal status
+func (s Status) Final() bool {
+	return len(transitions[s]) == 0
+}
+
+// sources lists the statuses that may move to s
+func (s Status) sources() []Status {
+	var out []Status
+	for _, from := range Statuses {
+		if from.CanTransition(s) {
+			out = append(out, from)
+		}
+	}
+	return out
+}
@@ -3,69 +3,84 @@ package api
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"math"
+	"slices"
+	"strings"
 	"time"
 )
 
+// Store persists requests and their output. Reads use db; writes use w,
+// which OpenStore limits to a single connection.
 type Store struct {
 	db *sql.DB
+	w  *sql.DB
 }
 
+// NewStore wraps a single pool used for both reads and writes. Prefer
+// OpenStore, which configures SQLite for concurrent access.
 func NewStore(db *sql.DB) *Store {
-	return &Store{db: db}
+	return &Store{db: db, w: db}
 }
 
+// Init brings the schema up to date. It refuses to touch a database that
+// was migrated by a newer binary.
 func (s *Store) Init(ctx context.Context) error {
-	_, err := s.db.ExecContext(
-		ctx,
-		`CREATE TABLE IF NOT EXISTS requests (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			prompt TEXT NOT NULL,
-			status TEXT NOT NULL,
-			response TEXT NOT NULL,
-			created_at TEXT NOT NULL,
-			updated_at TEXT NOT NULL
-		)`,
-	)
-	if err != nil {
-		return err
-	}
+	return s.MigrateUp(ctx, 0)
+}
 
-	// output_lines table - each line of codex output stored as a row
-	_, err = s.db.ExecContext(
-		ctx,
-		`CREATE TABLE IF NOT EXISTS output_lines (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			request_id INTEGER NOT NULL,
-			line_num INTEGER NOT NULL,
-			line_type TEXT NOT NULL DEFAULT 'message',
-			content TEXT NOT NULL,
-			created_at TEXT NOT NULL,
-			FOREIGN KEY (request_id) REFERENCES requests(id)
-		)`,
-	)
+func (s *Store) CreateRequest(ctx context.Context, nr NewRequest) (Request, error) {
+	var req Request
+	err := retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if req, err = insertRequest(ctx, tx, nr, time.Now().UTC(), 0, ""); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
 	if err != nil {
-		return err
+		return Request{}, err
 	}
-
-	// index for fast lookup by request_id
-	_, _ = s.db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_output_lines_request ON output_lines(request_id, line_num)`)
-
-	// migration: add line_type column if missing
-	_, _ = s.db.ExecContext(ctx, `ALTER TABLE output_lines ADD COLUMN line_type TEXT NOT NULL DEFAULT 'message'`)
-
-	return nil
+	return req, nil
 }
 
-func (s *Store) CreateRequest(ctx context.Context, prompt string) (Request, error) {
-	now := time.Now().UTC().Format(time.RFC3339)
-	res, err := s.db.ExecContext(
+// insertRequest adds a pending request inside tx. A follow-up joins its
+// parent's thread and resumes its session.
+func insertRequest(ctx context.Context, tx *sql.Tx, nr NewRequest, queuedAt time.Time, pipelineID int64, step string) (Request, error) {
+	now := queuedAt.Format(time.RFC3339)
+	tags := NormalizeTags(nr.Tags)
+	var threadID int64
+	var sessionID string
+	if nr.ParentID != 0 {
+		row := tx.QueryRowContext(ctx, "SELECT thread_id, session_id FROM requests WHERE id = ?", nr.ParentID)
+		if err := row.Scan(&threadID, &sessionID); err != nil {
+			return Request{}, err
+		}
+	}
+	res, err := tx.ExecContext(
 		ctx,
-		"INSERT INTO requests (prompt, status, response, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
-		prompt,
-		"pending",
+		`INSERT INTO requests (prompt, status, response, created_at, updated_at, project, model, queued_at_ms,
+			session_id, parent_id, thread_id, pipeline_id, step, schedule_id, scheduled_for_ms)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		nr.Prompt,
+		StatusPending,
 		"",
 		now,
 		now,
+		nr.Project,
+		nr.Model,
+		queuedAt.UnixMilli(),
+		sessionID,
+		nr.ParentID,
+		threadID,
+		pipelineID,
+		step,
+		nr.ScheduleID,
+		nr.ScheduledForMs,
 	)
 	if err != nil {
 		return Request{}, err
@@ -74,77 +89,185 @@ func (s *Store) CreateRequest(ctx context.Context, prompt string) (Request, erro
 	if err != nil {
 		return Request{}, err
 	}
+	if threadID == 0 {
+		threadID = id
+		if _, err := tx.ExecContext(ctx, "UPDATE requests SET thread_id = ? WHERE id = ?", id, id); err != nil {
+			return Request{}, err
+		}
+	}
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO request_tags (request_id, tag) VALUES (?, ?)", id, tag); err != nil {
+			return Request{}, err
+		}
+	}
 	return Request{
-		ID:        id,
-		Prompt:    prompt,
-		Status:    "pending",
-		Response:  "",
-		CreatedAt: now,
+		ID:             id,
+		Prompt:         nr.Prompt,
+		Status:         StatusPending,
+		Response:       "",
+		CreatedAt:      now,
+		Project:        nr.Project,
+		Model:          nr.Model,
+		Tags:           tags,
+		QueuedAtMs:     queuedAt.UnixMilli(),
+		SessionID:      sessionID,
+		ParentID:       nr.ParentID,
+		ThreadID:       threadID,
+		PipelineID:     pipelineID,
+		Step:           step,
+		ScheduleID:     nr.ScheduleID,
+		ScheduledForMs: nr.ScheduledForMs,
 	}, nil
 }
 
-func (s *Store) ListRequests(ctx context.Context, offset, limit int) ([]Request, int, error) {
-	row := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM requests")
-	var total int
-	if err := row.Scan(&total); err != nil {
-		return nil, 0, err
+const requestColumns = `id, prompt, status, response, created_at, project, model,
+	input_tokens, output_tokens, queued_at_ms, started_at_ms, finished_at_ms, error_detail,
+	session_id, parent_id, thread_id, pipeline_id, step, schedule_id, scheduled_for_ms`
+
+func scanRequest(row rowScanner) (Request, error) {
+	var req Request
+	var detail string
+	err := row.Scan(
+		&req.ID, &req.Prompt, &req.Status, &req.Response, &req.CreatedAt, &req.Project, &req.Model,
+		&req.InputTokens, &req.OutputTokens, &req.QueuedAtMs, &req.StartedAtMs, &req.FinishedAtMs, &detail,
+		&req.SessionID, &req.ParentID, &req.ThreadID, &req.PipelineID, &req.Step,
+		&req.ScheduleID, &req.ScheduledForMs,
+	)
+	req.Failure = decodeFailure(detail)
+	return req, err
+}
+
+// loadTags fills in the tags of each request with one query
+func (s *Store) loadTags(ctx context.Context, reqs []Request) error {
+	if len(reqs) == 0 {
+		return nil
+	}
+	index := make(map[int64]int, len(reqs))
+	placeholders := make([]string, len(reqs))
+	args := make([]any, len(reqs))
+	for i, req := range reqs {
+		index[req.ID] = i
+		placeholders[i] = "?"
+		args[i] = req.ID
 	}
 	rows, err := s.db.QueryContext(
 		ctx,
-		`SELECT id, prompt, status, response, created_at
-		FROM requests
-		ORDER BY id DESC
-		LIMIT ? OFFSET ?`,
-		limit,
-		offset,
+		"SELECT request_id, tag FROM request_tags WHERE request_id IN ("+strings.Join(placeholders, ", ")+") ORDER BY tag",
+		args...,
 	)
 	if err != nil {
-		return nil, 0, err
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		reqs[index[id]].Tags = append(reqs[index[id]].Tags, tag)
+	}
+	return rows.Err()
+}
+
+// ListRequests returns up to limit requests matching q from the position
+// cur, in q's order. Cursors seek through the sort index so deep pages
+// cost the same as the first.
+func (s *Store) ListRequests(ctx context.Context, q ListQuery, cur Cursor, limit int) ([]Request, error) {
+	query, args, reverse := q.selectFrom(requestColumns, cur, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
 	}
 	defer rows.Close()
 	items := []Request{}
 	for rows.Next() {
-		var req Request
-		if err := rows.Scan(&req.ID, &req.Prompt, &req.Status, &req.Response, &req.CreatedAt); err != nil {
-			return nil, 0, err
+		req, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
 		}
 		items = append(items, req)
 	}
-	return items, total, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if reverse {
+		slices.Reverse(items)
+	}
+	return items, s.loadTags(ctx, items)
+}
+
+// ListRequestIDs is ListRequests returning only ids, for finding the
+// cursors of pages further along the list
+func (s *Store) ListRequestIDs(ctx context.Context, q ListQuery, cur Cursor, limit int) ([]int64, error) {
+	query, args, reverse := q.selectFrom("id", cur, limit)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if reverse {
+		slices.Reverse(ids)
+	}
+	return ids, nil
 }
 
 func (s *Store) GetProcessingRequest(ctx context.Context) (Request, bool, error) {
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT id, prompt, status, response, created_at
+		`SELECT `+requestColumns+`
 		FROM requests
 		WHERE status = ?
 		ORDER BY id DESC
 		LIMIT 1`,
-		"processing",
+		StatusProcessing,
 	)
-	var req Request
-	if err := row.Scan(&req.ID, &req.Prompt, &req.Status, &req.Response, &req.CreatedAt); err != nil {
-		if err == sql.ErrNoRows {
-			return Request{}, false, nil
-		}
-		return Request{}, false, err
+	return s.getRequest(ctx, row)
+}
+
+func (s *Store) ClaimNextPending(ctx context.Context) (req Request, ok bool, err error) {
+	err = retry(ctx, func() (err error) {
+		req, ok, err = s.claimNextPending(ctx)
+		return err
+	})
+	if ok && err == nil {
+		err = s.loadTags(ctx, []Request{req})
 	}
-	return req, true, nil
+	return req, ok, err
 }
 
-func (s *Store) ClaimNextPending(ctx context.Context) (Request, bool, error) {
-	tx, err := s.db.BeginTx(ctx, nil)
+func (s *Store) claimNextPending(ctx context.Context) (Request, bool, error) {
+	tx, err := s.w.BeginTx(ctx, nil)
 	if err != nil {
 		return Request{}, false, err
 	}
+	// requests wait until everything they depend on has been processed,
+	// and all of them wait while a rollback holds the workdir
 	row := tx.QueryRowContext(
 		ctx,
-		"SELECT id, prompt FROM requests WHERE status = ? ORDER BY id LIMIT 1",
-		"pending",
+		`SELECT `+requestColumns+` FROM requests
+		WHERE status = ? AND NOT EXISTS (
+			SELECT 1 FROM request_deps d JOIN requests dep ON dep.id = d.depends_on
+			WHERE d.request_id = requests.id AND dep.status != ?
+		) AND NOT EXISTS (SELECT 1 FROM workdir_lock WHERE expires_at_ms > ?)
+		ORDER BY id LIMIT 1`,
+		StatusPending,
+		StatusProcessed,
+		time.Now().UnixMilli(),
 	)
-	var req Request
-	if err := row.Scan(&req.ID, &req.Prompt); err != nil {
+	req, err := scanRequest(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			_ = tx.Rollback()
 			return Request{}, false, nil
@@ -152,76 +275,288 @@ func (s *Store) ClaimNextPending(ctx context.Context) (Request, bool, error) {
 		_ = tx.Rollback()
 		return Request{}, false, err
 	}
-	now := time.Now().UTC().Format(time.RFC3339)
-	if _, err := tx.ExecContext(
+	now := time.Now().UTC()
+	// the status guard keeps two concurrent workers from claiming the same row
+	res, err := tx.ExecContext(
 		ctx,
-		"UPDATE requests SET status = ?, updated_at = ? WHERE id = ?",
-		"processing",
-		now,
+		"UPDATE requests SET status = ?, updated_at = ?, started_at_ms = ? WHERE id = ? AND status = ?",
+		StatusProcessing,
+		now.Format(time.RFC3339),
+		now.UnixMilli(),
 		req.ID,
-	); err != nil {
+		StatusPending,
+	)
+	if err != nil {
+		_ = tx.Rollback()
+		return Request{}, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
 		_ = tx.Rollback()
 		return Request{}, false, err
 	}
 	if err := tx.Commit(); err != nil {
 		return Request{}, false, err
 	}
+	req.Status = StatusProcessing
+	req.StartedAtMs = now.UnixMilli()
 	return req, true, nil
 }
 
-func (s *Store) UpdateRequest(ctx context.Context, id int64, status, response string) error {
-	now := time.Now().UTC().Format(time.RFC3339)
-	_, err := s.db.ExecContext(
+// UpdateRequest moves a request to status and sets its response, stamping
+// the finish time when the status is final. A move the transition table
+// does not allow returns a *TransitionError and changes nothing.
+func (s *Store) UpdateRequest(ctx context.Context, id int64, status Status, response string) error {
+	return retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := s.transition(ctx, tx, id, status, response, nil); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// FailRequest moves a processing request to error with f as its detail.
+// A request already cancelled through the API keeps its status and only
+// gains the detail of how the run ended.
+func (s *Store) FailRequest(ctx context.Context, id int64, f Failure) error {
+	return retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		err = s.transition(ctx, tx, id, StatusError, f.Summary(), &f)
+		var te *TransitionError
+		if errors.As(err, &te) && te.From == StatusCancelled {
+			_, err = tx.ExecContext(ctx, "UPDATE requests SET error_detail = ? WHERE id = ?", encodeFailure(&f), id)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// CompleteRequest moves a processing request to processed, keeping any
+// warnings about the run as its detail. Like UpdateRequest it returns a
+// *TransitionError for a request cancelled through the API.
+func (s *Store) CompleteRequest(ctx context.Context, id int64, warnings []string) error {
+	var f *Failure
+	if len(warnings) > 0 {
+		f = &Failure{Warnings: warnings}
+	}
+	return retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		if err := s.transition(ctx, tx, id, StatusProcessed, "", f); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// transition applies a status change inside tx after checking it against
+// the transition table
+func (s *Store) transition(ctx context.Context, tx *sql.Tx, id int64, status Status, response string, f *Failure) error {
+	var current Status
+	if err := tx.QueryRowContext(ctx, "SELECT status FROM requests WHERE id = ?", id).Scan(&current); err != nil {
+		return err
+	}
+	if !current.CanTransition(status) {
+		return &TransitionError{ID: id, From: current, To: status}
+	}
+	now := time.Now().UTC()
+	var finishedAt int64
+	if status.Final() {
+		finishedAt = now.UnixMilli()
+	}
+	_, err := tx.ExecContext(
 		ctx,
-		"UPDATE requests SET status = ?, response = ?, updated_at = ? WHERE id = ?",
+		`UPDATE requests SET status = ?, response = ?, updated_at = ?, error_detail = ?,
+			finished_at_ms = CASE WHEN ? > 0 THEN ? ELSE finished_at_ms END
+		WHERE id = ?`,
 		status,
 		response,
-		now,
+		now.Format(time.RFC3339),
+		encodeFailure(f),
+		finishedAt,
+		finishedAt,
 		id,
 	)
-	return err
+	if err != nil || !status.Final() || status == StatusProcessed {
+		return err
+	}
+	return skipDependents(ctx, tx, id, status)
 }
 
-func (s *Store) GetRequest(ctx context.Context, id int64) (Request, bool, error) {
-	row := s.db.QueryRowContext(
+// skipDependents moves the pending requests that depend on id, directly
+// or through other requests, to skipped once id ended as status
+func skipDependents(ctx context.Context, tx *sql.Tx, id int64, status Status) error {
+	now := time.Now().UTC()
+	_, err := tx.ExecContext(
 		ctx,
-		`SELECT id, prompt, status, response, created_at FROM requests WHERE id = ?`,
+		`WITH RECURSIVE below(id) AS (
+			SELECT request_id FROM request_deps WHERE depends_on = ?
+			UNION
+			SELECT d.request_id FROM request_deps d JOIN below b ON d.depends_on = b.id
+		)
+		UPDATE requests SET status = ?, response = ?, updated_at = ?, finished_at_ms = ?
+		WHERE id IN (SELECT id FROM below) AND status = ?`,
 		id,
+		StatusSkipped,
+		skippedResponse(id, status),
+		now.Format(time.RFC3339),
+		now.UnixMilli(),
+		StatusPending,
 	)
-	var req Request
-	if err := row.Scan(&req.ID, &req.Prompt, &req.Status, &req.Response, &req.CreatedAt); err != nil {
+	return err
+}
+
+// SetRequestModel records the model a request runs with
+func (s *Store) SetRequestModel(ctx context.Context, id int64, model string) error {
+	return retry(ctx, func() error {
+		_, err := s.w.ExecContext(ctx, "UPDATE requests SET model = ? WHERE id = ?", model, id)
+		return err
+	})
+}
+
+// SetSessionID records the codex session a request's run started or
+// resumed
+func (s *Store) SetSessionID(ctx context.Context, id int64, sessionID string) error {
+	return retry(ctx, func() error {
+		_, err := s.w.ExecContext(ctx, "UPDATE requests SET session_id = ? WHERE id = ?", sessionID, id)
+		return err
+	})
+}
+
+// GetThread returns the requests of a thread, oldest first
+func (s *Store) GetThread(ctx context.Context, threadID int64) ([]Request, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+requestColumns+" FROM requests WHERE thread_id = ? ORDER BY id", threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	reqs := []Request{}
+	for rows.Next() {
+		req, err := scanRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		reqs = append(reqs, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return reqs, s.loadTags(ctx, reqs)
+}
+
+// AddUsage adds token counts reported by codex to a request's totals
+func (s *Store) AddUsage(ctx context.Context, id int64, inputTokens, outputTokens int64) error {
+	return retry(ctx, func() error {
+		_, err := s.w.ExecContext(
+			ctx,
+			"UPDATE requests SET input_tokens = input_tokens + ?, output_tokens = output_tokens + ? WHERE id = ?",
+			inputTokens,
+			outputTokens,
+			id,
+		)
+		return err
+	})
+}
+
+func (s *Store) GetRequest(ctx context.Context, id int64) (Request, bool, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+requestColumns+` FROM requests WHERE id = ?`, id)
+	return s.getRequest(ctx, row)
+}
+
+// getRequest scans a single request row and loads its tags
+func (s *Store) getRequest(ctx context.Context, row *sql.Row) (Request, bool, error) {
+	req, err := scanRequest(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return Request{}, false, nil
 		}
 		return Request{}, false, err
 	}
-	return req, true, nil
+	reqs := []Request{req}
+	if err := s.loadTags(ctx, reqs); err != nil {
+		return Request{}, false, err
+	}
+	return reqs[0], true, nil
 }
 
 // AddOutputLine inserts a single line of output for a request
 func (s *Store) AddOutputLine(ctx context.Context, requestID int64, lineNum int, lineType, content string) error {
-	now := time.Now().UTC().Format(time.RFC3339)
-	_, err := s.db.ExecContext(
+	return s.AddOutputLines(ctx, []OutputLine{{
+		RequestID: requestID,
+		LineNum:   lineNum,
+		LineType:  lineType,
+		Content:   content,
+	}})
+}
+
+const outputLineColumns = "id, request_id, line_num, line_type, content, blob_hash, full_size, created_at"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOutputLine(row rowScanner) (OutputLine, error) {
+	var line OutputLine
+	err := row.Scan(
+		&line.ID, &line.RequestID, &line.LineNum, &line.LineType, &line.Content,
+		&line.BlobHash, &line.FullSize, &line.CreatedAt,
+	)
+	return line, err
+}
+
+// GetOutputLine returns a single line by its line number
+func (s *Store) GetOutputLine(ctx context.Context, requestID int64, lineNum int) (OutputLine, bool, error) {
+	row := s.db.QueryRowContext(
 		ctx,
-		"INSERT INTO output_lines (request_id, line_num, line_type, content, created_at) VALUES (?, ?, ?, ?, ?)",
-		requestID, lineNum, lineType, content, now,
+		"SELECT "+outputLineColumns+" FROM output_lines WHERE request_id = ? AND line_num = ?",
+		requestID, lineNum,
 	)
-	return err
+	line, err := scanOutputLine(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OutputLine{}, false, nil
+		}
+		return OutputLine{}, false, err
+	}
+	return line, true, nil
 }
 
-// GetOutputLines returns output lines for a request with pagination (returns last N lines before offset)
-func (s *Store) GetOutputLines(ctx context.Context, requestID int64, limit, offset int) ([]OutputLine, int, error) {
-	// get total count
-	row := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM output_lines WHERE request_id = ?", requestID)
-	var total int
-	if err := row.Scan(&total); err != nil {
-		return nil, 0, err
+// GetLatestOutputLine returns the request's most recent line of lineType
+func (s *Store) GetLatestOutputLine(ctx context.Context, requestID int64, lineType string) (OutputLine, bool, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		"SELECT "+outputLineColumns+" FROM output_lines WHERE request_id = ? AND line_type = ? ORDER BY line_num DESC LIMIT 1",
+		requestID, lineType,
+	)
+	line, err := scanOutputLine(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return OutputLine{}, false, nil
+		}
+		return OutputLine{}, false, err
 	}
+	return line, true, nil
+}
 
+// GetOutputLines returns output lines for a request with pagination (returns last N lines before offset)
+func (s *Store) GetOutputLines(ctx context.Context, requestID int64, limit, offset int) ([]OutputLine, error) {
 	// get lines ordered by line_num descending (newest first), with pagination
 	rows, err := s.db.QueryContext(
 		ctx,
-		`SELECT id, request_id, line_num, line_type, content, created_at
+		`SELECT `+outputLineColumns+`
 		FROM output_lines
 		WHERE request_id = ?
 		ORDER BY line_num DESC
@@ -229,19 +564,32 @@ func (s *Store) GetOutputLines(ctx context.Context, requestID int64, limit, offs
 		requestID, limit, offset,
 	)
 	if err != nil {
-		return nil, 0, err
+		return nil, err
 	}
 	defer rows.Close()
 
 	var lines []OutputLine
 	for rows.Next() {
-		var line OutputLine
-		if err := rows.Scan(&line.ID, &line.RequestID, &line.LineNum, &line.LineType, &line.Content, &line.CreatedAt); err != nil {
-			return nil, 0, err
+		line, err := scanOutputLine(rows)
+		if err != nil {
+			return nil, err
 		}
 		lines = append(lines, line)
 	}
-	return lines, total, rows.Err()
+	return lines, rows.Err()
+}
+
+// CountOutputLines returns how many output lines a request has below line
+// number before, or in all when before is 0. Retention leaves gaps, so a
+// line number says nothing about how many lines come before it.
+func (s *Store) CountOutputLines(ctx context.Context, requestID int64, before int) (int, error) {
+	if before <= 0 {
+		before = math.MaxInt
+	}
+	row := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM output_lines WHERE request_id = ? AND line_num < ?", requestID, before)
+	var total int
+	err := row.Scan(&total)
+	return total, err
 }
 
 // GetNextLineNum returns the next line number for a request
@@ -251,3 +599,111 @@ func (s *Store) GetNextLineNum(ctx context.Context, requestID int64) (int, error
 	err := row.Scan(&next)
 	return next, err
 }
+
+// CancelRequest marks a pending or processing request as cancelled and
+// skips the requests waiting on it. It reports false when the request is
+// missing or already finished.
+func (s *Store) CancelRequest(ctx context.Context, id int64) (bool, error) {
+	sources := StatusCancelled.sources()
+	placeholders := make([]string, len(sources))
+	for i := range sources {
+		placeholders[i] = "?"
+	}
+	var cancelled bool
+	err := retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		now := time.Now().UTC()
+		args := []any{StatusCancelled, now.Format(time.RFC3339), now.UnixMilli(), id}
+		for _, from := range sources {
+			args = append(args, from)
+		}
+		res, err := tx.ExecContext(
+			ctx,
+			"UPDATE requests SET status = ?, updated_at = ?, finished_at_ms = ? WHERE id = ? AND status IN ("+strings.Join(placeholders, ", ")+")",
+			args...,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if cancelled = n > 0; cancelled {
+			if err := skipDependents(ctx, tx, id, StatusCancelled); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	return cancelled, err
+}
+
+// GetOutputLinesAfter returns up to limit lines with line_num greater than after, oldest first
+func (s *Store) GetOutputLinesAfter(ctx context.Context, requestID int64, after, limit int) ([]OutputLine, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+outputLineColumns+`
+		FROM output_lines
+		WHERE request_id = ? AND line_num > ?
+		ORDER BY line_num
+		LIMIT ?`,
+		requestID, after, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []OutputLine
+	for rows.Next() {
+		line, err := scanOutputLine(rows)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, rows.Err()
+}
+
+// AddOutputLines inserts a batch of output lines in a single transaction.
+// Oversized content is spilled to the blob store with a preview kept inline.
+func (s *Store) AddOutputLines(ctx context.Context, lines []OutputLine) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	return retry(ctx, func() error {
+		tx, err := s.w.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		stmt, err := tx.PrepareContext(
+			ctx,
+			`INSERT INTO output_lines (request_id, line_num, line_type, content, blob_hash, full_size, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+		for _, line := range lines {
+			line, err := spillLine(ctx, tx, line, now)
+			if err != nil {
+				return err
+			}
+			if _, err := stmt.ExecContext(
+				ctx,
+				line.RequestID, line.LineNum, line.LineType, line.Content, line.BlobHash, line.FullSize, now,
+			); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
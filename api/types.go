@@ -1,18 +1,117 @@
 package api
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Request struct {
-	ID        int64
-	Prompt    string
-	Status    string
-	Response  string
-	CreatedAt string
+	ID        int64  `json:"id"`
+	Prompt    string `json:"prompt"`
+	Status    Status `json:"status"`
+	Response  string `json:"response"`
+	CreatedAt string `json:"created_at"`
+	Project   string `json:"project"`
+	// Model is the codex model the request asked for or last ran with
+	Model        string   `json:"model"`
+	Tags         []string `json:"tags"`
+	InputTokens  int64    `json:"input_tokens"`
+	OutputTokens int64    `json:"output_tokens"`
+	// QueuedAtMs, StartedAtMs and FinishedAtMs are unix milliseconds, 0
+	// until reached
+	QueuedAtMs   int64 `json:"queued_at_ms"`
+	StartedAtMs  int64 `json:"started_at_ms"`
+	FinishedAtMs int64 `json:"finished_at_ms"`
+	// Failure describes why the run failed or was stopped, or only the
+	// warnings of a processed run; nil otherwise
+	Failure *Failure `json:"failure"`
+	// SessionID is the codex session the run started or resumed, empty
+	// until codex reports it
+	SessionID string `json:"session_id"`
+	// ParentID is the request a follow-up continues, 0 for the first
+	// request of a thread. ThreadID is the ID of that first request.
+	ParentID int64 `json:"parent_id"`
+	ThreadID int64 `json:"thread_id"`
+	// PipelineID is the pipeline the request is a step of, named Step;
+	// 0 for requests outside a pipeline
+	PipelineID int64  `json:"pipeline_id"`
+	Step       string `json:"step"`
+	// ScheduleID is the schedule that enqueued the request and
+	// ScheduledForMs the slot it ran for, in unix milliseconds; both 0 for
+	// requests not started by a schedule
+	ScheduleID     int64 `json:"schedule_id"`
+	ScheduledForMs int64 `json:"scheduled_for_ms"`
+}
+
+// NewRequest is a request to enqueue; only Prompt is required
+type NewRequest struct {
+	Prompt  string
+	Project string
+	// Model overrides the worker's default model
+	Model string
+	Tags  []string
+	// ParentID makes the request a follow-up that resumes the parent's
+	// codex session; Service.FollowUp checks it can
+	ParentID int64
+	// ScheduleID and ScheduledForMs are set by the scheduler
+	ScheduleID     int64
+	ScheduledForMs int64
 }
 
 type OutputLine struct {
-	ID        int64
-	RequestID int64
-	LineNum   int
-	LineType  string
-	Content   string
-	CreatedAt string
+	ID        int64  `json:"id"`
+	RequestID int64  `json:"request_id"`
+	LineNum   int    `json:"line_num"`
+	LineType  string `json:"line_type"`
+	Content   string `json:"content"`
+	// BlobHash is set when Content is only a preview of spilled output
+	BlobHash  string `json:"blob_hash"`
+	FullSize  int    `json:"full_size"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Truncated reports whether Content is a preview of larger spilled output
+func (l OutputLine) Truncated() bool {
+	return l.BlobHash != ""
+}
+
+// Finished reports whether the request has reached a terminal status
+func (r Request) Finished() bool {
+	return r.Status.Final()
+}
+
+// Tokens is the total token usage reported by codex
+func (r Request) Tokens() int64 {
+	return r.InputTokens + r.OutputTokens
+}
+
+// QueueWait is how long the request waited to be claimed, or to be
+// cancelled if it never started; 0 while still waiting
+func (r Request) QueueWait() time.Duration {
+	end := r.StartedAtMs
+	if end == 0 {
+		end = r.FinishedAtMs
+	}
+	if r.QueuedAtMs == 0 || end < r.QueuedAtMs {
+		return 0
+	}
+	return time.Duration(end-r.QueuedAtMs) * time.Millisecond
+}
+
+// Duration is how long the request ran, or 0 unless it started and finished
+func (r Request) Duration() time.Duration {
+	if r.StartedAtMs == 0 || r.FinishedAtMs < r.StartedAtMs {
+		return 0
+	}
+	return time.Duration(r.FinishedAtMs-r.StartedAtMs) * time.Millisecond
+}
+
+// MarshalJSON adds the derived QueueWaitMs and RunMs to the stored fields
+func (r Request) MarshalJSON() ([]byte, error) {
+	type fields Request
+	return json.Marshal(struct {
+		fields
+		QueueWaitMs int64 `json:"queue_wait_ms"`
+		RunMs       int64 `json:"run_ms"`
+	}{fields(r), r.QueueWait().Milliseconds(), r.Duration().Milliseconds()})
 }
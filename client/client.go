@@ -0,0 +1,404 @@
+// Package client is a typed Go client for the codex-launcher HTTP API
+// described in api/openapi.json.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+// APIError is returned for any non-2xx response
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	// Message is the reason the server gave in a plain text body, if any
+	Message string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.Path, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// New returns a client for the server at baseURL, e.g. http://127.0.0.1:55136.
+// A nil httpClient uses http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), httpClient: httpClient}
+}
+
+func (c *Client) Create(ctx context.Context, prompt string) (Request, error) {
+	return c.Submit(ctx, NewRequest{Prompt: prompt})
+}
+
+// Submit enqueues a request with optional project, model and tags
+func (c *Client) Submit(ctx context.Context, nr NewRequest) (Request, error) {
+	var req Request
+	err := c.do(ctx, http.MethodPost, "/api/requests", nil, nr, &req)
+	return req, err
+}
+
+func (c *Client) Get(ctx context.Context, id int64) (Request, error) {
+	var req Request
+	err := c.do(ctx, http.MethodGet, requestPath(id, ""), nil, nil, &req)
+	return req, err
+}
+
+// List returns one page of requests matching the filters in opts
+func (c *Client) List(ctx context.Context, opts ListOptions) (ListResponse, error) {
+	query := url.Values{}
+	if opts.Page > 0 {
+		query.Set("page", strconv.Itoa(opts.Page))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.After > 0 {
+		query.Set("after", strconv.FormatInt(opts.After, 10))
+	}
+	if opts.Before > 0 {
+		query.Set("before", strconv.FormatInt(opts.Before, 10))
+	}
+	for key, value := range map[string]string{
+		"status":  opts.Status,
+		"project": opts.Project,
+		"model":   opts.Model,
+		"tag":     opts.Tag,
+		"from":    opts.From,
+		"to":      opts.To,
+		"sort":    opts.Sort,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if opts.Schedule > 0 {
+		query.Set("schedule", strconv.FormatInt(opts.Schedule, 10))
+	}
+	if opts.Asc {
+		query.Set("order", "asc")
+	}
+	var resp ListResponse
+	err := c.do(ctx, http.MethodGet, "/api/requests", query, nil, &resp)
+	return resp, err
+}
+
+// Search finds prompts and output lines containing every word of query,
+// best matches first
+func (c *Client) Search(ctx context.Context, query string, page, limit int) (SearchResponse, error) {
+	values := url.Values{"q": {query}}
+	if page > 0 {
+		values.Set("page", strconv.Itoa(page))
+	}
+	if limit > 0 {
+		values.Set("limit", strconv.Itoa(limit))
+	}
+	var resp SearchResponse
+	err := c.do(ctx, http.MethodGet, "/api/v1/search", values, nil, &resp)
+	return resp, err
+}
+
+// Files returns the requests that changed path, newest first. A path
+// ending in "/" matches every file below that directory.
+func (c *Client) Files(ctx context.Context, path string, page, limit int) (FilesResponse, error) {
+	values := url.Values{"path": {path}}
+	if page > 0 {
+		values.Set("page", strconv.Itoa(page))
+	}
+	if limit > 0 {
+		values.Set("limit", strconv.Itoa(limit))
+	}
+	var resp FilesResponse
+	err := c.do(ctx, http.MethodGet, "/api/files", values, nil, &resp)
+	return resp, err
+}
+
+// RequestFiles returns the files a request changed, by path
+func (c *Client) RequestFiles(ctx context.Context, id int64) ([]RequestFile, error) {
+	var resp struct {
+		Files []RequestFile `json:"files"`
+	}
+	err := c.do(ctx, http.MethodGet, requestPath(id, "files"), nil, nil, &resp)
+	return resp.Files, err
+}
+
+// Lines returns up to limit output lines with a line number greater than
+// after, oldest first, together with the request's total line count.
+func (c *Client) Lines(ctx context.Context, id int64, after, limit int) (LinesResponse, error) {
+	query := url.Values{}
+	if after > 0 {
+		query.Set("after", strconv.Itoa(after))
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var resp LinesResponse
+	err := c.do(ctx, http.MethodGet, requestPath(id, "lines"), query, nil, &resp)
+	return resp, err
+}
+
+// Tail returns the last n output lines, at most 1000, oldest first,
+// together with the request's total line count.
+func (c *Client) Tail(ctx context.Context, id int64, n int) (LinesResponse, error) {
+	query := url.Values{"tail": {strconv.Itoa(n)}}
+	var resp LinesResponse
+	err := c.do(ctx, http.MethodGet, requestPath(id, "lines"), query, nil, &resp)
+	return resp, err
+}
+
+// FullContent returns the complete content of one output line, including
+// output that the server stores compressed and previews in Content
+func (c *Client) FullContent(ctx context.Context, id int64, lineNum int) (string, error) {
+	resp, err := c.send(ctx, http.MethodGet, requestPath(id, "lines/"+strconv.Itoa(lineNum)+"/content"), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+// Diff returns the workspace diff a run produced as a patch. A request
+// without one returns an *APIError with StatusCode 404.
+func (c *Client) Diff(ctx context.Context, id int64) (string, error) {
+	resp, err := c.send(ctx, http.MethodGet, requestPath(id, "diff"), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return string(data), err
+}
+
+// Branch returns the git branch a request ran on. A request without one
+// returns an *APIError with StatusCode 404.
+func (c *Client) Branch(ctx context.Context, id int64) (Branch, error) {
+	var b Branch
+	err := c.do(ctx, http.MethodGet, requestPath(id, "branch"), nil, nil, &b)
+	return b, err
+}
+
+// MergeBranch merges a request's open branch into target, or into the
+// branch it started from when target is empty. A branch that is not open
+// or that git could not merge returns an *APIError with StatusCode 409.
+func (c *Client) MergeBranch(ctx context.Context, id int64, target string) (Branch, error) {
+	var b Branch
+	err := c.do(ctx, http.MethodPost, requestPath(id, "branch/merge"), nil, map[string]string{"target": target}, &b)
+	return b, err
+}
+
+// DiscardBranch deletes a request's open branch
+func (c *Client) DiscardBranch(ctx context.Context, id int64) (Branch, error) {
+	var b Branch
+	err := c.do(ctx, http.MethodPost, requestPath(id, "branch/discard"), nil, nil, &b)
+	return b, err
+}
+
+// FollowUp enqueues the next turn of the thread id ends, resuming its
+// codex session. Project, model and tags default to the parent's. A
+// request that is still running, has no session or already has a
+// follow-up returns an *APIError with StatusCode 409.
+func (c *Client) FollowUp(ctx context.Context, id int64, nr NewRequest) (Request, error) {
+	var req Request
+	err := c.do(ctx, http.MethodPost, requestPath(id, "follow-up"), nil, nr, &req)
+	return req, err
+}
+
+// Thread returns every request of the thread id belongs to, oldest first
+func (c *Client) Thread(ctx context.Context, id int64) ([]Request, error) {
+	var resp struct {
+		Requests []Request `json:"requests"`
+	}
+	err := c.do(ctx, http.MethodGet, requestPath(id, "thread"), nil, nil, &resp)
+	return resp.Requests, err
+}
+
+// Snapshot returns the workdir snapshot taken before a request ran. A
+// request without one returns an *APIError with StatusCode 404.
+func (c *Client) Snapshot(ctx context.Context, id int64) (Snapshot, error) {
+	var snap Snapshot
+	err := c.do(ctx, http.MethodGet, requestPath(id, "snapshot"), nil, nil, &snap)
+	return snap, err
+}
+
+// Rollback restores the workdir to the snapshot taken before a request
+// ran. It returns an *APIError with StatusCode 409 while a request is
+// running or when the restore failed; History then has the reason.
+func (c *Client) Rollback(ctx context.Context, id int64) (Snapshot, error) {
+	var snap Snapshot
+	err := c.do(ctx, http.MethodPost, requestPath(id, "rollback"), nil, nil, &snap)
+	return snap, err
+}
+
+// History returns what happened to a request outside its run, oldest
+// first
+func (c *Client) History(ctx context.Context, id int64) ([]HistoryEvent, error) {
+	var resp struct {
+		Events []HistoryEvent `json:"events"`
+	}
+	err := c.do(ctx, http.MethodGet, requestPath(id, "history"), nil, nil, &resp)
+	return resp.Events, err
+}
+
+// Cancel cancels a pending or processing request. Cancelling a finished
+// request returns an *APIError with StatusCode 409.
+func (c *Client) Cancel(ctx context.Context, id int64) (Request, error) {
+	var req Request
+	err := c.do(ctx, http.MethodPost, requestPath(id, "cancel"), nil, nil, &req)
+	return req, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send performs a request and returns the response for any 2xx status
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{StatusCode: resp.StatusCode, Method: method, Path: path}
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+			data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// CreatePipeline enqueues a pipeline of dependent steps. Steps that do not
+// form a graph that can run return an *APIError with StatusCode 400 and
+// the reason as Message.
+func (c *Client) CreatePipeline(ctx context.Context, np NewPipeline) (Pipeline, error) {
+	var p Pipeline
+	err := c.do(ctx, http.MethodPost, "/api/pipelines", nil, np, &p)
+	return p, err
+}
+
+// Pipeline returns a pipeline with the request of each step
+func (c *Client) Pipeline(ctx context.Context, id int64) (Pipeline, error) {
+	var p Pipeline
+	err := c.do(ctx, http.MethodGet, "/api/pipelines/"+strconv.FormatInt(id, 10), nil, nil, &p)
+	return p, err
+}
+
+// Schedules returns every schedule, oldest first
+func (c *Client) Schedules(ctx context.Context) ([]Schedule, error) {
+	var resp struct {
+		Schedules []Schedule `json:"schedules"`
+	}
+	err := c.do(ctx, http.MethodGet, "/api/schedules", nil, nil, &resp)
+	return resp.Schedules, err
+}
+
+// Schedule returns one schedule
+func (c *Client) Schedule(ctx context.Context, id int64) (Schedule, error) {
+	var sched Schedule
+	err := c.do(ctx, http.MethodGet, schedulePath(id, ""), nil, nil, &sched)
+	return sched, err
+}
+
+// CreateSchedule adds a schedule. Settings that cannot run return an
+// *APIError with StatusCode 400 and the reason as Message.
+func (c *Client) CreateSchedule(ctx context.Context, ns NewSchedule) (Schedule, error) {
+	var sched Schedule
+	err := c.do(ctx, http.MethodPost, "/api/schedules", nil, ns, &sched)
+	return sched, err
+}
+
+// UpdateSchedule replaces a schedule's settings
+func (c *Client) UpdateSchedule(ctx context.Context, id int64, ns NewSchedule) (Schedule, error) {
+	var sched Schedule
+	err := c.do(ctx, http.MethodPut, schedulePath(id, ""), nil, ns, &sched)
+	return sched, err
+}
+
+// SetScheduleEnabled turns a schedule on or off
+func (c *Client) SetScheduleEnabled(ctx context.Context, id int64, enabled bool) (Schedule, error) {
+	action := "disable"
+	if enabled {
+		action = "enable"
+	}
+	var sched Schedule
+	err := c.do(ctx, http.MethodPost, schedulePath(id, action), nil, nil, &sched)
+	return sched, err
+}
+
+// RunSchedule enqueues a run of a schedule now
+func (c *Client) RunSchedule(ctx context.Context, id int64) (Request, error) {
+	var req Request
+	err := c.do(ctx, http.MethodPost, schedulePath(id, "run"), nil, nil, &req)
+	return req, err
+}
+
+// DeleteSchedule removes a schedule; the requests it enqueued stay
+func (c *Client) DeleteSchedule(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, schedulePath(id, ""), nil, nil, nil)
+}
+
+func schedulePath(id int64, action string) string {
+	path := "/api/schedules/" + strconv.FormatInt(id, 10)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+func requestPath(id int64, action string) string {
+	path := "/api/requests/" + strconv.FormatInt(id, 10)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
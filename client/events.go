@@ -0,0 +1,79 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// StreamEvents follows a request's output, calling fn for every event.
+// Only lines with a line number greater than after are sent. It returns
+// nil once the server closes the stream after the request finishes, or
+// the first error returned by fn.
+func (c *Client) StreamEvents(ctx context.Context, id int64, after int, fn func(Event) error) error {
+	query := url.Values{}
+	if after > 0 {
+		query.Set("after", strconv.Itoa(after))
+	}
+	resp, err := c.send(ctx, http.MethodGet, requestPath(id, "events"), query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var eventType string
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// blank line terminates an event
+			if eventType != "" || data.Len() > 0 {
+				if err := dispatchEvent(eventType, data.String(), fn); err != nil {
+					return err
+				}
+			}
+			eventType = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func dispatchEvent(eventType, data string, fn func(Event) error) error {
+	event := Event{Type: eventType}
+	switch eventType {
+	case "line":
+		var line OutputLine
+		if err := json.Unmarshal([]byte(data), &line); err != nil {
+			return err
+		}
+		event.Line = &line
+	case "status":
+		var req Request
+		if err := json.Unmarshal([]byte(data), &req); err != nil {
+			return err
+		}
+		event.Request = &req
+	default:
+		// unknown events are ignored for forward compatibility
+		return nil
+	}
+	return fn(event)
+}
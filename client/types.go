@@ -0,0 +1,291 @@
+package client
+
+import "time"
+
+// Request mirrors the request object returned by the API
+type Request struct {
+	ID           int64    `json:"id"`
+	Prompt       string   `json:"prompt"`
+	Status       string   `json:"status"`
+	Response     string   `json:"response"`
+	CreatedAt    string   `json:"created_at"`
+	Project      string   `json:"project"`
+	Model        string   `json:"model"`
+	Tags         []string `json:"tags"`
+	InputTokens  int64    `json:"input_tokens"`
+	OutputTokens int64    `json:"output_tokens"`
+	// QueuedAtMs, StartedAtMs and FinishedAtMs are unix milliseconds, 0
+	// until reached
+	QueuedAtMs   int64 `json:"queued_at_ms"`
+	StartedAtMs  int64 `json:"started_at_ms"`
+	FinishedAtMs int64 `json:"finished_at_ms"`
+	// QueueWaitMs and RunMs are derived from the timestamps by the server
+	QueueWaitMs int64 `json:"queue_wait_ms"`
+	RunMs       int64 `json:"run_ms"`
+	// Failure describes why the run failed or was stopped, or only the
+	// warnings of a processed run; nil otherwise
+	Failure *Failure `json:"failure"`
+	// SessionID is the codex session the run started or resumed.
+	// ParentID is the request a follow-up continues, 0 for the first
+	// request of a thread; ThreadID is the ID of that first request.
+	SessionID string `json:"session_id"`
+	ParentID  int64  `json:"parent_id"`
+	ThreadID  int64  `json:"thread_id"`
+	// PipelineID is the pipeline the request is a step of, named Step
+	PipelineID int64  `json:"pipeline_id"`
+	Step       string `json:"step"`
+	// ScheduleID is the schedule that enqueued the request and
+	// ScheduledForMs the slot it ran for, in unix milliseconds
+	ScheduleID     int64 `json:"schedule_id"`
+	ScheduledForMs int64 `json:"scheduled_for_ms"`
+}
+
+// Failure is the structured record of a failed run. Kind is one of
+// "spawn", "exit", "timeout", "cancelled", "codex_error",
+// "stream_corrupt" or "workspace", and empty when the run was processed
+// with Warnings.
+type Failure struct {
+	Kind       string   `json:"kind"`
+	Message    string   `json:"message"`
+	ExitCode   *int     `json:"exit_code,omitempty"`
+	Signal     string   `json:"signal,omitempty"`
+	StderrTail []string `json:"stderr_tail,omitempty"`
+	CodexError string   `json:"codex_error,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+}
+
+// NewRequest is the body of Submit; only Prompt is required
+type NewRequest struct {
+	Prompt  string   `json:"prompt"`
+	Project string   `json:"project,omitempty"`
+	Model   string   `json:"model,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+// ListOptions filters and sorts List. Zero values match everything,
+// newest first. Sort is "created", "duration" or "tokens"; From and To
+// are YYYY-MM-DD creation dates, inclusive. After and Before take the
+// Next and Prev cursors of a previous response; Page is only the number
+// the response reports for the page they lead to.
+type ListOptions struct {
+	Page    int
+	Limit   int
+	After   int64
+	Before  int64
+	Status  string
+	Project string
+	Model   string
+	Tag     string
+	// Schedule limits the list to the runs of one schedule
+	Schedule int64
+	From     string
+	To       string
+	Sort     string
+	Asc      bool
+}
+
+// Duration is how long the request ran, or 0 unless it started and finished
+func (r Request) Duration() time.Duration {
+	return time.Duration(r.RunMs) * time.Millisecond
+}
+
+// QueueWait is how long the request waited before it started, or before
+// it was cancelled if it never did
+func (r Request) QueueWait() time.Duration {
+	return time.Duration(r.QueueWaitMs) * time.Millisecond
+}
+
+// Finished reports whether the request has reached a terminal status
+func (r Request) Finished() bool {
+	return r.Status != "pending" && r.Status != "processing"
+}
+
+type OutputLine struct {
+	ID        int64  `json:"id"`
+	RequestID int64  `json:"request_id"`
+	LineNum   int    `json:"line_num"`
+	LineType  string `json:"line_type"`
+	Content   string `json:"content"`
+	// BlobHash is set when Content is only a preview; use FullContent
+	BlobHash  string `json:"blob_hash"`
+	FullSize  int    `json:"full_size"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ListResponse struct {
+	Requests []Request `json:"requests"`
+	Page     int       `json:"page"`
+	// Next and Prev are cursors for the neighbouring pages, 0 at either end
+	Next int64 `json:"next"`
+	Prev int64 `json:"prev"`
+}
+
+type LinesResponse struct {
+	Lines []OutputLine `json:"lines"`
+	Total int          `json:"total"`
+}
+
+// SearchHit is one matching prompt (LineNum 0) or output line. Snippet is
+// HTML with matched terms wrapped in <mark>.
+type SearchHit struct {
+	RequestID int64  `json:"request_id"`
+	LineNum   int    `json:"line_num"`
+	LineType  string `json:"line_type"`
+	Snippet   string `json:"snippet"`
+	URL       string `json:"url"`
+	CreatedAt string `json:"created_at"`
+}
+
+type SearchResponse struct {
+	Query string      `json:"query"`
+	Hits  []SearchHit `json:"hits"`
+	Page  int         `json:"page"`
+	More  bool        `json:"more"`
+}
+
+// RequestFile is a file a request changed. Kind is "add", "delete" or
+// "update"; Added and Removed are line counts from git, 0 when unknown.
+type RequestFile struct {
+	RequestID int64  `json:"request_id"`
+	Path      string `json:"path"`
+	Kind      string `json:"kind"`
+	Added     int    `json:"added"`
+	Removed   int    `json:"removed"`
+}
+
+// FileTouch is a request that changed a file
+type FileTouch struct {
+	RequestFile
+	Prompt    string `json:"prompt"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+type FilesResponse struct {
+	Path  string      `json:"path"`
+	Files []FileTouch `json:"files"`
+	Page  int         `json:"page"`
+	More  bool        `json:"more"`
+}
+
+// Event is a single server-sent event from StreamEvents.
+// Line is set for "line" events and Request for "status" events.
+type Event struct {
+	Type    string
+	Line    *OutputLine
+	Request *Request
+}
+
+// Branch is the git branch a request ran on. State is "running", "open",
+// "empty", "merged" or "discarded"; only open branches can be merged or
+// discarded.
+type Branch struct {
+	RequestID int64  `json:"request_id"`
+	RepoDir   string `json:"repo_dir"`
+	Branch    string `json:"branch"`
+	Target    string `json:"target"`
+	BaseSHA   string `json:"base_sha"`
+	CommitSHA string `json:"commit_sha"`
+	State     string `json:"state"`
+	MergeSHA  string `json:"merge_sha"`
+	Error     string `json:"error"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// Snapshot is a tarball of the workdir taken before a request ran. Paths
+// matching Exclude were left out and are left alone by a rollback.
+type Snapshot struct {
+	RequestID  int64    `json:"request_id"`
+	Dir        string   `json:"dir"`
+	Path       string   `json:"path"`
+	Size       int64    `json:"size"`
+	Files      int      `json:"files"`
+	Exclude    []string `json:"exclude"`
+	CreatedAt  string   `json:"created_at"`
+	RestoredAt string   `json:"restored_at"`
+}
+
+// HistoryEvent is an entry of a request's history. Kind is "snapshot",
+// "snapshot_skipped", "rollback", "rollback_failed", "branch_merged" or
+// "branch_discarded".
+type HistoryEvent struct {
+	ID        int64  `json:"id"`
+	RequestID int64  `json:"request_id"`
+	Kind      string `json:"kind"`
+	Message   string `json:"message"`
+	CreatedAt string `json:"created_at"`
+}
+
+// NewPipeline is the body of CreatePipeline. Steps are given either as
+// Steps or, when Steps is empty, as Text with one "name after a, b: prompt"
+// line per step.
+type NewPipeline struct {
+	Name    string    `json:"name,omitempty"`
+	Project string    `json:"project,omitempty"`
+	Model   string    `json:"model,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Steps   []NewStep `json:"steps,omitempty"`
+	Text    string    `json:"text,omitempty"`
+}
+
+// NewStep is a step of a NewPipeline; DependsOn names other steps
+type NewStep struct {
+	Name      string   `json:"name"`
+	Prompt    string   `json:"prompt"`
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// Pipeline is a graph of steps, each run as a request once the steps it
+// depends on were processed. Status is "pending", "processing",
+// "processed", "error" or "cancelled".
+type Pipeline struct {
+	ID        int64          `json:"id"`
+	Name      string         `json:"name"`
+	CreatedAt string         `json:"created_at"`
+	Status    string         `json:"status"`
+	Steps     []PipelineStep `json:"steps"`
+}
+
+// PipelineStep is a step of a pipeline and the request it runs as. Layer
+// is the length of the longest chain of steps before it.
+type PipelineStep struct {
+	Name      string   `json:"name"`
+	Request   Request  `json:"request"`
+	DependsOn []string `json:"depends_on"`
+	Layer     int      `json:"layer"`
+}
+
+// Schedule enqueues a request from a template prompt on a cron schedule.
+// Missed is "skip", "once" or "all"; NextRunAtMs is 0 while disabled.
+type Schedule struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Cron        string   `json:"cron"`
+	TimeZone    string   `json:"time_zone"`
+	Enabled     bool     `json:"enabled"`
+	Prompt      string   `json:"prompt"`
+	Project     string   `json:"project"`
+	Model       string   `json:"model"`
+	Tags        []string `json:"tags"`
+	Missed      string   `json:"missed"`
+	NextRunAtMs int64    `json:"next_run_at_ms"`
+	LastRunAtMs int64    `json:"last_run_at_ms"`
+	SkippedRuns int64    `json:"skipped_runs"`
+	CreatedAt   string   `json:"created_at"`
+	UpdatedAt   string   `json:"updated_at"`
+}
+
+// NewSchedule is the body of CreateSchedule and UpdateSchedule; Cron and
+// Prompt are required. TimeZone defaults to UTC, Missed to "once" and
+// Enabled to true.
+type NewSchedule struct {
+	Name     string   `json:"name,omitempty"`
+	Cron     string   `json:"cron"`
+	TimeZone string   `json:"time_zone,omitempty"`
+	Prompt   string   `json:"prompt"`
+	Project  string   `json:"project,omitempty"`
+	Model    string   `json:"model,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Missed   string   `json:"missed,omitempty"`
+	Enabled  *bool    `json:"enabled,omitempty"`
+}
@@ -0,0 +1,894 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"almono/client"
+)
+
+func runSubmit(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("submit", flag.ExitOnError)
+	wait := fs.Bool("wait", false, "block until the request finishes; exit non-zero on failure")
+	quiet := fs.Bool("q", false, "with -wait, do not print output lines")
+	project := fs.String("project", "", "project label")
+	model := fs.String("model", "", "codex model, overriding the worker default")
+	tags := fs.String("tags", "", "comma-separated tags")
+	fs.Parse(args)
+
+	prompt := strings.Join(fs.Args(), " ")
+	if prompt == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		prompt = string(data)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return errors.New("submit: prompt is required")
+	}
+
+	nr := client.NewRequest{Prompt: prompt, Project: *project, Model: *model}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			nr.Tags = append(nr.Tags, tag)
+		}
+	}
+	req, err := c.Submit(ctx, nr)
+	if err != nil {
+		return err
+	}
+	fmt.Println(req.ID)
+	if !*wait {
+		return nil
+	}
+	return follow(ctx, c, req.ID, 0, !*quiet)
+}
+
+func runFollowUp(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("follow-up", flag.ExitOnError)
+	wait := fs.Bool("wait", false, "block until the request finishes; exit non-zero on failure")
+	quiet := fs.Bool("q", false, "with -wait, do not print output lines")
+	model := fs.String("model", "", "codex model (default: the one the request ran with)")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		return errors.New("follow-up: request ID and prompt are required")
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("follow-up: invalid request ID %q", fs.Arg(0))
+	}
+	prompt := strings.Join(fs.Args()[1:], " ")
+	if prompt == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		prompt = string(data)
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return errors.New("follow-up: prompt is required")
+	}
+
+	req, err := c.FollowUp(ctx, id, client.NewRequest{Prompt: prompt, Model: *model})
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		return followUpError(ctx, c, id)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(req.ID)
+	if !*wait {
+		return nil
+	}
+	return follow(ctx, c, req.ID, 0, !*quiet)
+}
+
+// followUpError explains why a request cannot be followed up
+func followUpError(ctx context.Context, c *client.Client, id int64) error {
+	req, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	switch {
+	case req.Status == "pending" || req.Status == "processing":
+		return fmt.Errorf("request %d is still %s", id, req.Status)
+	case req.SessionID == "":
+		return fmt.Errorf("request %d has no codex session to resume", id)
+	}
+	thread, err := c.Thread(ctx, id)
+	if err != nil || len(thread) == 0 {
+		return fmt.Errorf("request %d cannot be followed up", id)
+	}
+	return fmt.Errorf("request %d already has a follow-up; continue from %d", id, thread[len(thread)-1].ID)
+}
+
+func runThread(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("thread", flag.ExitOnError)
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+	thread, err := c.Thread(ctx, id)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TURN\tID\tSTATUS\tPROMPT")
+	for i, req := range thread {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%s\n", i+1, req.ID, req.Status, oneLine(req.Prompt, 60))
+	}
+	return tw.Flush()
+}
+
+// pipelinePollInterval is how often pipeline -wait checks on the steps
+const pipelinePollInterval = 2 * time.Second
+
+func runPipeline(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("pipeline", flag.ExitOnError)
+	wait := fs.Bool("wait", false, "block until every step finishes; exit non-zero unless all were processed")
+	name := fs.String("name", "", "pipeline name")
+	project := fs.String("project", "", "project label for every step")
+	model := fs.String("model", "", "codex model for every step, overriding the worker default")
+	tags := fs.String("tags", "", "comma-separated tags for every step")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("pipeline: expected a steps file, or - for stdin")
+	}
+	var data []byte
+	var err error
+	if fs.Arg(0) == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(fs.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	np := client.NewPipeline{Name: *name, Project: *project, Model: *model, Text: string(data)}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			np.Tags = append(np.Tags, tag)
+		}
+	}
+	p, err := c.CreatePipeline(ctx, np)
+	if err != nil {
+		return err
+	}
+	fmt.Println(p.ID)
+	if !*wait {
+		return nil
+	}
+	seen := map[string]string{}
+	ticker := time.NewTicker(pipelinePollInterval)
+	defer ticker.Stop()
+	for {
+		for _, step := range p.Steps {
+			if seen[step.Name] != step.Request.Status {
+				seen[step.Name] = step.Request.Status
+				fmt.Printf("%s (%d): %s\n", step.Name, step.Request.ID, step.Request.Status)
+			}
+		}
+		if p.Status != "pending" && p.Status != "processing" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if p, err = c.Pipeline(ctx, p.ID); err != nil {
+			return err
+		}
+	}
+	if p.Status != "processed" {
+		fmt.Fprintf(os.Stderr, "pipeline %d %s\n", p.ID, p.Status)
+		return errRequestFailed
+	}
+	return nil
+}
+
+func runPipelineShow(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("pipeline-show", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("pipeline-show: expected exactly one pipeline ID")
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("pipeline-show: invalid pipeline ID %q", fs.Arg(0))
+	}
+	p, err := c.Pipeline(ctx, id)
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("pipeline %d", p.ID)
+	if p.Name != "" {
+		title += " " + p.Name
+	}
+	fmt.Printf("%s: %s\n", title, p.Status)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "STEP\tID\tSTATUS\tAFTER\tPROMPT")
+	for _, step := range p.Steps {
+		after := "-"
+		if len(step.DependsOn) > 0 {
+			after = strings.Join(step.DependsOn, ",")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n", step.Name, step.Request.ID, step.Request.Status, after, oneLine(step.Request.Prompt, 50))
+	}
+	return tw.Flush()
+}
+
+func runSchedule(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	ns := client.NewSchedule{}
+	fs.StringVar(&ns.Name, "name", "", "schedule name")
+	fs.StringVar(&ns.TimeZone, "tz", "", "IANA time zone the cron expression is read in (default UTC)")
+	fs.StringVar(&ns.Missed, "missed", "", "runs missed while the server was down: skip, once or all (default once)")
+	fs.StringVar(&ns.Project, "project", "", "project label for every run")
+	fs.StringVar(&ns.Model, "model", "", "codex model for every run, overriding the worker default")
+	tags := fs.String("tags", "", "comma-separated tags for every run")
+	disabled := fs.Bool("disabled", false, "create the schedule switched off")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return errors.New("schedule: expected a cron expression and a prompt")
+	}
+	ns.Cron, ns.Prompt = fs.Arg(0), fs.Arg(1)
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			ns.Tags = append(ns.Tags, tag)
+		}
+	}
+	if *disabled {
+		enabled := false
+		ns.Enabled = &enabled
+	}
+	sched, err := c.CreateSchedule(ctx, ns)
+	if err != nil {
+		return err
+	}
+	fmt.Println(sched.ID)
+	return nil
+}
+
+func runSchedules(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("schedules", flag.ExitOnError)
+	fs.Parse(args)
+	schedules, err := c.Schedules(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tCRON\tZONE\tNEXT\tPROMPT")
+	for _, sched := range schedules {
+		next := "disabled"
+		if sched.Enabled {
+			next = "-"
+			if sched.NextRunAtMs != 0 {
+				next = time.UnixMilli(sched.NextRunAtMs).UTC().Format(time.RFC3339)
+			}
+		}
+		name := sched.Name
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", sched.ID, name, sched.Cron, sched.TimeZone, next, oneLine(sched.Prompt, 40))
+	}
+	return tw.Flush()
+}
+
+// runScheduleAction switches, runs or deletes the schedule named by the
+// single ID argument
+func runScheduleAction(ctx context.Context, c *client.Client, name string, args []string) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%s: expected exactly one schedule ID", name)
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%s: invalid schedule ID %q", name, fs.Arg(0))
+	}
+	switch name {
+	case "schedule-enable", "schedule-disable":
+		sched, err := c.SetScheduleEnabled(ctx, id, name == "schedule-enable")
+		if err != nil {
+			return err
+		}
+		switch {
+		case !sched.Enabled:
+			fmt.Printf("schedule %d disabled\n", sched.ID)
+		case sched.NextRunAtMs != 0:
+			fmt.Printf("schedule %d enabled; next run %s\n", sched.ID, time.UnixMilli(sched.NextRunAtMs).UTC().Format(time.RFC3339))
+		default:
+			fmt.Printf("schedule %d enabled; no further runs\n", sched.ID)
+		}
+		return nil
+	case "schedule-run":
+		req, err := c.RunSchedule(ctx, id)
+		if err != nil {
+			return err
+		}
+		fmt.Println(req.ID)
+		return nil
+	default:
+		return c.DeleteSchedule(ctx, id)
+	}
+}
+
+func runList(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	var opts client.ListOptions
+	fs.IntVar(&opts.Page, "page", 1, "number to show for the page -after or -before leads to")
+	fs.IntVar(&opts.Limit, "limit", 10, "requests per page")
+	fs.Int64Var(&opts.After, "after", 0, "show the page after this request id, as printed by a previous list")
+	fs.Int64Var(&opts.Before, "before", 0, "show the page before this request id")
+	fs.StringVar(&opts.Status, "status", "", "only requests with this status")
+	fs.StringVar(&opts.Project, "project", "", "only requests in this project")
+	fs.StringVar(&opts.Model, "model", "", "only requests run with this model")
+	fs.StringVar(&opts.Tag, "tag", "", "only requests with this tag")
+	fs.Int64Var(&opts.Schedule, "schedule", 0, "only runs of this schedule")
+	fs.StringVar(&opts.From, "from", "", "only requests created on or after this date (YYYY-MM-DD)")
+	fs.StringVar(&opts.To, "to", "", "only requests created on or before this date (YYYY-MM-DD)")
+	fs.StringVar(&opts.Sort, "sort", "created", "sort by created, duration or tokens")
+	fs.BoolVar(&opts.Asc, "asc", false, "sort ascending")
+	fs.Parse(args)
+
+	resp, err := c.List(ctx, opts)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tCREATED\tDURATION\tTOKENS\tPROMPT")
+	for _, req := range resp.Requests {
+		duration := "-"
+		if d := req.Duration(); d > 0 {
+			duration = d.Round(time.Second).String()
+		}
+		fmt.Fprintf(
+			tw, "%d\t%s\t%s\t%s\t%d\t%s\n",
+			req.ID, req.Status, req.CreatedAt, duration, req.InputTokens+req.OutputTokens, oneLine(req.Prompt, 60),
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("page %d\n", resp.Page)
+	if resp.Prev != 0 {
+		fmt.Printf("previous page: list -before %d -page %d\n", resp.Prev, resp.Page-1)
+	}
+	if resp.Next != 0 {
+		fmt.Printf("next page: list -after %d -page %d\n", resp.Next, resp.Page+1)
+	}
+	return nil
+}
+
+func runShow(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ExitOnError)
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("id:       %d\n", req.ID)
+	fmt.Printf("status:   %s\n", req.Status)
+	fmt.Printf("created:  %s\n", req.CreatedAt)
+	if req.Project != "" {
+		fmt.Printf("project:  %s\n", req.Project)
+	}
+	if req.Model != "" {
+		fmt.Printf("model:    %s\n", req.Model)
+	}
+	if len(req.Tags) > 0 {
+		fmt.Printf("tags:     %s\n", strings.Join(req.Tags, ", "))
+	}
+	if req.ParentID != 0 {
+		fmt.Printf("parent:   %d\n", req.ParentID)
+	}
+	if req.SessionID != "" {
+		fmt.Printf("session:  %s\n", req.SessionID)
+	}
+	if req.PipelineID != 0 {
+		fmt.Printf("pipeline: %d, step %s\n", req.PipelineID, req.Step)
+	}
+	if req.ScheduleID != 0 {
+		fmt.Printf("schedule: %d, for %s\n", req.ScheduleID, time.UnixMilli(req.ScheduledForMs).UTC().Format(time.RFC3339))
+	}
+	if d := req.QueueWait(); d > 0 {
+		fmt.Printf("waited:   %s\n", d.Round(time.Millisecond))
+	}
+	if d := req.Duration(); d > 0 {
+		fmt.Printf("duration: %s\n", d.Round(time.Millisecond))
+	}
+	if req.InputTokens+req.OutputTokens > 0 {
+		fmt.Printf("tokens:   %d in, %d out\n", req.InputTokens, req.OutputTokens)
+	}
+	if req.Response != "" {
+		fmt.Printf("response: %s\n", req.Response)
+	}
+	if f := req.Failure; f != nil {
+		if f.Kind != "" {
+			fmt.Printf("failure:  %s\n", f.Kind)
+		}
+		if f.ExitCode != nil {
+			fmt.Printf("exit:     %d\n", *f.ExitCode)
+		}
+		if f.Signal != "" {
+			fmt.Printf("signal:   %s\n", f.Signal)
+		}
+		if f.CodexError != "" {
+			fmt.Printf("codex:    %s\n", f.CodexError)
+		}
+		if len(f.StderrTail) > 0 {
+			fmt.Printf("stderr:\n%s\n", strings.Join(f.StderrTail, "\n"))
+		}
+		for _, warning := range f.Warnings {
+			fmt.Printf("warning:  %s\n", warning)
+		}
+	}
+	branch, err := c.Branch(ctx, id)
+	var apiErr *client.APIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound) {
+		return err
+	}
+	if err == nil {
+		fmt.Printf("branch:   %s (%s)\n", branch.Branch, branchState(branch))
+		if branch.Error != "" {
+			fmt.Printf("git:      %s\n", branch.Error)
+		}
+	}
+	snap, err := c.Snapshot(ctx, id)
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound) {
+		return err
+	}
+	if err == nil {
+		fmt.Printf("snapshot: %s (%d files)\n", snap.Dir, snap.Files)
+	}
+	history, err := c.History(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(history) > 0 {
+		fmt.Println("history:")
+		for _, e := range history {
+			fmt.Printf("  %s %s\n", e.CreatedAt, e.Message)
+		}
+	}
+	files, err := c.RequestFiles(ctx, id)
+	if err != nil {
+		return err
+	}
+	if len(files) > 0 {
+		fmt.Println("files:")
+		for _, f := range files {
+			fmt.Printf("  %s (%s)\n", f.Path, fileChange(f))
+		}
+	}
+	fmt.Printf("prompt:\n%s\n\n", req.Prompt)
+	lines, err := allLines(ctx, c, id)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		printLine(line)
+	}
+	return nil
+}
+
+func runTail(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	followFlag := fs.Bool("f", false, "follow output until the request finishes")
+	n := fs.Int("n", 10, "number of trailing lines to print first, at most 1000")
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+
+	after := 0
+	if *n > 0 {
+		resp, err := c.Tail(ctx, id, *n)
+		if err != nil {
+			return err
+		}
+		for _, line := range resp.Lines {
+			printLine(line)
+			after = line.LineNum
+		}
+	}
+	if *followFlag {
+		if after == 0 {
+			// with nothing printed, follow from the current end
+			last, err := c.Tail(ctx, id, 1)
+			if err != nil {
+				return err
+			}
+			if len(last.Lines) > 0 {
+				after = last.Lines[0].LineNum
+			}
+		}
+		return follow(ctx, c, id, after, true)
+	}
+	return nil
+}
+
+func runCancel(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("cancel", flag.ExitOnError)
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.Cancel(ctx, id)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		return fmt.Errorf("request %d already finished", id)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d %s\n", req.ID, req.Status)
+	return nil
+}
+
+func runDiff(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+
+	patch, err := c.Diff(ctx, id)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("request %d has no diff", id)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(os.Stdout, patch)
+	return err
+}
+
+func runMerge(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	into := fs.String("into", "", "target branch (default: the branch the request started from)")
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+	branch, err := c.MergeBranch(ctx, id, *into)
+	if err != nil {
+		return branchError(ctx, c, id, err)
+	}
+	fmt.Printf("%s %s\n", branch.Branch, branchState(branch))
+	return nil
+}
+
+func runDiscard(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("discard", flag.ExitOnError)
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+	branch, err := c.DiscardBranch(ctx, id)
+	if err != nil {
+		return branchError(ctx, c, id, err)
+	}
+	fmt.Printf("%s %s\n", branch.Branch, branchState(branch))
+	return nil
+}
+
+func runRollback(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+	snap, err := c.Rollback(ctx, id)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("request %d has no snapshot", id)
+		case http.StatusConflict:
+			// a failed restore is the latest entry of the history
+			history, herr := c.History(ctx, id)
+			if herr == nil && len(history) > 0 && history[len(history)-1].Kind == "rollback_failed" {
+				return errors.New(history[len(history)-1].Message)
+			}
+			return errors.New("a request is running; try again once it finishes")
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %s to before request %d\n", snap.Dir, id)
+	return nil
+}
+
+// branchError explains a refused merge or discard
+func branchError(ctx context.Context, c *client.Client, id int64, err error) error {
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	switch apiErr.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Errorf("request %d has no branch", id)
+	case http.StatusBadRequest:
+		return errors.New("the branch has no target; pass -into")
+	case http.StatusConflict:
+		branch, berr := c.Branch(ctx, id)
+		if berr != nil {
+			return err
+		}
+		if branch.State == "open" && branch.Error != "" {
+			return fmt.Errorf("%s: %s", branch.Branch, branch.Error)
+		}
+		return fmt.Errorf("%s is %s", branch.Branch, branchState(branch))
+	}
+	return err
+}
+
+// branchState describes a branch's state with the commit it refers to
+func branchState(b client.Branch) string {
+	switch b.State {
+	case "open", "discarded":
+		return b.State + " " + shortSHA(b.CommitSHA)
+	case "merged":
+		return "merged into " + b.Target + " as " + shortSHA(b.MergeSHA)
+	}
+	return b.State
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 10 {
+		return sha[:10]
+	}
+	return sha
+}
+
+func runSearch(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	page := fs.Int("page", 1, "page number")
+	fs.Parse(args)
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		return errors.New("search: query is required")
+	}
+
+	resp, err := c.Search(ctx, query, *page, 0)
+	if err != nil {
+		return err
+	}
+	for _, hit := range resp.Hits {
+		where := "prompt"
+		if hit.LineNum > 0 {
+			where = fmt.Sprintf("line %d %s", hit.LineNum, hit.LineType)
+		}
+		fmt.Printf("%d\t%s\t%s\n", hit.RequestID, where, oneLine(plainSnippet(hit.Snippet), 100))
+	}
+	if resp.More {
+		fmt.Printf("more results: search -page %d\n", resp.Page+1)
+	}
+	return nil
+}
+
+func runFiles(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("files", flag.ExitOnError)
+	page := fs.Int("page", 1, "page number")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("files: expected exactly one path")
+	}
+
+	resp, err := c.Files(ctx, fs.Arg(0), *page, 0)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tCHANGE\tPATH\tPROMPT")
+	for _, f := range resp.Files {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", f.RequestID, f.Status, fileChange(f.RequestFile), f.Path, oneLine(f.Prompt, 50))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if resp.More {
+		fmt.Printf("more results: files -page %d\n", resp.Page+1)
+	}
+	return nil
+}
+
+// fileChange describes a file's change kind and line counts
+func fileChange(f client.RequestFile) string {
+	if f.Added == 0 && f.Removed == 0 {
+		return f.Kind
+	}
+	return fmt.Sprintf("%s +%d -%d", f.Kind, f.Added, f.Removed)
+}
+
+// plainSnippet drops the <mark> highlighting from an HTML snippet
+func plainSnippet(snippet string) string {
+	snippet = strings.NewReplacer("<mark>", "", "</mark>", "").Replace(snippet)
+	return html.UnescapeString(snippet)
+}
+
+type exportDocument struct {
+	Request client.Request      `json:"request"`
+	Lines   []client.OutputLine `json:"lines"`
+}
+
+func runExport(ctx context.Context, c *client.Client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "json", "output format: json or md")
+	out := fs.String("o", "", "write to file instead of stdout")
+	fs.Parse(args)
+	id, err := parseID(fs)
+	if err != nil {
+		return err
+	}
+	if *format != "json" && *format != "md" {
+		return fmt.Errorf("export: unknown format %q", *format)
+	}
+
+	req, err := c.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	lines, err := allLines(ctx, c, id)
+	if err != nil {
+		return err
+	}
+	// exports carry complete output, not the previews of spilled lines
+	for i, line := range lines {
+		if line.BlobHash == "" {
+			continue
+		}
+		if lines[i].Content, err = c.FullContent(ctx, id, line.LineNum); err != nil {
+			return err
+		}
+		lines[i].BlobHash, lines[i].FullSize = "", 0
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(exportDocument{Request: req, Lines: lines})
+	}
+	return writeMarkdown(w, req, lines)
+}
+
+func writeMarkdown(w io.Writer, req client.Request, lines []client.OutputLine) error {
+	fmt.Fprintf(w, "# Request %d\n\n", req.ID)
+	fmt.Fprintf(w, "- Status: %s\n- Created: %s\n", req.Status, req.CreatedAt)
+	if req.Response != "" {
+		fmt.Fprintf(w, "- Response: %s\n", req.Response)
+	}
+	fmt.Fprintf(w, "\n## Prompt\n\n%s\n\n## Transcript\n", req.Prompt)
+	for _, line := range lines {
+		switch line.LineType {
+		case "message":
+			fmt.Fprintf(w, "\n%s\n", line.Content)
+		case "command":
+			fmt.Fprintf(w, "\n```\n%s\n```\n", line.Content)
+		case "file_change", "todo_list":
+			// stored one entry per line: "kind path" or "[x] text"
+			fmt.Fprintf(w, "\n_%s:_\n\n", line.LineType)
+			for _, entry := range strings.Split(line.Content, "\n") {
+				fmt.Fprintf(w, "- %s\n", entry)
+			}
+		case "tool_call":
+			// stored as a server/tool header, arguments, then the result
+			parts := strings.SplitN(line.Content, "\n", 3)
+			fmt.Fprintf(w, "\n_tool call:_ %s\n", parts[0])
+			for _, part := range parts[1:] {
+				if part != "" {
+					fmt.Fprintf(w, "\n```\n%s\n```\n", part)
+				}
+			}
+		case "web_search":
+			fmt.Fprintf(w, "\n_web search:_ %s\n", line.Content)
+		default:
+			fmt.Fprintf(w, "\n_%s:_ %s\n", line.LineType, line.Content)
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// follow streams lines after the given line number until the request
+// finishes, returning errRequestFailed unless it was processed
+func follow(ctx context.Context, c *client.Client, id int64, after int, printLines bool) error {
+	var final client.Request
+	err := c.StreamEvents(ctx, id, after, func(ev client.Event) error {
+		switch {
+		case ev.Line != nil && printLines:
+			printLine(*ev.Line)
+		case ev.Request != nil:
+			final = *ev.Request
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !final.Finished() {
+		return errors.New("event stream ended before the request finished")
+	}
+	if final.Status != "processed" {
+		msg := final.Status
+		if final.Response != "" {
+			msg += ": " + final.Response
+		}
+		fmt.Fprintf(os.Stderr, "request %d %s\n", id, msg)
+		return errRequestFailed
+	}
+	return nil
+}
+
+func allLines(ctx context.Context, c *client.Client, id int64) ([]client.OutputLine, error) {
+	var lines []client.OutputLine
+	after := 0
+	for {
+		resp, err := c.Lines(ctx, id, after, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Lines) == 0 {
+			return lines, nil
+		}
+		lines = append(lines, resp.Lines...)
+		after = resp.Lines[len(resp.Lines)-1].LineNum
+	}
+}
+
+func printLine(line client.OutputLine) {
+	fmt.Printf("[%s] %s\n", line.LineType, line.Content)
+	if line.BlobHash != "" {
+		fmt.Printf("[%s] ... preview of %d bytes; use export for the full output\n", line.LineType, line.FullSize)
+	}
+}
+
+// oneLine collapses whitespace and truncates s for tabular display
+func oneLine(s string, maxLen int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= maxLen {
+		return s
+	}
+	return s[:maxLen] + "..."
+}
@@ -0,0 +1,145 @@
+// Command codex-launcher is a terminal client for the codex-launcher web API.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"almono/client"
+)
+
+const usage = `usage: codex-launcher [-server URL] <command> [flags] [args]
+
+commands:
+  submit [-wait] [-q] [-project P] [-model M] [-tags a,b] PROMPT
+                               enqueue a request
+  list [-after ID | -before ID] [-page N] [-limit N]
+       [-status S] [-project P] [-model M] [-tag T] [-schedule ID]
+       [-from DATE] [-to DATE]
+       [-sort created|duration|tokens] [-asc]
+                               list requests, newest first
+  show ID                      print a request and its output
+  follow-up [-wait] [-q] [-model M] ID PROMPT
+                               continue a request's codex session
+  thread ID                    list the turns of a request's conversation
+  pipeline [-wait] [-name N] [-project P] [-model M] [-tags a,b] FILE
+                               enqueue the steps in FILE, or stdin for -, one
+                               "name after step, ...: prompt" line each
+  pipeline-show ID             list a pipeline's steps and their status
+  schedule [-name N] [-tz ZONE] [-missed skip|once|all] [-disabled]
+           [-project P] [-model M] [-tags a,b] CRON PROMPT
+                               enqueue PROMPT on a cron schedule, such as
+                               "0 2 * * *" or @weekly
+  schedules                    list schedules and when they next run
+  schedule-enable ID           switch a schedule on
+  schedule-disable ID          switch a schedule off
+  schedule-run ID              enqueue a run of a schedule now
+  schedule-delete ID           remove a schedule; its runs stay
+  tail [-f] [-n N] ID          print the last output lines
+  cancel ID                    cancel a pending or processing request
+  diff ID                      print the workspace diff a run produced
+  merge [-into BRANCH] ID      merge a request's branch, by default into the
+                               branch it started from
+  discard ID                   delete a request's branch unmerged
+  rollback ID                  restore the workdir to its snapshot from before
+                               a request
+  export [-format json|md] [-o FILE] ID
+                               export a request and its full transcript
+  search [-page N] QUERY       search prompts and output
+  files [-page N] PATH         list requests that changed a file, or files
+                               below a directory when PATH ends in /
+
+The server defaults to $CODEX_LAUNCHER_URL or http://127.0.0.1:55136.
+`
+
+// errRequestFailed is returned when a followed request did not finish as processed
+var errRequestFailed = errors.New("request did not complete successfully")
+
+func main() {
+	defaultServer := os.Getenv("CODEX_LAUNCHER_URL")
+	if defaultServer == "" {
+		defaultServer = "http://127.0.0.1:55136"
+	}
+	server := flag.String("server", defaultServer, "codex-launcher web server URL")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	c := client.New(*server, nil)
+	args := flag.Args()[1:]
+	var err error
+	switch flag.Arg(0) {
+	case "submit":
+		err = runSubmit(ctx, c, args)
+	case "list":
+		err = runList(ctx, c, args)
+	case "show":
+		err = runShow(ctx, c, args)
+	case "follow-up":
+		err = runFollowUp(ctx, c, args)
+	case "thread":
+		err = runThread(ctx, c, args)
+	case "pipeline":
+		err = runPipeline(ctx, c, args)
+	case "pipeline-show":
+		err = runPipelineShow(ctx, c, args)
+	case "schedule":
+		err = runSchedule(ctx, c, args)
+	case "schedules":
+		err = runSchedules(ctx, c, args)
+	case "schedule-enable", "schedule-disable", "schedule-run", "schedule-delete":
+		err = runScheduleAction(ctx, c, flag.Arg(0), args)
+	case "tail":
+		err = runTail(ctx, c, args)
+	case "cancel":
+		err = runCancel(ctx, c, args)
+	case "export":
+		err = runExport(ctx, c, args)
+	case "diff":
+		err = runDiff(ctx, c, args)
+	case "merge":
+		err = runMerge(ctx, c, args)
+	case "discard":
+		err = runDiscard(ctx, c, args)
+	case "rollback":
+		err = runRollback(ctx, c, args)
+	case "search":
+		err = runSearch(ctx, c, args)
+	case "files":
+		err = runFiles(ctx, c, args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		if !errors.Is(err, errRequestFailed) {
+			fmt.Fprintf(os.Stderr, "codex-launcher: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// parseID parses the single request ID argument left after flag parsing
+func parseID(fs *flag.FlagSet) (int64, error) {
+	if fs.NArg() != 1 {
+		return 0, fmt.Errorf("%s: expected exactly one request ID", fs.Name())
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid request ID %q", fs.Name(), fs.Arg(0))
+	}
+	return id, nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"almono/api"
+	"almono/core"
+)
+
+type backupFlags struct {
+	dir      *string
+	interval *time.Duration
+	keep     *int
+	compress *bool
+}
+
+func addBackupFlags(fs *flag.FlagSet) backupFlags {
+	return backupFlags{
+		dir:      fs.String("backup-dir", "", "directory for backups (default <db>.backups)"),
+		interval: fs.Duration("backup-interval", 0, "take a backup this often (0 disables scheduled backups)"),
+		keep:     fs.Int("backup-keep", 7, "number of backups kept in the backup directory (0 keeps all)"),
+		compress: fs.Bool("backup-gzip", true, "gzip backups"),
+	}
+}
+
+// backupFunc writes rotated backups of store into the backup directory
+func (f backupFlags) backupFunc(store *api.Store, dbPath string) api.BackupFunc {
+	dir := *f.dir
+	if dir == "" {
+		dir = dbPath + ".backups"
+	}
+	return func(ctx context.Context) (api.BackupInfo, error) {
+		return store.BackupToDir(ctx, dir, *f.compress, *f.keep)
+	}
+}
+
+// start runs scheduled backups until ctx is cancelled
+func (f backupFlags) start(ctx context.Context, store *api.Store, dbPath string) {
+	core.StartBackups(ctx, f.backupFunc(store, dbPath), *f.interval)
+}
+
+// runBackup takes one backup of a live database
+func runBackup(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dbPath := fs.String("db", "db.sqlite3", "sqlite database path")
+	out := fs.String("o", "", "write the backup to this file instead of the rotated backup directory")
+	backups := addBackupFlags(fs)
+	fs.Parse(args)
+
+	store, err := openExistingStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var info api.BackupInfo
+	if *out != "" {
+		info, err = store.Backup(ctx, *out, *backups.compress)
+	} else {
+		info, err = backups.backupFunc(store, *dbPath)(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s (%d bytes, schema version %d)\n", info.Path, info.Size, info.SchemaVersion)
+	return nil
+}
+
+// runRestore replaces the database with a backup. The backup is checked
+// before anything is touched, and the current database is itself backed
+// up first so a restore can be undone. Servers and workers using the
+// database must be stopped.
+func runRestore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbPath := fs.String("db", "db.sqlite3", "sqlite database path")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: restore [-db PATH] BACKUP_FILE")
+	}
+
+	plain, version, cleanup, err := api.CheckBackup(ctx, fs.Arg(0))
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(*dbPath); err == nil {
+		store, err := api.OpenStore(*dbPath)
+		if err != nil {
+			return fmt.Errorf("db open failed: %w", err)
+		}
+		saved := *dbPath + ".pre-restore-" + time.Now().UTC().Format("20060102-150405")
+		_, err = store.Backup(ctx, saved, false)
+		store.Close()
+		if err != nil {
+			return fmt.Errorf("saving current database: %w", err)
+		}
+		fmt.Printf("current database saved to %s\n", saved)
+	}
+
+	if err := copyFile(plain, *dbPath+".restoring"); err != nil {
+		return err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(*dbPath + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(*dbPath+".restoring", *dbPath); err != nil {
+		return err
+	}
+
+	// bring older backups up to this binary's schema right away
+	store, err := openStore(ctx, *dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	current, err := store.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("restored %s (schema version %d, now %d)\n", filepath.Base(fs.Arg(0)), version, current)
+	return nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
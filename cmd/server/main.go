@@ -0,0 +1,313 @@
+// Command codex-launcher-server runs the web server, the worker, or both
+// in one process sharing a single database handle.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"almono/api"
+	"almono/core"
+	"almono/notify"
+	"almono/web"
+)
+
+const usage = `usage: codex-launcher-server <command> [flags]
+
+commands:
+  serve    run the web server
+  worker   run the codex worker
+  all      run the web server and worker in one process
+  migrate  show or change the database schema version
+  prune    apply retention rules once and VACUUM
+  backup   take an online backup of the database
+  restore  replace the database with a backup
+
+Run "codex-launcher-server <command> -h" for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "serve":
+		err = runServe(ctx, os.Args[2:])
+	case "worker":
+		err = runWorker(ctx, os.Args[2:])
+	case "all":
+		err = runAll(ctx, os.Args[2:])
+	case "migrate":
+		err = runMigrate(ctx, os.Args[2:])
+	case "prune":
+		err = runPrune(ctx, os.Args[2:])
+	case "backup":
+		err = runBackup(ctx, os.Args[2:])
+	case "restore":
+		err = runRestore(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
+
+func runServe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	dbPath := fs.String("db", "db.sqlite3", "sqlite database path")
+	addr := fs.String("addr", ":55136", "listen address")
+	wakeWorkers := fs.Bool("notify", true, "wake worker processes over unix sockets when requests are created")
+	retention := addRetentionFlags(fs)
+	backups := addBackupFlags(fs)
+	schedules := addScheduleFlags(fs)
+	fs.Parse(args)
+
+	store, err := openStore(ctx, *dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	svc := api.NewService(store)
+	svc.SetBranches(core.GitBranches{})
+	svc.SetSnapshots(core.Snapshots{Protect: storePaths(*dbPath)})
+	if *wakeWorkers {
+		svc.SetNotifier(notify.NewBroadcaster(notify.DirFor(*dbPath)))
+	}
+	go retention.start(ctx, store)
+	go backups.start(ctx, store, *dbPath)
+	go schedules.start(ctx, svc)
+	admin := api.NewAdminHandler(svc, retention.policy(), backups.backupFunc(store, *dbPath))
+	return serveHTTP(ctx, *addr, svc, admin)
+}
+
+func runWorker(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("worker", flag.ExitOnError)
+	dbPath := fs.String("db", "db.sqlite3", "sqlite database path")
+	workerConfig := addWorkerFlags(fs)
+	listen := fs.Bool("notify", true, "accept wake-ups from web processes over a unix socket")
+	fs.Parse(args)
+
+	store, err := openStore(ctx, *dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	cfg := workerConfig()
+	if cfg.SnapshotDir == "" {
+		cfg.SnapshotDir = *dbPath + ".snapshots"
+	}
+	cfg.SnapshotProtect = storePaths(*dbPath)
+	if *listen {
+		wake := notify.NewChannel()
+		if l := listenForWakeups(*dbPath, wake); l != nil {
+			defer l.Close()
+			cfg.Wake = wake.C()
+		}
+	}
+	core.StartWorker(ctx, store, cfg)
+	return nil
+}
+
+// runAll runs the HTTP server and worker pool on one Store.
+// New requests wake the worker through an in-process channel, and a
+// failure of either half shuts the other down. Worker processes started
+// separately against the same database are still woken over sockets.
+func runAll(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("all", flag.ExitOnError)
+	dbPath := fs.String("db", "db.sqlite3", "sqlite database path")
+	addr := fs.String("addr", ":55136", "listen address")
+	workerConfig := addWorkerFlags(fs)
+	crossProcess := fs.Bool("notify", true, "also exchange wake-ups with other processes over unix sockets")
+	retention := addRetentionFlags(fs)
+	backups := addBackupFlags(fs)
+	schedules := addScheduleFlags(fs)
+	fs.Parse(args)
+
+	store, err := openStore(ctx, *dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	wake := notify.NewChannel()
+	svc := api.NewService(store)
+	svc.SetBranches(core.GitBranches{})
+	svc.SetSnapshots(core.Snapshots{Protect: storePaths(*dbPath)})
+	svc.SetNotifier(wake)
+	if *crossProcess {
+		svc.SetNotifier(notify.Fanout{wake, notify.NewBroadcaster(notify.DirFor(*dbPath))})
+		if l := listenForWakeups(*dbPath, wake); l != nil {
+			defer l.Close()
+		}
+	}
+	cfg := workerConfig()
+	cfg.Wake = wake.C()
+	if cfg.SnapshotDir == "" {
+		cfg.SnapshotDir = *dbPath + ".snapshots"
+	}
+	cfg.SnapshotProtect = storePaths(*dbPath)
+
+	var wg sync.WaitGroup
+	var serveErr error
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		admin := api.NewAdminHandler(svc, retention.policy(), backups.backupFunc(store, *dbPath))
+		serveErr = serveHTTP(ctx, *addr, svc, admin)
+	}()
+	go func() {
+		defer wg.Done()
+		retention.start(ctx, store)
+	}()
+	go func() {
+		defer wg.Done()
+		backups.start(ctx, store, *dbPath)
+	}()
+	go func() {
+		defer wg.Done()
+		schedules.start(ctx, svc)
+	}()
+	go func() {
+		defer wg.Done()
+		defer cancel()
+		core.StartWorker(ctx, store, cfg)
+	}()
+	wg.Wait()
+	return serveErr
+}
+
+func addWorkerFlags(fs *flag.FlagSet) func() core.Config {
+	poll := fs.Duration("poll", 2*time.Second, "worker poll interval")
+	codexBin := fs.String("codex", "codex", "codex binary")
+	codexModel := fs.String("model", "gpt-5.2-codex", "codex model")
+	reasoning := fs.String("reasoning", "high", "codex reasoning effort")
+	workDir := fs.String("workdir", "", "codex workdir")
+	workers := fs.Int("workers", 1, "number of requests processed concurrently")
+	grace := fs.Duration("shutdown-grace", 30*time.Second, "how long in-flight requests may run after a shutdown signal")
+	timeout := fs.Duration("timeout", 0, "kill a codex run that takes longer than this (0 disables)")
+	gitFiles := fs.Bool("git-files", true, "index the files each run changes from a git diff of the workdir")
+	gitDiff := fs.Bool("git-diff", true, "store the git diff of the workdir each run produces")
+	gitBranch := fs.Bool("git-branch", false, "run each request on its own branch of the workdir's repository and commit its changes")
+	gitTarget := fs.String("git-target", "", "branch request branches start from and merge into (default: the workdir's current branch)")
+	publicURL := fs.String("public-url", "http://127.0.0.1:55136", "web address of the server, linked from request commits")
+	snapshot := fs.Bool("snapshot", false, "archive the workdir before each run so it can be rolled back, for workdirs outside git")
+	snapshotDir := fs.String("snapshot-dir", "", "directory snapshots are kept in (default: the database path with .snapshots appended)")
+	snapshotExclude := fs.String("snapshot-exclude", ".git,node_modules", "comma separated globs of paths snapshots leave out and rollbacks leave alone")
+	snapshotMaxMB := fs.Int64("snapshot-max-mb", 200, "skip the snapshot when the workdir's files add up to more than N MiB (0 disables)")
+	snapshotKeep := fs.Int("snapshot-keep", 20, "number of snapshots kept; older ones are deleted")
+	return func() core.Config {
+		return core.Config{
+			PollInterval:     *poll,
+			CodexBin:         *codexBin,
+			CodexModel:       *codexModel,
+			Reasoning:        *reasoning,
+			WorkDir:          *workDir,
+			Workers:          *workers,
+			ShutdownGrace:    *grace,
+			Timeout:          *timeout,
+			GitFiles:         *gitFiles,
+			GitDiff:          *gitDiff,
+			GitBranch:        *gitBranch,
+			GitTarget:        *gitTarget,
+			PublicURL:        *publicURL,
+			Snapshot:         *snapshot,
+			SnapshotDir:      *snapshotDir,
+			SnapshotExclude:  core.ParsePatterns(*snapshotExclude),
+			SnapshotMaxBytes: *snapshotMaxMB * 1024 * 1024,
+			SnapshotKeep:     *snapshotKeep,
+		}
+	}
+}
+
+// listenForWakeups returns nil when the socket cannot be created; the
+// worker then relies on polling alone
+func listenForWakeups(dbPath string, wake *notify.Channel) *notify.Listener {
+	l, err := notify.Listen(notify.DirFor(dbPath), wake)
+	if err != nil {
+		log.Printf("wake-up socket unavailable, polling only: %v", err)
+		return nil
+	}
+	return l
+}
+
+func openStore(ctx context.Context, path string) (*api.Store, error) {
+	store, err := api.OpenStore(path)
+	if err != nil {
+		return nil, fmt.Errorf("db open failed: %w", err)
+	}
+	if err := store.Init(ctx); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("db init failed: %w", err)
+	}
+	return store, nil
+}
+
+// openExistingStore opens the database at path without migrating it, for
+// commands that copy or trim a database another binary may be running
+// against. A missing file is an error rather than a new empty database.
+func openExistingStore(path string) (*api.Store, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("db open failed: %w", err)
+	}
+	store, err := api.OpenStore(path)
+	if err != nil {
+		return nil, fmt.Errorf("db open failed: %w", err)
+	}
+	return store, nil
+}
+
+// storePaths are the files of the database at dbPath that snapshots of a
+// workdir holding it must leave alone
+func storePaths(dbPath string) []string {
+	return core.StorePaths(dbPath, notify.DirFor(dbPath))
+}
+
+// serveHTTP serves until ctx is cancelled, then shuts down gracefully
+func serveHTTP(ctx context.Context, addr string, svc *api.Service, admin http.Handler) error {
+	handler, err := web.NewHandler(svc, admin)
+	if err != nil {
+		return fmt.Errorf("template init failed: %w", err)
+	}
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: handler,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("listening on %s", addr)
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	<-done
+	return nil
+}
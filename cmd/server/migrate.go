@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"almono/api"
+)
+
+const migrateUsage = `usage: codex-launcher-server migrate [-db PATH] status|up|down [-to VERSION]
+
+  status   list migrations and whether each is applied
+  up       apply pending migrations (up to -to, default latest)
+  down     revert migrations (down to -to, default one step)
+`
+
+func runMigrate(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbPath := fs.String("db", "db.sqlite3", "sqlite database path")
+	fs.Usage = func() { fmt.Fprint(os.Stderr, migrateUsage) }
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	action := fs.Arg(0)
+	sub := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	to := sub.Int("to", -1, "target schema version")
+	sub.Parse(fs.Args()[1:])
+
+	store, err := api.OpenStore(*dbPath)
+	if err != nil {
+		return fmt.Errorf("db open failed: %w", err)
+	}
+	defer store.Close()
+
+	switch action {
+	case "status":
+		return printMigrationStatus(ctx, store)
+	case "up":
+		target := *to
+		if target < 0 {
+			target = 0
+		}
+		if err := store.MigrateUp(ctx, target); err != nil {
+			return err
+		}
+	case "down":
+		target := *to
+		if target < 0 {
+			current, err := store.SchemaVersion(ctx)
+			if err != nil {
+				return err
+			}
+			target = current - 1
+		}
+		if err := store.MigrateDown(ctx, target); err != nil {
+			return err
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	return printMigrationStatus(ctx, store)
+}
+
+func printMigrationStatus(ctx context.Context, store *api.Store) error {
+	current, err := store.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	list, err := store.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("schema version %d (binary supports %d)\n", current, api.LatestSchemaVersion())
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, st := range list {
+		applied := "no"
+		if st.Applied {
+			applied = st.AppliedAt
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", st.Version, st.Name, applied)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if current > api.LatestSchemaVersion() {
+		return errors.New("database is newer than this binary; upgrade codex-launcher")
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"almono/api"
+	"almono/core"
+)
+
+type retentionFlags struct {
+	days      *int
+	finalDays *int
+	maxDBMB   *int64
+	interval  *time.Duration
+}
+
+func addRetentionFlags(fs *flag.FlagSet) retentionFlags {
+	return retentionFlags{
+		days:      fs.Int("retain-days", 0, "delete output of requests finished more than N days ago (0 keeps everything)"),
+		finalDays: fs.Int("retain-final-days", 0, "keep only the final message of requests finished more than N days ago"),
+		maxDBMB:   fs.Int64("retain-max-db-mb", 0, "delete output of the oldest requests until the database is at most N MiB"),
+		interval:  fs.Duration("retention-interval", 6*time.Hour, "how often the retention job runs when a retain rule is set"),
+	}
+}
+
+func (f retentionFlags) policy() api.RetentionPolicy {
+	return api.RetentionPolicy{
+		MaxAge:       time.Duration(*f.days) * 24 * time.Hour,
+		FinalOnlyAge: time.Duration(*f.finalDays) * 24 * time.Hour,
+		MaxDBSize:    *f.maxDBMB * 1024 * 1024,
+	}
+}
+
+// start runs the background retention job until ctx is cancelled
+func (f retentionFlags) start(ctx context.Context, store api.RequestStore) {
+	core.StartRetention(ctx, store, f.policy(), *f.interval)
+}
+
+// runPrune applies the retention rules once and reports what was freed
+func runPrune(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	dbPath := fs.String("db", "db.sqlite3", "sqlite database path")
+	retention := addRetentionFlags(fs)
+	fs.Parse(args)
+
+	store, err := openExistingStore(*dbPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	// pruning relies on the current schema but leaves migrating to migrate
+	// and the long-running modes
+	version, err := store.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if version != api.LatestSchemaVersion() {
+		return fmt.Errorf("database is at schema version %d, this binary prunes version %d; run migrate up first", version, api.LatestSchemaVersion())
+	}
+
+	report, err := store.Prune(ctx, retention.policy())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("lines deleted:     %d\n", report.LinesDeleted)
+	fmt.Printf("artifacts deleted: %d\n", report.ArtifactsDeleted)
+	fmt.Printf("blobs deleted:     %d\n", report.BlobsDeleted)
+	fmt.Printf("size:              %d -> %d bytes (%d freed)\n", report.BytesBefore, report.BytesAfter, report.Freed())
+	return nil
+}
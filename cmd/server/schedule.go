@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+	// schedules name IANA time zones, which hosts without zoneinfo lack
+	_ "time/tzdata"
+
+	"almono/api"
+	"almono/core"
+)
+
+type scheduleFlags struct {
+	enabled  *bool
+	interval *time.Duration
+}
+
+func addScheduleFlags(fs *flag.FlagSet) scheduleFlags {
+	return scheduleFlags{
+		enabled:  fs.Bool("schedules", true, "enqueue the runs of cron schedules as they come due"),
+		interval: fs.Duration("schedule-interval", 15*time.Second, "how often the scheduler looks for due schedules"),
+	}
+}
+
+// start runs the scheduler until ctx is cancelled
+func (f scheduleFlags) start(ctx context.Context, svc *api.Service) {
+	if !*f.enabled {
+		return
+	}
+	core.StartScheduler(ctx, svc, *f.interval)
+}
@@ -0,0 +1,33 @@
+package core
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"almono/api"
+)
+
+// StartBackups takes a backup every interval until ctx is cancelled. It
+// returns immediately when interval is 0.
+func StartBackups(ctx context.Context, backup api.BackupFunc, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	log.Printf("backups ready; snapshotting every %s", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := backup(ctx)
+		if err != nil {
+			log.Printf("backup failed: %v", err)
+			continue
+		}
+		log.Printf("backed up schema version %d to %s (%d bytes)", info.SchemaVersion, info.Path, info.Size)
+	}
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"almono/api"
+)
+
+// branchPrefix names request branches, followed by the request ID
+const branchPrefix = "codex/request-"
+
+// identity used for commits when the repository has none configured
+const (
+	commitName  = "codex-launcher"
+	commitEmail = "codex-launcher@localhost"
+)
+
+// runGit runs git in dir and returns its trimmed output. Errors carry
+// git's explanation: the conflicts of a failed merge, or else the last line
+// it wrote.
+func runGit(ctx context.Context, dir string, args ...string) (string, error) {
+	return runGitWith(ctx, dir, nil, "", args...)
+}
+
+// runGitWith is runGit with extra environment and input
+func runGitWith(ctx context.Context, dir string, env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := gitFailure(stderr.String() + string(out)); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func gitFailure(output string) string {
+	var conflicts []string
+	var last string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if strings.HasPrefix(line, "CONFLICT") {
+			conflicts = append(conflicts, line)
+		}
+		last = line
+	}
+	if len(conflicts) > 0 {
+		return strings.Join(conflicts, "; ")
+	}
+	return last
+}
+
+// identityEnv supplies a committer when git has none configured for dir
+func identityEnv(ctx context.Context, dir string) []string {
+	if exec.CommandContext(ctx, "git", "-C", dir, "config", "user.email").Run() == nil {
+		return nil
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=" + commitName, "GIT_AUTHOR_EMAIL=" + commitEmail,
+		"GIT_COMMITTER_NAME=" + commitName, "GIT_COMMITTER_EMAIL=" + commitEmail,
+	}
+}
+
+// worktreePath is where a request's branch is checked out while it runs,
+// inside the repository's git directory
+func worktreePath(ctx context.Context, repoDir, name string) (string, error) {
+	common, err := runGit(ctx, repoDir, "rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(common) {
+		common = filepath.Join(repoDir, common)
+	}
+	return filepath.Join(common, "codex-launcher", name), nil
+}
+
+// startBranch creates the request's branch from target, or from HEAD of
+// the workdir's checkout when target is empty, and checks it out in a
+// worktree of its own so concurrent runs and the checkout itself are left
+// alone. A non-empty from is the commit to start at instead, so a
+// follow-up builds on its parent's unmerged work. It returns the branch
+// and the workdir inside the worktree.
+func startBranch(ctx context.Context, dir string, requestID int64, target, from string) (api.RequestBranch, string, error) {
+	b := api.RequestBranch{RequestID: requestID, Branch: branchPrefix + strconv.FormatInt(requestID, 10), State: api.BranchRunning}
+	var err error
+	if b.RepoDir, err = runGit(ctx, dir, "rev-parse", "--show-toplevel"); err != nil {
+		return b, "", err
+	}
+	prefix, err := runGit(ctx, dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return b, "", err
+	}
+	b.Target = target
+	if b.Target == "" {
+		// a detached checkout leaves the target to be chosen at merge time
+		b.Target, _ = runGit(ctx, dir, "symbolic-ref", "--short", "-q", "HEAD")
+	}
+	base := from
+	if base == "" {
+		base = b.Target
+	}
+	if base == "" {
+		base = "HEAD"
+	}
+	if b.BaseSHA, err = runGit(ctx, dir, "rev-parse", "--verify", base+"^{commit}"); err != nil {
+		return b, "", err
+	}
+
+	wt, err := worktreePath(ctx, b.RepoDir, "request-"+strconv.FormatInt(requestID, 10))
+	if err != nil {
+		return b, "", err
+	}
+	// left behind by a worker that died mid-run
+	_, _ = runGit(ctx, b.RepoDir, "worktree", "remove", "--force", wt)
+	_, _ = runGit(ctx, b.RepoDir, "worktree", "prune")
+	if _, err := runGit(ctx, b.RepoDir, "worktree", "add", "-q", "-B", b.Branch, wt, b.BaseSHA); err != nil {
+		return b, "", err
+	}
+	return b, filepath.Join(wt, prefix), nil
+}
+
+// finishBranch commits everything the run left in the branch's worktree,
+// with the prompt as message and a link back to the request, then removes
+// the worktree. A run without changes deletes its branch.
+func finishBranch(ctx context.Context, b *api.RequestBranch, message, requestURL string) error {
+	wt, err := worktreePath(ctx, b.RepoDir, "request-"+strconv.FormatInt(b.RequestID, 10))
+	if err != nil {
+		return err
+	}
+	if err := commitAll(ctx, wt, b, message, requestURL); err != nil {
+		return err
+	}
+	if _, err := runGit(ctx, b.RepoDir, "worktree", "remove", "--force", wt); err != nil {
+		return err
+	}
+	if b.State == api.BranchEmpty {
+		_, err = runGit(ctx, b.RepoDir, "branch", "-D", b.Branch)
+	}
+	return err
+}
+
+func commitAll(ctx context.Context, wt string, b *api.RequestBranch, message, requestURL string) error {
+	if _, err := runGit(ctx, wt, "add", "-A"); err != nil {
+		return err
+	}
+	if status, err := runGit(ctx, wt, "status", "--porcelain"); err != nil {
+		return err
+	} else if status == "" {
+		b.State = api.BranchEmpty
+		return nil
+	}
+	message = strings.TrimSpace(message) + "\n\nRequest-URL: " + requestURL + "\n"
+	if _, err := runGitWith(ctx, wt, identityEnv(ctx, wt), message, "commit", "-q", "--no-verify", "-F", "-"); err != nil {
+		return err
+	}
+	sha, err := runGit(ctx, wt, "rev-parse", "HEAD")
+	if err != nil {
+		return err
+	}
+	b.CommitSHA, b.State = sha, api.BranchOpen
+	return nil
+}
+
+// GitBranches merges and discards request branches with git. It is used by
+// the server, which shares a host with the worker's repositories.
+type GitBranches struct{}
+
+// Merge merges the branch into target with a merge commit and deletes it.
+// The merge happens in the worktree that has target checked out, or in a
+// temporary one. A conflicting merge is aborted.
+func (GitBranches) Merge(ctx context.Context, b api.RequestBranch, target string) (string, error) {
+	dir, err := checkoutOf(ctx, b.RepoDir, target)
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		dir, err = worktreePath(ctx, b.RepoDir, "merge-"+strconv.FormatInt(b.RequestID, 10))
+		if err != nil {
+			return "", err
+		}
+		_, _ = runGit(ctx, b.RepoDir, "worktree", "remove", "--force", dir)
+		if _, err := runGit(ctx, b.RepoDir, "worktree", "add", "-q", dir, target); err != nil {
+			return "", err
+		}
+		defer func() {
+			_, _ = runGit(ctx, b.RepoDir, "worktree", "remove", "--force", dir)
+		}()
+	}
+
+	message := fmt.Sprintf("Merge %s into %s", b.Branch, target)
+	if _, err := runGitWith(ctx, dir, identityEnv(ctx, dir), "", "merge", "-q", "--no-ff", "--no-verify", "-m", message, b.Branch); err != nil {
+		_, _ = runGit(ctx, dir, "merge", "--abort")
+		return "", err
+	}
+	sha, err := runGit(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	_, _ = runGit(ctx, b.RepoDir, "branch", "-D", b.Branch)
+	return sha, nil
+}
+
+// Discard deletes the branch. One that is already gone counts as deleted.
+func (GitBranches) Discard(ctx context.Context, b api.RequestBranch) error {
+	if _, err := runGit(ctx, b.RepoDir, "rev-parse", "--verify", "-q", "refs/heads/"+b.Branch); err != nil {
+		return nil
+	}
+	_, err := runGit(ctx, b.RepoDir, "branch", "-D", b.Branch)
+	return err
+}
+
+// checkoutOf returns the worktree that has branch checked out, or "" when
+// none has
+func checkoutOf(ctx context.Context, repoDir, branch string) (string, error) {
+	out, err := runGit(ctx, repoDir, "worktree", "list", "--porcelain")
+	if err != nil {
+		return "", err
+	}
+	var dir string
+	for _, line := range strings.Split(out, "\n") {
+		if path, ok := strings.CutPrefix(line, "worktree "); ok {
+			dir = path
+		} else if line == "branch refs/heads/"+branch {
+			return dir, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"almono/api"
+)
+
+// maxDiffSize is the largest workspace diff stored for a request; larger
+// diffs keep only the files that fit
+const maxDiffSize = 8 << 20
+
+// gitSnapshot records the working tree of the repository containing dir,
+// untracked files included, as a tree object and returns its hash. A copy
+// of the index is used so the repository's staging area is left alone.
+func gitSnapshot(ctx context.Context, dir string) (string, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--git-path", "index").Output()
+	if err != nil {
+		return "", err
+	}
+	index := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(index) {
+		index = filepath.Join(dir, index)
+	}
+	tmp, err := os.MkdirTemp("", "codex-launcher-index-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	tmpIndex := filepath.Join(tmp, "index")
+	// starting from the real index lets git skip hashing unchanged files
+	if data, err := os.ReadFile(index); err == nil {
+		if err := os.WriteFile(tmpIndex, data, 0o600); err != nil {
+			return "", err
+		}
+	}
+
+	env := append(os.Environ(), "GIT_INDEX_FILE="+tmpIndex)
+	add := exec.CommandContext(ctx, "git", "-C", dir, "add", "-A")
+	add.Env = env
+	if err := add.Run(); err != nil {
+		return "", err
+	}
+	write := exec.CommandContext(ctx, "git", "-C", dir, "write-tree")
+	write.Env = env
+	out, err = write.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// gitChanges lists the paths below dir that differ between two snapshots,
+// relative to dir, with their kind and line counts
+func gitChanges(ctx context.Context, dir, from, to string) ([]api.RequestFile, error) {
+	out, err := exec.CommandContext(ctx, "git", "-C", dir, "diff", "--no-renames", "--relative", "--raw", "--numstat", "-z", from, to).Output()
+	if err != nil {
+		return nil, err
+	}
+	changes := map[string]api.RequestFile{}
+	tokens := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		if raw, ok := strings.CutPrefix(token, ":"); ok && i+1 < len(tokens) {
+			// :old-mode new-mode old-hash new-hash STATUS, then the path
+			fields := strings.Fields(raw)
+			i++
+			f := changes[tokens[i]]
+			f.Path, f.Kind = tokens[i], gitKind(fields[len(fields)-1])
+			changes[f.Path] = f
+			continue
+		}
+		// added, removed and path; binary files show "-" counts
+		parts := strings.SplitN(token, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		f := changes[parts[2]]
+		f.Path = parts[2]
+		f.Added, _ = strconv.Atoi(parts[0])
+		f.Removed, _ = strconv.Atoi(parts[1])
+		changes[f.Path] = f
+	}
+
+	files := make([]api.RequestFile, 0, len(changes))
+	for _, f := range changes {
+		files = append(files, f)
+	}
+	slices.SortFunc(files, func(a, b api.RequestFile) int { return strings.Compare(a.Path, b.Path) })
+	return files, nil
+}
+
+func gitKind(status string) string {
+	switch {
+	case strings.HasPrefix(status, "A"):
+		return api.FileAdded
+	case strings.HasPrefix(status, "D"):
+		return api.FileDeleted
+	}
+	return api.FileUpdated
+}
+
+// gitPatch returns the unified diff below dir between two snapshots, with
+// paths relative to dir. Binary changes are included and user diff
+// settings that change the format are overridden, so the patch applies
+// with git apply.
+func gitPatch(ctx context.Context, dir, from, to string) (string, error) {
+	out, err := exec.CommandContext(
+		ctx, "git", "-C", dir, "diff",
+		"--no-renames", "--relative", "--binary", "--no-color", "--no-ext-diff", "--no-textconv",
+		"--src-prefix=a/", "--dst-prefix=b/",
+		from, to,
+	).Output()
+	return string(out), err
+}
+
+// truncatePatch cuts patch to the whole files that fit in max bytes, so
+// what is kept still applies. When the first file alone is larger, only
+// its header is kept: it names the file but none of its changes. When not
+// even that fits, it returns "" and the patch is not worth storing.
+func truncatePatch(patch string, max int) (string, bool) {
+	if len(patch) <= max {
+		return patch, false
+	}
+	// the next file may start right at max, so only its newline has to fit
+	const next = "\ndiff --git "
+	if cut := strings.LastIndex(patch[:min(len(patch), max-1+len(next))], next); cut >= 0 {
+		return patch[:cut+1], true
+	}
+	end := -1
+	for _, marker := range []string{"\n@@ ", "\nGIT binary patch\n", "\nBinary files "} {
+		if i := strings.Index(patch, marker); i >= 0 && (end < 0 || i < end) {
+			end = i
+		}
+	}
+	if end < 0 || end+1 > max {
+		return "", true
+	}
+	return patch[:end+1], true
+}
+
+// relativePath makes a path codex reported relative to dir when it lies
+// inside it
+func relativePath(dir, path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.ToSlash(filepath.Clean(path))
+	}
+	base, err := filepath.Abs(dir)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(base, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.ToSlash(path)
+	}
+	return filepath.ToSlash(rel)
+}
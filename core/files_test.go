@@ -0,0 +1,57 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncatePatch(t *testing.T) {
+	const (
+		first = "diff --git a/a.go b/a.go\n" +
+			"index 1111111..2222222 100644\n" +
+			"--- a/a.go\n" +
+			"+++ b/a.go\n" +
+			"@@ -1 +1 @@\n" +
+			"-old\n" +
+			"+new\n"
+		second = "diff --git a/b.go b/b.go\n" +
+			"new file mode 100644\n" +
+			"--- /dev/null\n" +
+			"+++ b/b.go\n" +
+			"@@ -0,0 +1 @@\n" +
+			"+added\n"
+		binary = "diff --git a/logo.png b/logo.png\n" +
+			"index 3333333..4444444 100644\n" +
+			"GIT binary patch\n" +
+			"literal 5\n" +
+			"McmZQzWMT#Y01&Jl\n"
+	)
+	firstHeader := first[:strings.Index(first, "@@")]
+	tests := []struct {
+		name      string
+		patch     string
+		max       int
+		want      string
+		truncated bool
+	}{
+		{"fits", first + second, len(first + second), first + second, false},
+		{"keeps whole files", first + second, len(first) + 10, first, true},
+		{"cut right after a file", first + second + binary, len(first + second), first + second, true},
+		{"first file too large keeps its header", first + second, len(first) - 1, firstHeader, true},
+		{"header only just fits", first, len(firstHeader), firstHeader, true},
+		{"binary file keeps its header", binary, len(binary) - 1, binary[:strings.Index(binary, "GIT binary")], true},
+		{"not even the header fits", first, len(firstHeader) - 1, "", true},
+		{"one long line", strings.Repeat("x", 100), 10, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, truncated := truncatePatch(tt.patch, tt.max)
+			if got != tt.want || truncated != tt.truncated {
+				t.Errorf("truncatePatch returned %q, %v; want %q, %v", got, truncated, tt.want, tt.truncated)
+			}
+			if len(got) > tt.max {
+				t.Errorf("kept %d bytes, more than %d", len(got), tt.max)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"almono/api"
+)
+
+const (
+	// ingestBatchSize flushes the buffer once this many lines are waiting
+	ingestBatchSize = 64
+	// ingestFlushInterval bounds how long a line waits before it is visible
+	ingestFlushInterval = 250 * time.Millisecond
+)
+
+// lineBuffer groups output lines into one transaction per batch instead of
+// one autocommit insert per line. A batch is written when it is full or
+// ingestFlushInterval after its first line, whichever comes first.
+type lineBuffer struct {
+	ctx   context.Context
+	store api.RequestStore
+
+	mu      sync.Mutex
+	pending []api.OutputLine
+	timer   *time.Timer
+}
+
+// newLineBuffer writes with a context detached from ctx's cancellation so
+// lines produced just before a kill are still stored
+func newLineBuffer(ctx context.Context, store api.RequestStore) *lineBuffer {
+	return &lineBuffer{
+		ctx:     context.WithoutCancel(ctx),
+		store:   store,
+		pending: make([]api.OutputLine, 0, ingestBatchSize),
+	}
+}
+
+func (b *lineBuffer) Add(requestID int64, lineNum int, lineType, content string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, api.OutputLine{
+		RequestID: requestID,
+		LineNum:   lineNum,
+		LineType:  lineType,
+		Content:   content,
+	})
+	if len(b.pending) >= ingestBatchSize {
+		b.flushLocked()
+		return
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(ingestFlushInterval, b.Flush)
+	}
+}
+
+// Flush writes any buffered lines now
+func (b *lineBuffer) Flush() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.flushLocked()
+}
+
+func (b *lineBuffer) flushLocked() {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if len(b.pending) == 0 {
+		return
+	}
+	if err := b.store.AddOutputLines(b.ctx, b.pending); err != nil {
+		log.Printf("failed to store %d output lines: %v", len(b.pending), err)
+	}
+	b.pending = b.pending[:0]
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"almono/api"
+)
+
+// openTestStore opens the SQLite database at path and migrates it
+func openTestStore(t testing.TB, path string) *api.Store {
+	t.Helper()
+	store, err := api.OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	if err := store.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func lineContent(requestID int64, lineNum int) string {
+	return fmt.Sprintf("request %d line %d", requestID, lineNum)
+}
+
+// TestIngestConcurrentWritersAndReaders runs several workers writing output
+// through their line buffers while a second store on the same file, as the
+// web server holds, follows every request. Readers must only ever see a
+// gap-free prefix of each request's lines, and every line must be stored.
+func TestIngestConcurrentWritersAndReaders(t *testing.T) {
+	const (
+		workers = 6
+		lines   = 150
+	)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.sqlite3")
+	worker := openTestStore(t, path)
+	web := openTestStore(t, path)
+
+	ids := make([]int64, workers)
+	for i := range ids {
+		req, err := web.CreateRequest(ctx, api.NewRequest{Prompt: fmt.Sprintf("stress %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = req.ID
+	}
+
+	done := make(chan struct{})
+	var writers, readers sync.WaitGroup
+	for i, id := range ids {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			buf := newLineBuffer(ctx, worker)
+			defer buf.Flush()
+			for n := 1; n <= lines; n++ {
+				buf.Add(id, n, "agent_message", lineContent(id, n))
+				// every other worker also bumps usage, so single-row writes
+				// contend with the batches
+				if i%2 == 0 && n%25 == 0 {
+					if err := worker.AddUsage(ctx, id, 1, 1); err != nil {
+						t.Errorf("AddUsage: %v", err)
+					}
+				}
+			}
+		}()
+	}
+
+	for _, id := range ids {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			after := 0
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				got, err := web.GetOutputLinesAfter(ctx, id, after, 50)
+				if err != nil {
+					t.Errorf("GetOutputLinesAfter(%d): %v", id, err)
+					return
+				}
+				if len(got) == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				for _, line := range got {
+					if line.LineNum != after+1 {
+						t.Errorf("request %d: read line %d after %d", id, line.LineNum, after)
+						return
+					}
+					if line.Content != lineContent(id, line.LineNum) {
+						t.Errorf("request %d line %d: content %q", id, line.LineNum, line.Content)
+						return
+					}
+					after = line.LineNum
+				}
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(done)
+	readers.Wait()
+
+	for i, id := range ids {
+		stored, err := web.GetOutputLines(ctx, id, lines+1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total, err := web.CountOutputLines(ctx, id, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != lines || len(stored) != lines {
+			t.Fatalf("request %d: stored %d lines (total %d), want %d", id, len(stored), total, lines)
+		}
+		// newest first
+		for n, line := range stored {
+			if want := lines - n; line.LineNum != want || line.Content != lineContent(id, want) {
+				t.Fatalf("request %d: line %d is #%d %q", id, want, line.LineNum, line.Content)
+			}
+		}
+		req, _, err := web.GetRequest(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := int64(0)
+		if i%2 == 0 {
+			want = lines / 25
+		}
+		if req.InputTokens != want {
+			t.Errorf("request %d: %d input tokens, want %d", id, req.InputTokens, want)
+		}
+	}
+}
+
+// benchmarkRequest opens a fresh store holding one request to write to
+func benchmarkRequest(b *testing.B) (*api.Store, int64) {
+	b.Helper()
+	store := openTestStore(b, filepath.Join(b.TempDir(), "db.sqlite3"))
+	req, err := store.CreateRequest(context.Background(), api.NewRequest{Prompt: "benchmark"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return store, req.ID
+}
+
+// BenchmarkIngestBatched writes lines the way the worker does, through a
+// lineBuffer that commits them in batches
+func BenchmarkIngestBatched(b *testing.B) {
+	store, id := benchmarkRequest(b)
+	buf := newLineBuffer(context.Background(), store)
+	b.ResetTimer()
+	for n := 1; n <= b.N; n++ {
+		buf.Add(id, n, "agent_message", lineContent(id, n))
+	}
+	buf.Flush()
+}
+
+// BenchmarkIngestPerLine writes every line in its own transaction, as
+// before lines were batched
+func BenchmarkIngestPerLine(b *testing.B) {
+	ctx := context.Background()
+	store, id := benchmarkRequest(b)
+	b.ResetTimer()
+	for n := 1; n <= b.N; n++ {
+		if err := store.AddOutputLine(ctx, id, n, "agent_message", lineContent(id, n)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
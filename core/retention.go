@@ -0,0 +1,41 @@
+package core
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"almono/api"
+)
+
+// StartRetention prunes output according to policy every interval until
+// ctx is cancelled. It returns immediately when the policy is empty.
+func StartRetention(ctx context.Context, store api.RequestStore, policy api.RetentionPolicy, interval time.Duration) {
+	if policy.Empty() || interval <= 0 {
+		return
+	}
+	log.Printf("retention ready; pruning every %s", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report, err := store.Prune(ctx, policy)
+		if err != nil {
+			log.Printf("retention prune failed: %v", err)
+			continue
+		}
+		LogPruneReport(report)
+	}
+}
+
+// LogPruneReport writes a one-line summary of a prune run
+func LogPruneReport(report api.PruneReport) {
+	log.Printf(
+		"pruned %d lines, %d artifacts and %d blobs; freed %d bytes (%d -> %d)",
+		report.LinesDeleted, report.ArtifactsDeleted, report.BlobsDeleted, report.Freed(), report.BytesBefore, report.BytesAfter,
+	)
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"almono/api"
+)
+
+// StartScheduler enqueues the runs of due schedules every interval until
+// ctx is cancelled. Several schedulers may share a database; each slot is
+// only enqueued once.
+func StartScheduler(ctx context.Context, svc *api.Service, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	log.Printf("scheduler ready; checking schedules every %s", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := svc.RunDueSchedules(ctx, time.Now())
+		if err != nil {
+			log.Printf("scheduler failed: %v", err)
+		}
+		if n > 0 {
+			log.Printf("scheduler enqueued %d requests", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
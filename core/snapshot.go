@@ -0,0 +1,418 @@
+package core
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"almono/api"
+)
+
+// snapshotPrefix names snapshot tarballs, followed by the request ID
+const snapshotPrefix = "request-"
+
+// snapshotEntry is a path of the workdir to put in a snapshot
+type snapshotEntry struct {
+	path string
+	rel  string
+	info fs.FileInfo
+}
+
+// takeSnapshot archives dir as a gzipped tarball at dest. Paths matching
+// exclude and the absolute paths in skip are left out. A tree whose files
+// add up to more than max bytes is refused before anything is written; 0
+// means no limit.
+func takeSnapshot(ctx context.Context, dir, dest string, skip, exclude []string, max int64) (api.RequestSnapshot, error) {
+	snap := api.RequestSnapshot{Path: dest, Exclude: exclude}
+	var err error
+	if snap.Dir, err = filepath.Abs(dir); err != nil {
+		return snap, err
+	}
+	entries, size, err := snapshotEntries(snap.Dir, skip, exclude)
+	if err != nil {
+		return snap, err
+	}
+	if max > 0 && size > max {
+		return snap, fmt.Errorf("workdir holds %s, more than the %s limit", formatBytes(size), formatBytes(max))
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return snap, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".snapshot-*")
+	if err != nil {
+		return snap, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	gz := gzip.NewWriter(tmp)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return snap, err
+		}
+		if err := addToTar(tw, e); err != nil {
+			return snap, err
+		}
+		if e.info.Mode().IsRegular() {
+			snap.Files++
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return snap, err
+	}
+	if err := gz.Close(); err != nil {
+		return snap, err
+	}
+	if err := tmp.Close(); err != nil {
+		return snap, err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return snap, err
+	}
+	info, err := os.Stat(dest)
+	if err != nil {
+		return snap, err
+	}
+	snap.Size = info.Size()
+	return snap, nil
+}
+
+// snapshotEntries walks dir without following symlinks and returns what a
+// snapshot keeps, with the total size of its regular files
+func snapshotEntries(dir string, skip, exclude []string) ([]snapshotEntry, int64, error) {
+	var entries []snapshotEntry
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if slices.Contains(skip, path) || excluded(rel, exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case info.Mode().IsRegular():
+			size += info.Size()
+		case info.IsDir(), info.Mode()&fs.ModeSymlink != 0:
+		default:
+			// sockets, pipes and devices are not restorable
+			return nil
+		}
+		entries = append(entries, snapshotEntry{path: path, rel: rel, info: info})
+		return nil
+	})
+	return entries, size, err
+}
+
+func addToTar(tw *tar.Writer, e snapshotEntry) error {
+	var link string
+	if e.info.Mode()&fs.ModeSymlink != 0 {
+		var err error
+		if link, err = os.Readlink(e.path); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(e.info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = e.rel
+	if e.info.IsDir() {
+		hdr.Name += "/"
+	}
+	// owners are not restored, so names and IDs are left out
+	hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !e.info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(e.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
+
+// ParsePatterns splits a comma separated list of exclude globs
+func ParsePatterns(list string) []string {
+	var patterns []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// excluded reports whether rel, a slash-separated path relative to the
+// workdir, matches one of the glob patterns. Patterns without a slash match
+// the base name at any depth.
+func excluded(rel string, exclude []string) bool {
+	for _, pattern := range exclude {
+		name := rel
+		if !strings.Contains(pattern, "/") {
+			name = rel[strings.LastIndexByte(rel, '/')+1:]
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Snapshots restores workdirs from the snapshots taken before requests. It
+// is used by the server, which shares a host with the worker's workdir.
+// Protect lists absolute paths, such as the database's files, that a
+// restore never removes or overwrites.
+type Snapshots struct {
+	Protect []string
+}
+
+// Restore puts the snapshot's directory back the way it was: files the
+// snapshot holds are rewritten and everything else is removed, except
+// paths matching the snapshot's exclude patterns and protected paths.
+// ctx is only checked before the workdir is touched; once files are being
+// removed the restore runs to the end, since stopping would leave the
+// workdir half restored.
+func (s Snapshots) Restore(ctx context.Context, snap api.RequestSnapshot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	kinds, err := snapshotKinds(snap.Path)
+	if err != nil {
+		return err
+	}
+	// the tarball may have been kept inside the directory it restores
+	tarball, _ := filepath.Abs(snap.Path)
+	skip := append([]string{filepath.Dir(tarball)}, s.Protect...)
+	if err := removeExtra(snap.Dir, skip, snap.Exclude, kinds); err != nil {
+		return err
+	}
+	return extractSnapshot(snap.Path, snap.Dir, skip)
+}
+
+// StorePaths are the database file at dbPath, its journals and the socket
+// directory beside it: what snapshots and rollbacks must leave alone when
+// the database sits in the workdir
+func StorePaths(dbPath, notifyDir string) []string {
+	db, _ := filepath.Abs(dbPath)
+	notify, _ := filepath.Abs(notifyDir)
+	return []string{db, db + "-wal", db + "-shm", db + "-journal", notify}
+}
+
+// snapshotKinds reads the paths a snapshot holds with their file type
+func snapshotKinds(path string) (map[string]byte, error) {
+	kinds := map[string]byte{}
+	err := readSnapshot(path, func(hdr *tar.Header, _ io.Reader) error {
+		kinds[strings.TrimSuffix(hdr.Name, "/")] = hdr.Typeflag
+		return nil
+	})
+	return kinds, err
+}
+
+// removeExtra deletes what dir holds that the snapshot does not, or holds
+// as a different type of file
+func removeExtra(dir string, skip, exclude []string, kinds map[string]byte) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if slices.Contains(skip, path) || excluded(rel, exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		kind, ok := kinds[rel]
+		if ok && kind == tarType(d.Type()) {
+			return nil
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+func tarType(mode fs.FileMode) byte {
+	switch {
+	case mode.IsDir():
+		return tar.TypeDir
+	case mode&fs.ModeSymlink != 0:
+		return tar.TypeSymlink
+	case mode.IsRegular():
+		return tar.TypeReg
+	}
+	return 0
+}
+
+// extractSnapshot writes the snapshot's entries below dir, passing over
+// the paths in skip and anything below them. Names that would leave dir
+// are refused.
+func extractSnapshot(path, dir string, skip []string) error {
+	return readSnapshot(path, func(hdr *tar.Header, r io.Reader) error {
+		name := filepath.FromSlash(strings.TrimSuffix(hdr.Name, "/"))
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("snapshot entry %q is outside the workdir", hdr.Name)
+		}
+		target := filepath.Join(dir, name)
+		if underAny(target, skip) {
+			return nil
+		}
+		mode := fs.FileMode(hdr.Mode).Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			return os.Chmod(target, mode|0o700)
+		case tar.TypeSymlink:
+			if current, err := os.Readlink(target); err == nil && current == hdr.Linkname {
+				return nil
+			}
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+			return os.Symlink(hdr.Linkname, target)
+		case tar.TypeReg:
+			if err := writeFile(target, r, mode); err != nil {
+				return err
+			}
+			return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+		return nil
+	})
+}
+
+// underAny reports whether path is one of roots or lies below one
+func underAny(path string, roots []string) bool {
+	for _, root := range roots {
+		if path == root || strings.HasPrefix(path, root+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeFile(path string, r io.Reader, mode fs.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// readSnapshot calls fn with each entry of a snapshot tarball
+func readSnapshot(path string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(hdr, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// snapshotPath is where the snapshot taken before a request is kept
+func snapshotPath(dir string, requestID int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%010d.tar.gz", snapshotPrefix, requestID))
+}
+
+// pruneSnapshots removes all but the newest keep snapshots in dir and
+// forgets the requests they belonged to
+func pruneSnapshots(ctx context.Context, store api.RequestStore, dir string, keep int) {
+	names, err := filepath.Glob(filepath.Join(dir, snapshotPrefix+"*.tar.gz"))
+	if err != nil || len(names) <= keep {
+		return
+	}
+	// zero-padded IDs sort oldest first
+	slices.Sort(names)
+	for _, name := range names[:len(names)-keep] {
+		id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(name), snapshotPrefix), ".tar.gz"), 10, 64)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(name); err != nil {
+			log.Printf("removing snapshot failed: %v", err)
+			continue
+		}
+		if err := store.DeleteSnapshot(ctx, id); err != nil {
+			log.Printf("worker snapshot update failed: %v", err)
+		}
+	}
+}
+
+// formatBytes renders a size in the largest whole unit
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSnapshotLeavesStoreAlone keeps a database inside the workdir and
+// checks neither a snapshot nor a rollback touches its files, even when
+// restoring an older snapshot that holds them
+func TestSnapshotLeavesStoreAlone(t *testing.T) {
+	ctx := context.Background()
+	work := t.TempDir()
+	dbPath := filepath.Join(work, "db.sqlite3")
+	protect := StorePaths(dbPath, dbPath+".notify")
+	write := func(rel, content string) {
+		t.Helper()
+		path := filepath.Join(work, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(rel string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(work, rel))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	storeFiles := []string{"db.sqlite3", "db.sqlite3-wal", "db.sqlite3-shm", "db.sqlite3.notify/worker.sock"}
+	write("notes.txt", "before")
+	for _, rel := range storeFiles {
+		write(rel, "old")
+	}
+	snapDir := filepath.Join(work, "db.sqlite3.snapshots")
+
+	snap, err := takeSnapshot(ctx, work, snapshotPath(snapDir, 1), append([]string{snapDir}, protect...), nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds, err := snapshotKinds(snap.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rel := range append(storeFiles, "db.sqlite3.notify") {
+		if _, ok := kinds[rel]; ok {
+			t.Errorf("snapshot holds %s", rel)
+		}
+	}
+	if _, ok := kinds["notes.txt"]; !ok {
+		t.Errorf("snapshot is missing notes.txt: %v", kinds)
+	}
+	// an archive taken without protection, as older workers did
+	unprotected, err := takeSnapshot(ctx, work, snapshotPath(snapDir, 2), []string{snapDir}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []struct {
+		name string
+		path string
+	}{{"protected", snap.Path}, {"unprotected", unprotected.Path}} {
+		write("notes.txt", "after")
+		write("extra.txt", "new")
+		for _, rel := range storeFiles {
+			write(rel, "live")
+		}
+		restore := snap
+		restore.Path = s.path
+		if err := (Snapshots{Protect: protect}).Restore(ctx, restore); err != nil {
+			t.Fatalf("%s: %v", s.name, err)
+		}
+		if got := read("notes.txt"); got != "before" {
+			t.Errorf("%s: notes.txt is %q after the rollback", s.name, got)
+		}
+		if _, err := os.Stat(filepath.Join(work, "extra.txt")); !os.IsNotExist(err) {
+			t.Errorf("%s: extra.txt survived the rollback: %v", s.name, err)
+		}
+		for _, rel := range storeFiles {
+			if got := read(rel); got != "live" {
+				t.Errorf("%s: %s is %q after the rollback", s.name, rel, got)
+			}
+		}
+	}
+}
+
+// goneCtx is cancelled the moment Restore first looks at it, as when the
+// client disconnects just as the rollback starts
+type goneCtx struct {
+	context.Context
+	cancel context.CancelFunc
+}
+
+func (c goneCtx) Err() error {
+	err := c.Context.Err()
+	c.cancel()
+	return err
+}
+
+// TestRestoreFinishesWhenCancelled checks a restore that has begun runs
+// to the end when its context is cancelled, and one cancelled before it
+// begins leaves the workdir untouched
+func TestRestoreFinishesWhenCancelled(t *testing.T) {
+	work := t.TempDir()
+	snapDir := t.TempDir()
+	for i := range 50 {
+		if err := os.WriteFile(filepath.Join(work, fmt.Sprintf("file%02d.txt", i)), []byte("before"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snap, err := takeSnapshot(context.Background(), work, snapshotPath(snapDir, 1), []string{snapDir}, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := func() {
+		t.Helper()
+		for i := range 50 {
+			if err := os.WriteFile(filepath.Join(work, fmt.Sprintf("file%02d.txt", i)), []byte("after"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := os.WriteFile(filepath.Join(work, "extra.txt"), []byte("new"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(want string, extra bool) {
+		t.Helper()
+		for i := range 50 {
+			data, err := os.ReadFile(filepath.Join(work, fmt.Sprintf("file%02d.txt", i)))
+			if err != nil || string(data) != want {
+				t.Fatalf("file%02d.txt is %q (%v), want %q", i, data, err, want)
+			}
+		}
+		if _, err := os.Stat(filepath.Join(work, "extra.txt")); (err == nil) != extra {
+			t.Errorf("extra.txt exists: %v, want %v", err == nil, extra)
+		}
+	}
+
+	change()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (Snapshots{}).Restore(ctx, snap); !errors.Is(err, context.Canceled) {
+		t.Errorf("restoring with a cancelled context returned %v", err)
+	}
+	check("after", true)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	if err := (Snapshots{}).Restore(goneCtx{ctx, cancel}, snap); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("the context was never cancelled")
+	}
+	check("before", false)
+}
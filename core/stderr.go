@@ -0,0 +1,64 @@
+package core
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// stderrTailLines is how many trailing stderr lines a failure keeps
+const stderrTailLines = 20
+
+// tailWriter passes writes through to w and keeps the last max lines
+type tailWriter struct {
+	w       io.Writer
+	max     int
+	mu      sync.Mutex
+	lines   []string
+	partial []byte
+}
+
+func newTailWriter(w io.Writer, max int) *tailWriter {
+	return &tailWriter{w: w, max: max}
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.partial = append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(t.partial, '\n')
+		if i < 0 {
+			break
+		}
+		t.add(string(t.partial[:i]))
+		t.partial = t.partial[i+1:]
+	}
+	t.mu.Unlock()
+	return t.w.Write(p)
+}
+
+func (t *tailWriter) add(line string) {
+	line = strings.TrimRight(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+// Lines returns the kept lines, including an unterminated last line
+func (t *tailWriter) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := append([]string(nil), t.lines...)
+	if last := strings.TrimSpace(string(t.partial)); last != "" {
+		lines = append(lines, last)
+		if len(lines) > t.max {
+			lines = lines[1:]
+		}
+	}
+	return lines
+}
@@ -2,13 +2,20 @@ package core
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"almono/api"
@@ -16,9 +23,17 @@ import (
 
 // codex JSON event types
 type codexEvent struct {
-	Type   string          `json:"type"`
-	Item   json.RawMessage `json:"item,omitempty"`
-	Usage  *usageInfo      `json:"usage,omitempty"`
+	Type    string          `json:"type"`
+	Item    json.RawMessage `json:"item,omitempty"`
+	Usage   *usageInfo      `json:"usage,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Error   *errorInfo      `json:"error,omitempty"`
+	// thread.started names the session follow-ups resume
+	ThreadID string `json:"thread_id,omitempty"`
+}
+
+type errorInfo struct {
+	Message string `json:"message"`
 }
 
 type itemInfo struct {
@@ -29,6 +44,31 @@ type itemInfo struct {
 	AggregatedOutput string `json:"aggregated_output,omitempty"`
 	ExitCode         *int   `json:"exit_code,omitempty"`
 	Status           string `json:"status,omitempty"`
+	// file_change
+	Changes []api.FileChange `json:"changes,omitempty"`
+	// mcp_tool_call
+	Server    string          `json:"server,omitempty"`
+	Tool      string          `json:"tool,omitempty"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Result    *toolResult     `json:"result,omitempty"`
+	Error     *errorInfo      `json:"error,omitempty"`
+	// web_search
+	Query string `json:"query,omitempty"`
+	// todo_list
+	Items []todoInfo `json:"items,omitempty"`
+}
+
+type toolResult struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text,omitempty"`
+	} `json:"content"`
+	StructuredContent json.RawMessage `json:"structured_content,omitempty"`
+}
+
+type todoInfo struct {
+	Text      string `json:"text"`
+	Completed bool   `json:"completed"`
 }
 
 type usageInfo struct {
@@ -43,9 +83,53 @@ type Config struct {
 	CodexModel   string
 	Reasoning    string
 	WorkDir      string
+	// Workers is the number of requests processed concurrently
+	Workers int
+	// Wake interrupts the idle wait so new requests are claimed immediately
+	Wake <-chan struct{}
+	// ShutdownGrace is how long an in-flight request may keep running
+	// after ctx is cancelled before it is killed
+	ShutdownGrace time.Duration
+	// Timeout kills a run that takes longer; 0 means no limit
+	Timeout time.Duration
+	// GitFiles records the files a run changed, with line counts, from a
+	// git diff of WorkDir before and after it
+	GitFiles bool
+	// GitDiff stores that diff as the request's diff artifact
+	GitDiff bool
+	// GitBranch runs each request on a branch of its own, created from
+	// GitTarget or the workdir's current branch, and commits the result
+	GitBranch bool
+	GitTarget string
+	// PublicURL is the web address commits link their request under
+	PublicURL string
+	// Snapshot archives WorkDir before each run so it can be rolled back,
+	// for workdirs that are not git repositories. Paths matching
+	// SnapshotExclude are left out; a workdir larger than SnapshotMaxBytes
+	// is not archived. The newest SnapshotKeep archives are kept in
+	// SnapshotDir. SnapshotProtect are absolute paths, such as the
+	// database's files, that are always left out.
+	Snapshot         bool
+	SnapshotDir      string
+	SnapshotExclude  []string
+	SnapshotMaxBytes int64
+	SnapshotKeep     int
+	SnapshotProtect  []string
 }
 
-func StartWorker(ctx context.Context, store *api.Store, cfg Config) {
+// pipeCloseDelay is how long output is still read after codex is killed
+const pipeCloseDelay = 2 * time.Second
+
+// causes of a run being stopped, used to classify its failure
+var (
+	errCancelled = errors.New("cancelled through the API")
+	errShutdown  = errors.New("killed after the shutdown grace period")
+	errTimeout   = errors.New("timed out")
+)
+
+// StartWorker processes pending requests until ctx is cancelled and every
+// in-flight request has finished or been killed.
+func StartWorker(ctx context.Context, store api.RequestStore, cfg Config) {
 	if cfg.PollInterval <= 0 {
 		cfg.PollInterval = 2 * time.Second
 	}
@@ -58,9 +142,34 @@ func StartWorker(ctx context.Context, store *api.Store, cfg Config) {
 	if cfg.Reasoning == "" {
 		cfg.Reasoning = "high"
 	}
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.PublicURL == "" {
+		cfg.PublicURL = "http://127.0.0.1:55136"
+	}
+	if cfg.SnapshotDir == "" {
+		cfg.SnapshotDir = "snapshots"
+	}
+	if cfg.SnapshotKeep < 1 {
+		cfg.SnapshotKeep = 20
+	}
 
-	log.Printf("worker ready; polling every %s", cfg.PollInterval)
+	log.Printf("worker ready; %d worker(s), polling every %s", cfg.Workers, cfg.PollInterval)
 
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			workLoop(ctx, store, cfg)
+		}()
+	}
+	wg.Wait()
+	log.Printf("worker stopped")
+}
+
+func workLoop(ctx context.Context, store api.RequestStore, cfg Config) {
 	ticker := time.NewTicker(cfg.PollInterval)
 	defer ticker.Stop()
 	for {
@@ -73,35 +182,227 @@ func StartWorker(ctx context.Context, store *api.Store, cfg Config) {
 		req, ok, err := store.ClaimNextPending(ctx)
 		if err != nil {
 			log.Printf("worker claim failed: %v", err)
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-			}
-			continue
 		}
-		if !ok {
+		if err != nil || !ok {
 			select {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
+			case <-cfg.Wake:
 			}
 			continue
 		}
 
-		log.Printf("processing request %d", req.ID)
-		status := "processed"
-		err = runCodex(ctx, store, cfg, req.ID, req.Prompt)
+		processRequest(ctx, store, cfg, req)
+	}
+}
+
+// processRequest runs a claimed request and records its outcome. The run
+// survives cancellation of ctx for cfg.ShutdownGrace so shutdowns can drain.
+func processRequest(ctx context.Context, store api.RequestStore, cfg Config, req api.Request) {
+	log.Printf("processing request %d", req.ID)
+	base := context.WithoutCancel(ctx)
+	runCtx, cancelRun := context.WithCancelCause(base)
+	defer cancelRun(nil)
+	if cfg.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		runCtx, cancelTimeout = context.WithTimeoutCause(runCtx, cfg.Timeout, fmt.Errorf("%w after %s", errTimeout, cfg.Timeout))
+		defer cancelTimeout()
+	}
+	go func() {
+		select {
+		case <-runCtx.Done():
+			return
+		case <-ctx.Done():
+		}
+		log.Printf("request %d: shutting down, waiting up to %s", req.ID, cfg.ShutdownGrace)
+		select {
+		case <-runCtx.Done():
+		case <-time.After(cfg.ShutdownGrace):
+			cancelRun(errShutdown)
+		}
+	}()
+	go watchCancel(runCtx, store, req.ID, func() { cancelRun(errCancelled) })
+
+	// a model chosen at submit time overrides the worker default
+	if req.Model != "" {
+		cfg.CodexModel = req.Model
+	} else if err := store.SetRequestModel(base, req.ID, cfg.CodexModel); err != nil {
+		log.Printf("worker model update failed: %v", err)
+	}
+
+	var branch *api.RequestBranch
+	if cfg.GitBranch {
+		target, from := cfg.GitTarget, ""
+		if parent, ok, _ := store.GetBranch(base, req.ParentID); ok && parent.State == api.BranchOpen {
+			target, from = parent.Target, parent.CommitSHA
+		}
+		b, dir, err := startBranch(base, workDir(cfg), req.ID, target, from)
 		if err != nil {
-			status = "error"
+			failure := api.Failure{Kind: api.FailureWorkspace, Message: "creating branch: " + err.Error()}
+			log.Printf("request %d failed: %s", req.ID, failure.Summary())
+			if err := store.FailRequest(base, req.ID, failure); err != nil {
+				log.Printf("worker update failed: %v", err)
+			}
+			return
+		}
+		if err := store.SaveBranch(base, b); err != nil {
+			log.Printf("worker branch update failed: %v", err)
+		}
+		branch = &b
+		cfg.WorkDir = dir
+	}
+
+	// changes already in the workdir are not the run's, so the run is
+	// compared against a snapshot taken just before it
+	var before string
+	if cfg.GitFiles || cfg.GitDiff {
+		before, _ = gitSnapshot(base, workDir(cfg))
+	}
+	// a branch already keeps the checkout as it was
+	if cfg.Snapshot && branch == nil {
+		recordSnapshot(base, store, cfg, req.ID)
+	}
+	failure, warnings := runCodex(runCtx, store, cfg, req)
+	cancelRun(nil)
+	if before != "" {
+		recordGitChanges(base, store, cfg, req.ID, before)
+	}
+	if branch != nil {
+		if err := finishBranch(base, branch, req.Prompt, requestURL(cfg, req.ID)); err != nil {
+			log.Printf("request %d: committing branch failed: %v", req.ID, err)
+			branch.Error = err.Error()
 		}
-		if err := store.UpdateRequest(ctx, req.ID, status, responseFor(err)); err != nil {
+		if err := store.SaveBranch(base, *branch); err != nil {
+			log.Printf("worker branch update failed: %v", err)
+		}
+	}
+	if failure != nil {
+		log.Printf("request %d failed: %s", req.ID, failure.Summary())
+		if err := store.FailRequest(base, req.ID, *failure); err != nil {
 			log.Printf("worker update failed: %v", err)
 		}
+		return
+	}
+	for _, warning := range warnings {
+		log.Printf("request %d: %s", req.ID, warning)
+	}
+	// a request cancelled through the API can no longer be finished
+	err := store.CompleteRequest(base, req.ID, warnings)
+	if errors.Is(err, api.ErrInvalidTransition) {
+		log.Printf("request %d cancelled", req.ID)
+	} else if err != nil {
+		log.Printf("worker update failed: %v", err)
 	}
 }
 
-func runCodex(ctx context.Context, store *api.Store, cfg Config, requestID int64, prompt string) error {
+// recordGitChanges indexes the files that differ from the before snapshot
+// and stores the diff between them
+func recordGitChanges(ctx context.Context, store api.RequestStore, cfg Config, requestID int64, before string) {
+	dir := workDir(cfg)
+	after, err := gitSnapshot(ctx, dir)
+	if err != nil {
+		log.Printf("request %d: git snapshot failed: %v", requestID, err)
+		return
+	}
+	if after == before {
+		return
+	}
+	if cfg.GitFiles {
+		files, err := gitChanges(ctx, dir, before, after)
+		if err != nil {
+			log.Printf("request %d: git diff failed: %v", requestID, err)
+		}
+		for i := range files {
+			files[i].RequestID = requestID
+		}
+		if err := store.RecordFiles(ctx, files); err != nil {
+			log.Printf("worker file index failed: %v", err)
+		}
+	}
+	if cfg.GitDiff {
+		patch, err := gitPatch(ctx, dir, before, after)
+		if err != nil {
+			log.Printf("request %d: git diff failed: %v", requestID, err)
+			return
+		}
+		if patch == "" {
+			return
+		}
+		patch, truncated := truncatePatch(patch, maxDiffSize)
+		if patch == "" {
+			log.Printf("request %d: diff too large to store", requestID)
+			return
+		}
+		a := api.Artifact{RequestID: requestID, Name: api.ArtifactDiff, Truncated: truncated}
+		if err := store.SaveArtifact(ctx, a, []byte(patch)); err != nil {
+			log.Printf("worker diff update failed: %v", err)
+		}
+	}
+}
+
+// recordSnapshot archives the workdir before a run and notes in the
+// request's history whether it could
+func recordSnapshot(ctx context.Context, store api.RequestStore, cfg Config, requestID int64) {
+	// the server restores snapshots from its own working directory
+	dir, _ := filepath.Abs(cfg.SnapshotDir)
+	skip := append([]string{dir}, cfg.SnapshotProtect...)
+	snap, err := takeSnapshot(ctx, workDir(cfg), snapshotPath(dir, requestID), skip, cfg.SnapshotExclude, cfg.SnapshotMaxBytes)
+	event := api.RequestEvent{RequestID: requestID, Kind: api.EventSnapshot}
+	if err != nil {
+		log.Printf("request %d: snapshot failed: %v", requestID, err)
+		event.Kind, event.Message = api.EventSnapshotSkipped, "Snapshot skipped: "+err.Error()
+	} else {
+		snap.RequestID = requestID
+		event.Message = fmt.Sprintf("Snapshot of %s taken: %d files, %s", snap.Dir, snap.Files, formatBytes(snap.Size))
+		if err := store.SaveSnapshot(ctx, snap); err != nil {
+			log.Printf("worker snapshot update failed: %v", err)
+		}
+		pruneSnapshots(ctx, store, cfg.SnapshotDir, cfg.SnapshotKeep)
+	}
+	if err := store.AddEvent(ctx, event); err != nil {
+		log.Printf("worker event update failed: %v", err)
+	}
+}
+
+// requestURL is the request's page on the web UI
+func requestURL(cfg Config, requestID int64) string {
+	return strings.TrimSuffix(cfg.PublicURL, "/") + "/requests/" + strconv.FormatInt(requestID, 10) + "/"
+}
+
+func workDir(cfg Config) string {
+	if cfg.WorkDir == "" {
+		return "."
+	}
+	return cfg.WorkDir
+}
+
+// watchCancel stops a running request once it is cancelled through the API
+func watchCancel(ctx context.Context, store api.RequestStore, requestID int64, cancel func()) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		req, ok, err := store.GetRequest(ctx, requestID)
+		if err == nil && ok && req.Status == api.StatusCancelled {
+			cancel()
+			return
+		}
+	}
+}
+
+// maxBadEvents is how many unreadable events a run records
+const maxBadEvents = 10
+
+// runCodex runs codex for one request and returns why it failed, or nil
+// and the warnings of a run that completed. A follow-up resumes the
+// session of the request before it.
+func runCodex(ctx context.Context, store api.RequestStore, cfg Config, req api.Request) (*api.Failure, []string) {
+	requestID := req.ID
 	args := []string{
 		"exec",
 		"--json",
@@ -111,8 +412,11 @@ func runCodex(ctx context.Context, store *api.Store, cfg Config, requestID int64
 		"model_reasoning_effort=" + cfg.Reasoning,
 		"--dangerously-bypass-approvals-and-sandbox",
 		"--skip-git-repo-check",
-		prompt,
 	}
+	if req.ParentID != 0 && req.SessionID != "" {
+		args = append(args, "resume", req.SessionID)
+	}
+	args = append(args, req.Prompt)
 	cmd := exec.CommandContext(ctx, cfg.CodexBin, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Env = append(os.Environ(), "COLUMNS=50")
@@ -122,33 +426,103 @@ func runCodex(ctx context.Context, store *api.Store, cfg Config, requestID int64
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return err
+		return &api.Failure{Kind: api.FailureSpawn, Message: err.Error()}, nil
 	}
-	cmd.Stderr = os.Stderr
+	stderr := newTailWriter(os.Stderr, stderrTailLines)
+	cmd.Stderr = stderr
+	// children of a killed codex can hold its output pipes open; stop
+	// reading once the run is stopped so it cannot hang
+	cmd.WaitDelay = pipeCloseDelay
 
 	if err := cmd.Start(); err != nil {
-		return err
+		return &api.Failure{Kind: api.FailureSpawn, Message: err.Error()}, nil
 	}
+	stopClose := context.AfterFunc(ctx, func() {
+		time.AfterFunc(pipeCloseDelay, func() { stdout.Close() })
+	})
+	defer stopClose()
 
-	// parse JSON events and store relevant output
+	// parse JSON events and store relevant output; the buffer is flushed
+	// before returning so every line lands before the final status update
+	lines := newLineBuffer(ctx, store)
+	defer lines.Flush()
 	lineNum := 1
+	eventNum := 0
+	var badEvents []string
+	dropped := 0
+	var codexError string
+	turnFailed, completed := false, false
+	lastPlan := ""
 	reader := bufio.NewReader(stdout)
 	for {
 		line, err := reader.ReadString('\n')
-		if len(line) > 0 {
+		if strings.TrimSpace(line) != "" {
+			eventNum++
 			// parse JSON event
 			var event codexEvent
 			if jsonErr := json.Unmarshal([]byte(line), &event); jsonErr != nil {
+				if len(badEvents) < maxBadEvents {
+					badEvents = append(badEvents, fmt.Sprintf("event %d is not valid JSON: %v", eventNum, jsonErr))
+				} else {
+					dropped++
+				}
 				continue
 			}
 
+			switch event.Type {
+			case "thread.started":
+				if event.ThreadID != "" && event.ThreadID != req.SessionID {
+					if err := store.SetSessionID(ctx, requestID, event.ThreadID); err != nil {
+						log.Printf("worker session update failed: %v", err)
+					}
+				}
+			case "error":
+				codexError = event.Message
+			case "turn.completed":
+				completed = true
+			case "turn.failed":
+				turnFailed = true
+				if event.Error != nil {
+					codexError = event.Error.Message
+				}
+			}
+
+			if event.Type == "turn.completed" && event.Usage != nil {
+				usage := event.Usage
+				if err := store.AddUsage(ctx, requestID, int64(usage.InputTokens), int64(usage.OutputTokens)); err != nil {
+					log.Printf("worker usage update failed: %v", err)
+				}
+			}
+
 			// process relevant events
 			lineType, content := processEvent(event)
+			if lineType == "error" {
+				codexError = content
+			}
+			if lineType == api.LineFileChange {
+				var files []api.RequestFile
+				for _, change := range api.ParseFileChanges(content) {
+					files = append(files, api.RequestFile{
+						RequestID: requestID,
+						Path:      relativePath(workDir(cfg), change.Path),
+						Kind:      change.Kind,
+					})
+				}
+				if err := store.RecordFiles(ctx, files); err != nil {
+					log.Printf("worker file index failed: %v", err)
+				}
+			}
+			if lineType == api.LineTodoList {
+				// a plan is often re-sent unchanged when its item completes
+				if content == lastPlan {
+					content = ""
+				} else {
+					lastPlan = content
+				}
+			}
 			if content != "" {
 				log.Printf("[%d] [%s] %s", requestID, lineType, truncate(content, 80))
-				if storeErr := store.AddOutputLine(ctx, requestID, lineNum, lineType, content); storeErr != nil {
-					log.Printf("failed to store output line: %v", storeErr)
-				}
+				lines.Add(requestID, lineNum, lineType, content)
 				lineNum++
 			}
 		}
@@ -156,22 +530,70 @@ func runCodex(ctx context.Context, store *api.Store, cfg Config, requestID int64
 			break
 		}
 		if err != nil {
+			badEvents = append(badEvents, fmt.Sprintf("reading events: %v", err))
 			break
 		}
 	}
+	if dropped > 0 {
+		badEvents = append(badEvents, fmt.Sprintf("%d more events were not valid JSON", dropped))
+	}
+
+	waitErr := cmd.Wait()
+	if f := classifyRun(ctx, waitErr, badEvents, codexError, turnFailed, completed, stderr.Lines()); f != nil {
+		return f, nil
+	}
+	return nil, badEvents
+}
 
-	return cmd.Wait()
+// classifyRun turns the outcome of a codex run into a Failure. The cause
+// of a stopped run wins over how the process died; a codex error explains
+// a bad exit better than the exit status. Unreadable events only fail a
+// run that exited cleanly without completing its turn; once the turn
+// completed they are left to the caller as warnings.
+func classifyRun(ctx context.Context, waitErr error, badEvents []string, codexError string, turnFailed, completed bool, stderr []string) *api.Failure {
+	f := &api.Failure{StderrTail: stderr, CodexError: codexError}
+	var exitErr *exec.ExitError
+	if errors.As(waitErr, &exitErr) {
+		if code := exitErr.ExitCode(); code >= 0 {
+			f.ExitCode = &code
+		}
+		if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			f.Signal = ws.Signal().String()
+		}
+	}
+	cause := context.Cause(ctx)
+	switch {
+	case waitErr != nil && errors.Is(cause, errTimeout):
+		f.Kind, f.Message = api.FailureTimeout, cause.Error()
+	case waitErr != nil && cause != nil:
+		f.Kind, f.Message = api.FailureCancelled, cause.Error()
+	case turnFailed || (waitErr != nil && codexError != ""):
+		f.Kind, f.Message = api.FailureCodexError, codexError
+	case waitErr != nil:
+		f.Kind, f.Message = api.FailureExit, waitErr.Error()
+	case len(badEvents) > 0 && !completed:
+		f.Kind, f.Message, f.Warnings = api.FailureStreamCorrupt, badEvents[0], badEvents[1:]
+	default:
+		return nil
+	}
+	return f
 }
 
 // processEvent extracts line type and content from codex JSON events
 func processEvent(event codexEvent) (lineType, content string) {
-	if event.Type != "item.completed" {
+	switch event.Type {
+	case "item.started", "item.updated", "item.completed":
+	default:
 		return "", ""
 	}
 	var item itemInfo
 	if err := json.Unmarshal(event.Item, &item); err != nil {
 		return "", ""
 	}
+	// plans are recorded every time they change, other items once complete
+	if event.Type != "item.completed" && item.Type != "todo_list" {
+		return "", ""
+	}
 	switch item.Type {
 	case "reasoning":
 		return "reasoning", strings.TrimSpace(item.Text)
@@ -183,10 +605,52 @@ func processEvent(event codexEvent) (lineType, content string) {
 		if item.Status == "completed" {
 			return "command", strings.TrimSpace(item.AggregatedOutput)
 		}
+	case "file_change":
+		if item.Status == "failed" {
+			return "error", "file change failed:\n" + api.FormatFileChanges(item.Changes)
+		}
+		return api.LineFileChange, api.FormatFileChanges(item.Changes)
+	case "mcp_tool_call":
+		return api.LineToolCall, api.FormatToolCall(toolCall(item))
+	case "web_search":
+		return api.LineWebSearch, strings.TrimSpace(item.Query)
+	case "todo_list":
+		todos := make([]api.TodoItem, len(item.Items))
+		for i, todo := range item.Items {
+			todos[i] = api.TodoItem{Text: todo.Text, Completed: todo.Completed}
+		}
+		return api.LineTodoList, api.FormatTodoList(todos)
 	}
 	return "", ""
 }
 
+// toolCall summarises an mcp_tool_call item, preferring the text blocks of
+// the result over its structured content
+func toolCall(item itemInfo) api.ToolCall {
+	call := api.ToolCall{Server: item.Server, Tool: item.Tool, Failed: item.Status == "failed"}
+	var args bytes.Buffer
+	if json.Compact(&args, item.Arguments) == nil && args.String() != "null" {
+		call.Arguments = args.String()
+	}
+	switch {
+	case item.Error != nil:
+		call.Failed, call.Result = true, strings.TrimSpace(item.Error.Message)
+	case item.Result != nil:
+		var texts []string
+		for _, block := range item.Result.Content {
+			if block.Type == "text" {
+				texts = append(texts, strings.TrimSpace(block.Text))
+			}
+		}
+		call.Result = strings.Join(texts, "\n")
+		var structured bytes.Buffer
+		if call.Result == "" && json.Compact(&structured, item.Result.StructuredContent) == nil && structured.String() != "null" {
+			call.Result = structured.String()
+		}
+	}
+	return call
+}
+
 // truncate limits string length and adds ellipsis
 func truncate(s string, maxLen int) string {
 	// replace newlines with spaces for single-line display
@@ -197,10 +661,3 @@ func truncate(s string, maxLen int) string {
 	}
 	return s[:maxLen] + "..."
 }
-
-func responseFor(err error) string {
-	if err == nil {
-		return ""
-	}
-	return err.Error()
-}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"almono/api"
+)
+
+// TestRunCodexUnreadableEvents runs a fake codex that writes lines which
+// are not JSON and checks they only fail a run that did not complete
+func TestRunCodexUnreadableEvents(t *testing.T) {
+	const (
+		completed = `{"type":"turn.completed","usage":{"input_tokens":1,"output_tokens":2}}`
+		message   = `{"type":"item.completed","item":{"type":"agent_message","text":"done"}}`
+	)
+	tests := []struct {
+		name     string
+		stdout   []string
+		exit     int
+		kind     api.FailureKind
+		warnings []string
+	}{
+		{
+			name:     "completed",
+			stdout:   []string{message, "not json", completed},
+			warnings: []string{"event 2 is not valid JSON"},
+		},
+		{
+			name:     "completed with many bad lines",
+			stdout:   append(slices.Repeat([]string{"{"}, maxBadEvents+2), completed),
+			warnings: append(slices.Repeat([]string{"is not valid JSON"}, maxBadEvents), "2 more events were not valid JSON"),
+		},
+		{
+			name:   "not completed",
+			stdout: []string{message, "not json"},
+			kind:   api.FailureStreamCorrupt,
+		},
+		{
+			name:   "completed but exited non-zero",
+			stdout: []string{"not json", completed},
+			exit:   3,
+			kind:   api.FailureExit,
+		},
+		{
+			name:   "clean",
+			stdout: []string{message, completed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			dir := t.TempDir()
+			script := "#!/bin/sh\ncat <<'EOF'\n" + strings.Join(tt.stdout, "\n") + "\nEOF\nexit " + strconv.Itoa(tt.exit) + "\n"
+			bin := filepath.Join(dir, "codex")
+			if err := os.WriteFile(bin, []byte(script), 0o755); err != nil {
+				t.Fatal(err)
+			}
+			store := api.NewMemStore()
+			if _, err := store.CreateRequest(ctx, api.NewRequest{Prompt: "p"}); err != nil {
+				t.Fatal(err)
+			}
+			req, _, err := store.ClaimNextPending(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			failure, warnings := runCodex(ctx, store, Config{CodexBin: bin, WorkDir: dir}, req)
+			switch {
+			case tt.kind == "" && failure != nil:
+				t.Fatalf("run failed with %s", failure.Summary())
+			case tt.kind != "" && (failure == nil || failure.Kind != tt.kind):
+				t.Fatalf("run failed with %+v, want %s", failure, tt.kind)
+			}
+			if len(warnings) != len(tt.warnings) {
+				t.Fatalf("warnings %q, want %q", warnings, tt.warnings)
+			}
+			for i, want := range tt.warnings {
+				if !strings.Contains(warnings[i], want) {
+					t.Errorf("warning %d is %q, want it to contain %q", i, warnings[i], want)
+				}
+			}
+		})
+	}
+}
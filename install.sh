@@ -13,9 +13,8 @@ cd "$INSTALL_DIR"
 
 # Download latest release binaries
 echo "Downloading binaries..."
-curl -sL "https://github.com/$REPO/releases/latest/download/codex-launcher-web" -o codex-launcher-web
-curl -sL "https://github.com/$REPO/releases/latest/download/codex-launcher-worker" -o codex-launcher-worker
-chmod +x codex-launcher-web codex-launcher-worker
+curl -sL "https://github.com/$REPO/releases/latest/download/codex-launcher-server" -o codex-launcher-server
+chmod +x codex-launcher-server
 
 # Check if tmux is installed
 if ! command -v tmux &> /dev/null; then
@@ -26,9 +25,8 @@ fi
 # Kill existing sessions if any
 tmux kill-session -t codex-launcher 2>/dev/null || true
 
-# Start tmux session with server and worker
-tmux new-session -d -s codex-launcher -n server "./codex-launcher-web -addr :$PORT -db $INSTALL_DIR/db.sqlite3"
-tmux new-window -t codex-launcher -n worker "./codex-launcher-worker -db $INSTALL_DIR/db.sqlite3"
+# Start tmux session running web server and worker in one process
+tmux new-session -d -s codex-launcher -n server "./codex-launcher-server all -addr :$PORT -db $INSTALL_DIR/db.sqlite3"
 
 echo ""
 echo "Codex Launcher is running!"
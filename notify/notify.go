@@ -0,0 +1,25 @@
+// Package notify wakes idle workers when new requests are enqueued.
+package notify
+
+// Channel is an in-process wake-up signal. Notifications coalesce: any
+// number of Notify calls while the receiver is busy produce one wake-up.
+type Channel struct {
+	c chan struct{}
+}
+
+func NewChannel() *Channel {
+	return &Channel{c: make(chan struct{}, 1)}
+}
+
+// Notify signals the receiver without blocking
+func (ch *Channel) Notify() {
+	select {
+	case ch.c <- struct{}{}:
+	default:
+	}
+}
+
+// C returns the channel that receives wake-ups
+func (ch *Channel) C() <-chan struct{} {
+	return ch.c
+}
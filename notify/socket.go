@@ -0,0 +1,111 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// dialTimeout bounds each wake-up attempt so a wedged listener never stalls the sender
+const dialTimeout = 100 * time.Millisecond
+
+// DirFor returns the default socket directory for a database file
+func DirFor(dbPath string) string {
+	return dbPath + ".notify"
+}
+
+// Listener accepts wake-ups from other processes on a unix socket and
+// forwards them to a Channel. Each worker process owns one socket in the
+// shared directory so any number of workers can be woken.
+type Listener struct {
+	ln   net.Listener
+	path string
+}
+
+// Listen creates a socket for this process in dir and forwards every
+// connection to ch as a notification.
+func Listen(dir string, ch *Channel) (*Listener, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("worker-%d.sock", os.Getpid()))
+	_ = os.Remove(path)
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	l := &Listener{ln: ln, path: path}
+	go l.serve(ch)
+	return l, nil
+}
+
+func (l *Listener) serve(ch *Channel) {
+	for {
+		conn, err := l.ln.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("notify listener stopped: %v", err)
+			}
+			return
+		}
+		conn.Close()
+		ch.Notify()
+	}
+}
+
+// Close stops listening and removes the socket file
+func (l *Listener) Close() error {
+	err := l.ln.Close()
+	_ = os.Remove(l.path)
+	return err
+}
+
+// Broadcaster wakes every worker listening in a socket directory
+type Broadcaster struct {
+	dir string
+}
+
+func NewBroadcaster(dir string) *Broadcaster {
+	return &Broadcaster{dir: dir}
+}
+
+// Notify connects to each worker socket in the background. Sockets left
+// behind by dead processes are removed. Missing workers are not an error:
+// they pick work up by polling once they start.
+func (b *Broadcaster) Notify() {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".sock") {
+			continue
+		}
+		path := filepath.Join(b.dir, entry.Name())
+		go func() {
+			conn, err := net.DialTimeout("unix", path, dialTimeout)
+			if err != nil {
+				if errors.Is(err, syscall.ECONNREFUSED) {
+					_ = os.Remove(path)
+				}
+				return
+			}
+			conn.Close()
+		}()
+	}
+}
+
+// Fanout forwards each notification to every notifier in the list
+type Fanout []interface{ Notify() }
+
+func (f Fanout) Notify() {
+	for _, n := range f {
+		n.Notify()
+	}
+}
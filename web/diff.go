@@ -0,0 +1,93 @@
+package web
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// diffOpenLines is the largest file diff shown expanded; longer ones start
+// collapsed
+const diffOpenLines = 200
+
+// DiffFile is one file of a unified diff
+type DiffFile struct {
+	Path    string
+	Kind    string
+	Added   int
+	Removed int
+	Binary  bool
+	Lines   []DiffLine
+	Open    bool
+}
+
+// Change describes the file's kind and line counts
+func (f DiffFile) Change() string {
+	if f.Binary {
+		return f.Kind + " binary"
+	}
+	return fmt.Sprintf("%s +%d -%d", f.Kind, f.Added, f.Removed)
+}
+
+// DiffLine is a line of a hunk with the CSS class it is shown with
+type DiffLine struct {
+	Text  string
+	Class string
+}
+
+// parseDiff splits a git patch into files. Header lines other than the
+// hunk headers are dropped since the file summary covers them.
+func parseDiff(patch string) []DiffFile {
+	var files []DiffFile
+	var f *DiffFile
+	inHunk := false
+	for _, line := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		if header, ok := strings.CutPrefix(line, "diff --git "); ok {
+			files = append(files, DiffFile{Path: diffPath(header), Kind: "update"})
+			f = &files[len(files)-1]
+			inHunk = false
+			continue
+		}
+		if f == nil {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+			f.Lines = append(f.Lines, DiffLine{Text: line, Class: "diff-hunk"})
+		case inHunk && strings.HasPrefix(line, "+"):
+			f.Added++
+			f.Lines = append(f.Lines, DiffLine{Text: line, Class: "diff-add"})
+		case inHunk && strings.HasPrefix(line, "-"):
+			f.Removed++
+			f.Lines = append(f.Lines, DiffLine{Text: line, Class: "diff-del"})
+		case inHunk:
+			f.Lines = append(f.Lines, DiffLine{Text: line})
+		case strings.HasPrefix(line, "new file mode"):
+			f.Kind = "add"
+		case strings.HasPrefix(line, "deleted file mode"):
+			f.Kind = "delete"
+		case strings.HasPrefix(line, "Binary files"), line == "GIT binary patch":
+			f.Binary = true
+		}
+	}
+	for i := range files {
+		files[i].Open = len(files[i].Lines) <= diffOpenLines
+	}
+	return files
+}
+
+// diffPath reads the path from "a/path b/path". Renames are not detected,
+// so both halves name the same path. Git quotes paths with unusual
+// characters.
+func diffPath(header string) string {
+	if quoted, _, ok := strings.Cut(header, `" "`); ok {
+		if path, err := strconv.Unquote(quoted + `"`); err == nil {
+			return strings.TrimPrefix(path, "a/")
+		}
+	}
+	if len(header) < 5 || len(header)%2 == 0 {
+		return header
+	}
+	return strings.TrimPrefix(header[:(len(header)-1)/2], "a/")
+}
@@ -0,0 +1,106 @@
+package web
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffPath(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"a/main.go b/main.go", "main.go"},
+		{"a/web/templates/list.tmpl b/web/templates/list.tmpl", "web/templates/list.tmpl"},
+		{"a/my file.go b/my file.go", "my file.go"},
+		{"a/x b/y b/x b/y", "x b/y"},
+		{`"a/t\303\251st.go" "b/t\303\251st.go"`, "tést.go"},
+		{`"a/tab\there.go" "b/tab\there.go"`, "tab\there.go"},
+		{`"a/say \"hi\".txt" "b/say \"hi\".txt"`, `say "hi".txt`},
+		{"odd", "odd"},
+		{"a/x b/yz", "a/x b/yz"},
+	}
+	for _, tt := range tests {
+		if got := diffPath(tt.header); got != tt.want {
+			t.Errorf("diffPath(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestParseDiff(t *testing.T) {
+	patch := strings.Join([]string{
+		"stray text before the first file",
+		"diff --git a/main.go b/main.go",
+		"index 1111111..2222222 100644",
+		"--- a/main.go",
+		"+++ b/main.go",
+		"@@ -1,3 +1,3 @@",
+		" package main",
+		"-var x = 1",
+		"+var x = 2",
+		"\\ No newline at end of file",
+		"diff --git a/new.txt b/new.txt",
+		"new file mode 100644",
+		"--- /dev/null",
+		"+++ b/new.txt",
+		"@@ -0,0 +1,2 @@",
+		"+one",
+		"+two",
+		"diff --git a/old.txt b/old.txt",
+		"deleted file mode 100644",
+		"--- a/old.txt",
+		"+++ /dev/null",
+		"@@ -1 +0,0 @@",
+		"--- not a header",
+		"diff --git \"a/t\\303\\251st.png\" \"b/t\\303\\251st.png\"",
+		"index 3333333..4444444 100644",
+		"GIT binary patch",
+		"literal 5",
+		"McmZQzWMT#Y01&Jl",
+	}, "\n") + "\n"
+
+	files := parseDiff(patch)
+	type summary struct {
+		path, kind     string
+		added, removed int
+		binary         bool
+	}
+	var got []summary
+	for _, f := range files {
+		got = append(got, summary{f.Path, f.Kind, f.Added, f.Removed, f.Binary})
+	}
+	want := []summary{
+		{"main.go", "update", 1, 1, false},
+		{"new.txt", "add", 2, 0, false},
+		{"old.txt", "delete", 0, 1, false},
+		{"tést.png", "update", 0, 0, true},
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("parseDiff returned %+v, want %+v", got, want)
+	}
+
+	var classes []string
+	for _, line := range files[0].Lines {
+		classes = append(classes, line.Class)
+	}
+	if want := []string{"diff-hunk", "", "diff-del", "diff-add", ""}; !slices.Equal(classes, want) {
+		t.Errorf("main.go lines have classes %q, want %q", classes, want)
+	}
+	if files[3].Change() != "update binary" || files[1].Change() != "add +2 -0" {
+		t.Errorf("changes are %q and %q", files[3].Change(), files[1].Change())
+	}
+	for _, f := range files {
+		if !f.Open {
+			t.Errorf("%s starts collapsed", f.Path)
+		}
+	}
+
+	long := "diff --git a/big.txt b/big.txt\n@@ -0,0 +1 @@\n" + strings.Repeat("+line\n", diffOpenLines)
+	if big := parseDiff(long); len(big) != 1 || big[0].Open || big[0].Added != diffOpenLines {
+		t.Errorf("a diff of %d lines parsed as %+v", diffOpenLines+1, big)
+	}
+	if files := parseDiff(""); len(files) != 0 {
+		t.Errorf("an empty patch parsed as %+v", files)
+	}
+}
@@ -0,0 +1,291 @@
+package web
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"almono/api"
+)
+
+// pipelinesPageSize is how many pipelines the pipelines page lists
+const pipelinesPageSize = 10
+
+// layout of the pipeline graph, in pixels
+const (
+	graphWidth  = 380
+	graphNodeH  = 44
+	graphGapX   = 10
+	graphGapY   = 36
+	graphMaxW   = 180
+	graphCharPx = 8
+)
+
+// PipelinesView lists pipelines under the form that creates one
+type PipelinesView struct {
+	CSS       template.CSS
+	Pipelines []PipelineRow
+	// Error explains why the form was refused; the form keeps its values
+	Error   string
+	Form    PipelineForm
+	PrevURL string
+	NextURL string
+}
+
+// PipelineForm holds what was typed into the pipeline form
+type PipelineForm struct {
+	Name    string
+	Steps   string
+	Project string
+	Model   string
+	Tags    string
+}
+
+type PipelineRow struct {
+	Title      string
+	URL        string
+	Meta       string
+	ShowSpacer bool
+}
+
+// PipelineView shows a pipeline as a graph of its steps
+type PipelineView struct {
+	CSS   template.CSS
+	ID    int64
+	Title string
+	Meta  string
+	Graph PipelineGraph
+	Steps []StepRow
+	// Live refreshes the page until every step has finished
+	Live bool
+}
+
+// PipelineGraph draws the steps in layers, each below the steps it
+// depends on
+type PipelineGraph struct {
+	Width  int
+	Height int
+	Nodes  []GraphNode
+	Edges  []GraphEdge
+}
+
+type GraphNode struct {
+	X, Y, W, H int
+	// TextX is the centre of the node, where labels are anchored
+	TextX  int
+	Label  string
+	Status api.Status
+	URL    string
+}
+
+type GraphEdge struct {
+	X1, Y1, X2, Y2 int
+}
+
+type StepRow struct {
+	Title  string
+	URL    string
+	Prompt string
+	Meta   string
+}
+
+// HandlePipelines lists pipelines and creates them from the form
+func (s *Server) HandlePipelines(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.renderPipelines(w, r, PipelinesView{}, http.StatusOK)
+	case http.MethodPost:
+		s.handleCreatePipeline(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) handleCreatePipeline(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	form := PipelineForm{
+		Name:    strings.TrimSpace(r.FormValue("name")),
+		Steps:   r.FormValue("steps"),
+		Project: strings.TrimSpace(r.FormValue("project")),
+		Model:   strings.TrimSpace(r.FormValue("model")),
+		Tags:    r.FormValue("tags"),
+	}
+	steps, err := api.ParsePipelineSteps(form.Steps)
+	var p api.Pipeline
+	if err == nil {
+		p, err = s.svc.CreatePipeline(r.Context(), api.NewPipeline{
+			Name:    form.Name,
+			Project: form.Project,
+			Model:   form.Model,
+			Tags:    api.SplitTags(form.Tags),
+			Steps:   steps,
+		})
+	}
+	switch {
+	case errors.Is(err, api.ErrInvalidPipeline):
+		s.renderPipelines(w, r, PipelinesView{Error: err.Error(), Form: form}, http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("CreatePipeline failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/pipelines/"+strconv.FormatInt(p.ID, 10), http.StatusSeeOther)
+}
+
+func (s *Server) renderPipelines(w http.ResponseWriter, r *http.Request, data PipelinesView, status int) {
+	result, err := s.svc.ListPipelines(r.Context(), parseInt(r.URL.Query().Get("page"), 1), pipelinesPageSize)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data.CSS = s.css
+	for i, p := range result.Pipelines {
+		data.Pipelines = append(data.Pipelines, PipelineRow{
+			Title:      pipelineTitle(p),
+			URL:        "/pipelines/" + strconv.FormatInt(p.ID, 10),
+			Meta:       pipelineMeta(p),
+			ShowSpacer: i < len(result.Pipelines)-1,
+		})
+	}
+	if result.Page > 1 {
+		data.PrevURL = "/pipelines?page=" + strconv.Itoa(result.Page-1)
+	}
+	if result.More {
+		data.NextURL = "/pipelines?page=" + strconv.Itoa(result.Page+1)
+	}
+	w.WriteHeader(status)
+	if err := s.templates.ExecuteTemplate(w, "pipelines", data); err != nil {
+		log.Printf("rendering pipelines failed: %v", err)
+	}
+}
+
+// HandlePipeline shows a pipeline's graph and steps
+func (s *Server) HandlePipeline(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(r.URL.Path, "/pipelines/"), "/"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	p, ok, err := s.svc.GetPipeline(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	data := PipelineView{
+		CSS:   s.css,
+		ID:    p.ID,
+		Title: pipelineTitle(p),
+		Meta:  pipelineMeta(p),
+		Graph: pipelineGraph(p),
+	}
+	for _, step := range p.Steps {
+		meta := []string{string(step.Request.Status)}
+		if len(step.DependsOn) > 0 {
+			meta = append(meta, "after "+strings.Join(step.DependsOn, ", "))
+		}
+		if waiting := step.Waiting(p); step.Request.Status == api.StatusPending && len(waiting) > 0 {
+			meta = append(meta, "waiting on "+strings.Join(waiting, ", "))
+		}
+		if timing := requestTiming(step.Request); timing != "" {
+			meta = append(meta, timing)
+		}
+		data.Steps = append(data.Steps, StepRow{
+			Title:  step.Name + " · #" + strconv.FormatInt(step.Request.ID, 10),
+			URL:    "/requests/" + strconv.FormatInt(step.Request.ID, 10) + "/",
+			Prompt: step.Request.Prompt,
+			Meta:   strings.Join(meta, " · "),
+		})
+		if !step.Request.Finished() {
+			data.Live = true
+		}
+	}
+	if err := s.templates.ExecuteTemplate(w, "pipeline", data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func pipelineTitle(p api.Pipeline) string {
+	title := "Pipeline " + strconv.FormatInt(p.ID, 10)
+	if p.Name != "" {
+		title += " · " + p.Name
+	}
+	return title
+}
+
+// pipelineMeta sums up a pipeline's status and how many steps are done
+func pipelineMeta(p api.Pipeline) string {
+	done := 0
+	for _, step := range p.Steps {
+		if step.Request.Status == api.StatusProcessed {
+			done++
+		}
+	}
+	return string(p.Status) + " · " + strconv.Itoa(done) + " of " + strconv.Itoa(len(p.Steps)) + " steps processed · " + formatTimestamp(p.CreatedAt)
+}
+
+// pipelineGraph lays the steps out in rows by layer, centred, with a line
+// from each step to the steps depending on it
+func pipelineGraph(p api.Pipeline) PipelineGraph {
+	var layers [][]int
+	for i, step := range p.Steps {
+		for len(layers) <= step.Layer {
+			layers = append(layers, nil)
+		}
+		layers[step.Layer] = append(layers[step.Layer], i)
+	}
+	g := PipelineGraph{Width: graphWidth, Height: max(0, len(layers)*(graphNodeH+graphGapY)-graphGapY)}
+	at := map[string]GraphNode{}
+	for row, layer := range layers {
+		n := len(layer)
+		width := min(graphMaxW, (graphWidth-(n-1)*graphGapX)/n)
+		x := (graphWidth - n*width - (n-1)*graphGapX) / 2
+		for _, i := range layer {
+			step := p.Steps[i]
+			node := GraphNode{
+				X:      x,
+				Y:      row * (graphNodeH + graphGapY),
+				W:      width,
+				H:      graphNodeH,
+				TextX:  x + width/2,
+				Label:  graphLabel(step.Name, max(1, (width-12)/graphCharPx)),
+				Status: step.Request.Status,
+				URL:    "/requests/" + strconv.FormatInt(step.Request.ID, 10) + "/",
+			}
+			at[step.Name] = node
+			g.Nodes = append(g.Nodes, node)
+			x += width + graphGapX
+		}
+	}
+	for _, step := range p.Steps {
+		to := at[step.Name]
+		for _, dep := range step.DependsOn {
+			from := at[dep]
+			g.Edges = append(g.Edges, GraphEdge{X1: from.TextX, Y1: from.Y + from.H, X2: to.TextX, Y2: to.Y})
+		}
+	}
+	return g
+}
+
+// graphLabel shortens a step name to fit n characters
+func graphLabel(name string, n int) string {
+	runes := []rune(name)
+	if len(runes) <= n {
+		return name
+	}
+	return string(runes[:max(0, n-1)]) + "…"
+}
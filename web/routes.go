@@ -0,0 +1,46 @@
+package web
+
+import (
+	"net/http"
+
+	"almono/api"
+)
+
+// NewHandler builds the complete HTTP handler: JSON API, OpenAPI document and
+// web pages. A non-nil admin handler is mounted under /api/admin/.
+func NewHandler(svc *api.Service, admin http.Handler) (http.Handler, error) {
+	webServer, err := NewServer(svc)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	apiHandler := api.NewRequestHandler(svc)
+	mux.Handle("/api/requests", apiHandler)
+	mux.Handle("/api/requests/", apiHandler)
+	mux.Handle("/api/v1/search", api.NewSearchHandler(svc))
+	mux.Handle("/api/files", api.NewFilesHandler(svc))
+	pipelines := api.NewPipelinesHandler(svc)
+	mux.Handle("/api/pipelines", pipelines)
+	mux.Handle("/api/pipelines/", pipelines)
+	schedules := api.NewSchedulesHandler(svc)
+	mux.Handle("/api/schedules", schedules)
+	mux.Handle("/api/schedules/", schedules)
+	mux.Handle("/api/openapi.json", api.NewOpenAPIHandler())
+	if admin != nil {
+		mux.Handle("/api/admin/", admin)
+	}
+	mux.HandleFunc("/requests/new", webServer.HandleCreate)
+	mux.HandleFunc("/search", webServer.HandleSearch)
+	mux.HandleFunc("/files", webServer.HandleFiles)
+	mux.HandleFunc("/pipelines", webServer.HandlePipelines)
+	mux.HandleFunc("/pipelines/", webServer.HandlePipeline)
+	mux.HandleFunc("/schedules", webServer.HandleSchedules)
+	mux.HandleFunc("/schedules/", webServer.HandleSchedule)
+	mux.HandleFunc("/requests/", webServer.HandleRequests)
+	mux.HandleFunc("/requests", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/requests/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/", webServer.HandleRequests)
+	return mux, nil
+}
@@ -0,0 +1,300 @@
+package web
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"almono/api"
+)
+
+// scheduleRunsShown is how many recent runs a schedule's page lists
+const scheduleRunsShown = 10
+
+var missedPolicies = []Option{
+	{Value: api.MissedOnce, Label: "Missed runs: run once"},
+	{Value: api.MissedAll, Label: "Missed runs: run all"},
+	{Value: api.MissedSkip, Label: "Missed runs: skip"},
+}
+
+// SchedulesView lists schedules under the form that creates one
+type SchedulesView struct {
+	CSS       template.CSS
+	Schedules []ScheduleRow
+	// Error explains why the form was refused; the form keeps its values
+	Error         string
+	Form          ScheduleForm
+	MissedOptions []Option
+}
+
+// ScheduleForm holds what was typed into a schedule form
+type ScheduleForm struct {
+	Name     string
+	Cron     string
+	TimeZone string
+	Prompt   string
+	Project  string
+	Model    string
+	Tags     string
+	Missed   string
+}
+
+type ScheduleRow struct {
+	Title      string
+	URL        string
+	Meta       string
+	ShowSpacer bool
+}
+
+// ScheduleView shows a schedule, the form that edits it and its latest runs
+type ScheduleView struct {
+	CSS           template.CSS
+	ID            int64
+	Title         string
+	Meta          string
+	Enabled       bool
+	Error         string
+	Form          ScheduleForm
+	MissedOptions []Option
+	Runs          []RequestRow
+	RunsURL       string
+}
+
+// HandleSchedules lists schedules and creates them from the form
+func (s *Server) HandleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.renderSchedules(w, r, SchedulesView{Form: ScheduleForm{TimeZone: "UTC"}}, http.StatusOK)
+	case http.MethodPost:
+		form, ok := parseScheduleForm(w, r)
+		if !ok {
+			return
+		}
+		sched, err := s.svc.CreateSchedule(r.Context(), form.schedule())
+		switch {
+		case errors.Is(err, api.ErrInvalidSchedule):
+			s.renderSchedules(w, r, SchedulesView{Error: err.Error(), Form: form}, http.StatusBadRequest)
+			return
+		case err != nil:
+			log.Printf("CreateSchedule failed: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, scheduleURL(sched.ID), http.StatusSeeOther)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) renderSchedules(w http.ResponseWriter, r *http.Request, data SchedulesView, status int) {
+	schedules, err := s.svc.ListSchedules(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data.CSS = s.css
+	data.MissedOptions = options(missedPolicies, data.Form.Missed)
+	for i, sched := range schedules {
+		data.Schedules = append(data.Schedules, ScheduleRow{
+			Title:      scheduleTitle(sched),
+			URL:        scheduleURL(sched.ID),
+			Meta:       scheduleMeta(sched),
+			ShowSpacer: i < len(schedules)-1,
+		})
+	}
+	w.WriteHeader(status)
+	if err := s.templates.ExecuteTemplate(w, "schedules", data); err != nil {
+		log.Printf("rendering schedules failed: %v", err)
+	}
+}
+
+// HandleSchedule shows a schedule. POST saves the form, and POST to
+// /enable, /disable, /run or /delete acts on the schedule.
+func (s *Server) HandleSchedule(w http.ResponseWriter, r *http.Request) {
+	idPart, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/schedules/"), "/"), "/")
+	id, err := strconv.ParseInt(idPart, 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if action == "" && r.Method == http.MethodGet {
+		s.renderSchedule(w, r, id, ScheduleView{}, http.StatusOK)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	switch action {
+	case "":
+		form, ok := parseScheduleForm(w, r)
+		if !ok {
+			return
+		}
+		_, err = s.svc.UpdateSchedule(r.Context(), id, form.schedule())
+		if errors.Is(err, api.ErrInvalidSchedule) {
+			s.renderSchedule(w, r, id, ScheduleView{Error: err.Error(), Form: form}, http.StatusBadRequest)
+			return
+		}
+	case "enable", "disable":
+		_, err = s.svc.SetScheduleEnabled(r.Context(), id, action == "enable")
+	case "run":
+		var req api.Request
+		if req, err = s.svc.RunSchedule(r.Context(), id); err == nil {
+			http.Redirect(w, r, "/requests/"+strconv.FormatInt(req.ID, 10)+"/", http.StatusSeeOther)
+			return
+		}
+	case "delete":
+		var ok bool
+		if ok, err = s.svc.DeleteSchedule(r.Context(), id); err == nil && !ok {
+			err = api.ErrScheduleNotFound
+		}
+		if err == nil {
+			http.Redirect(w, r, "/schedules", http.StatusSeeOther)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch {
+	case errors.Is(err, api.ErrScheduleNotFound):
+		w.WriteHeader(http.StatusNotFound)
+	case err != nil:
+		log.Printf("schedule %d %s failed: %v", id, action, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		http.Redirect(w, r, scheduleURL(id), http.StatusSeeOther)
+	}
+}
+
+// renderSchedule shows the schedule id; a refused form in data replaces
+// the saved settings
+func (s *Server) renderSchedule(w http.ResponseWriter, r *http.Request, id int64, data ScheduleView, status int) {
+	sched, ok, err := s.svc.GetSchedule(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	runs, err := s.svc.ListRequests(r.Context(), api.ListQuery{Schedule: id, Sort: api.SortCreated}, api.Cursor{}, 1, scheduleRunsShown)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	data.CSS = s.css
+	data.ID = sched.ID
+	data.Title = scheduleTitle(sched)
+	data.Meta = scheduleMeta(sched)
+	data.Enabled = sched.Enabled
+	if data.Error == "" {
+		data.Form = ScheduleForm{
+			Name:     sched.Name,
+			Cron:     sched.Cron,
+			TimeZone: sched.TimeZone,
+			Prompt:   sched.Prompt,
+			Project:  sched.Project,
+			Model:    sched.Model,
+			Tags:     strings.Join(sched.Tags, ", "),
+			Missed:   sched.Missed,
+		}
+	}
+	data.MissedOptions = options(missedPolicies, data.Form.Missed)
+	for i, req := range runs.Requests {
+		meta := requestMeta(req)
+		if req.ScheduledForMs != 0 {
+			meta = "for " + formatSlot(req.ScheduledForMs, sched.Location()) + " · " + meta
+		}
+		data.Runs = append(data.Runs, RequestRow{
+			ID:         req.ID,
+			Display:    req.Prompt,
+			Meta:       meta,
+			URL:        "/requests/" + strconv.FormatInt(req.ID, 10) + "/",
+			ShowSpacer: i < len(runs.Requests)-1,
+		})
+	}
+	if runs.Next != 0 {
+		data.RunsURL = "/requests/?" + api.ListQuery{Schedule: id, Sort: api.SortCreated}.Values().Encode()
+	}
+	w.WriteHeader(status)
+	if err := s.templates.ExecuteTemplate(w, "schedule", data); err != nil {
+		log.Printf("rendering schedule failed: %v", err)
+	}
+}
+
+func parseScheduleForm(w http.ResponseWriter, r *http.Request) (ScheduleForm, bool) {
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return ScheduleForm{}, false
+	}
+	return ScheduleForm{
+		Name:     strings.TrimSpace(r.FormValue("name")),
+		Cron:     strings.TrimSpace(r.FormValue("cron")),
+		TimeZone: strings.TrimSpace(r.FormValue("time_zone")),
+		Prompt:   r.FormValue("prompt"),
+		Project:  strings.TrimSpace(r.FormValue("project")),
+		Model:    strings.TrimSpace(r.FormValue("model")),
+		Tags:     r.FormValue("tags"),
+		Missed:   r.FormValue("missed"),
+	}, true
+}
+
+// schedule turns the form into settings. The form has no enabled field;
+// it is switched with its own buttons and editing leaves it on.
+func (f ScheduleForm) schedule() api.NewSchedule {
+	return api.NewSchedule{
+		Name:     f.Name,
+		Cron:     f.Cron,
+		TimeZone: f.TimeZone,
+		Prompt:   f.Prompt,
+		Project:  f.Project,
+		Model:    f.Model,
+		Tags:     api.SplitTags(f.Tags),
+		Missed:   f.Missed,
+	}
+}
+
+func scheduleURL(id int64) string {
+	return "/schedules/" + strconv.FormatInt(id, 10)
+}
+
+func scheduleTitle(sched api.Schedule) string {
+	title := "Schedule " + strconv.FormatInt(sched.ID, 10)
+	if sched.Name != "" {
+		title += " · " + sched.Name
+	}
+	return title
+}
+
+// scheduleMeta sums up when a schedule runs and when it last did
+func scheduleMeta(sched api.Schedule) string {
+	loc := sched.Location()
+	parts := []string{sched.Cron + " " + sched.TimeZone}
+	switch {
+	case !sched.Enabled:
+		parts = append(parts, "disabled")
+	case sched.NextRunAtMs != 0:
+		parts = append(parts, "next "+formatSlot(sched.NextRunAtMs, loc))
+	default:
+		parts = append(parts, "no further runs")
+	}
+	if sched.LastRunAtMs != 0 {
+		parts = append(parts, "last "+formatSlot(sched.LastRunAtMs, loc))
+	}
+	if sched.SkippedRuns > 0 {
+		parts = append(parts, strconv.FormatInt(sched.SkippedRuns, 10)+" missed runs skipped")
+	}
+	return strings.Join(parts, " · ")
+}
+
+// formatSlot shows a slot in the schedule's time zone
+func formatSlot(ms int64, loc *time.Location) string {
+	return time.UnixMilli(ms).In(loc).Format("2006-01-02 15:04 MST")
+}
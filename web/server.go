@@ -3,12 +3,17 @@ package web
 import (
 	"bytes"
 	"embed"
+	"errors"
+	"fmt"
 	"html/template"
 	"image/png"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"almono/api"
 
@@ -31,6 +36,7 @@ type Server struct {
 type RequestRow struct {
 	ID         int64
 	Display    string
+	Meta       string
 	URL        string
 	ShowSpacer bool
 }
@@ -38,27 +44,105 @@ type RequestRow struct {
 type PageNumber struct {
 	Value     int
 	HasSpacer bool
+	// URL keeps the list filters; on the request list, pages without one
+	// are placeholders for pages that do not exist
+	URL string
+}
+
+type Option struct {
+	Value    string
+	Label    string
+	Selected bool
 }
 
 type ListView struct {
-	CSS         template.CSS
-	Requests    []RequestRow
-	PageNumbers []PageNumber
-	Page        int
-	Pages       int
+	CSS           template.CSS
+	Requests      []RequestRow
+	PageNumbers   []PageNumber
+	Page          int
+	PrevURL       string
+	NextURL       string
+	Query         api.ListQuery
+	Filtered      bool
+	StatusOptions []Option
+	SortOptions   []Option
+	OrderOptions  []Option
 }
 
 type OutputRow struct {
 	LineNum    int
+	LineType   string
 	Content    string
+	FullURL    string
+	FullSize   int
+	ShowSpacer bool
+	// Files, Todos and Tool hold the parsed content of structured lines
+	Files []api.FileChange
+	Todos []api.TodoItem
+	Tool  *api.ToolCall
+}
+
+type SearchRow struct {
+	Title      string
+	URL        string
+	Snippet    template.HTML
+	ShowSpacer bool
+}
+
+type SearchView struct {
+	CSS     template.CSS
+	Query   string
+	Hits    []SearchRow
+	Page    int
+	PrevURL string
+	NextURL string
+}
+
+type FilesView struct {
+	CSS     template.CSS
+	Path    string
+	Files   []FileRow
+	Page    int
+	PrevURL string
+	NextURL string
+}
+
+// FileRow is a request that changed a file, or a file a request changed
+type FileRow struct {
+	Title  string
+	URL    string
+	Prompt string
+	Path   string
+	Change string
+	// ShowPath is set when a directory lookup matched several files
+	ShowPath   bool
 	ShowSpacer bool
 }
 
 type ResponseView struct {
-	CSS          template.CSS
-	RequestID    int64
-	Prompt       string
-	Status       string
+	CSS       template.CSS
+	RequestID int64
+	Prompt    string
+	Status    api.Status
+	Timing    string
+	Failure   *FailureView
+	Plan      *PlanView
+	Files     []FileRow
+	HasDiff   bool
+	Branch    *BranchView
+	Snapshot  *SnapshotView
+	History   []HistoryRow
+	// Turn and Turns place the request in its thread; FollowUp offers
+	// the next turn
+	Turn     int
+	Turns    int
+	FollowUp bool
+	// Pipeline is the pipeline the request is a step of; Waiting lists
+	// the steps a pending step still waits for
+	Pipeline *PipelineRow
+	Waiting  string
+	// Schedule is the schedule that enqueued the request
+	Schedule     *ScheduleRow
 	Lines        []OutputRow
 	FinalMessage string
 	PageNumbers  []PageNumber
@@ -66,6 +150,155 @@ type ResponseView struct {
 	Pages        int
 }
 
+// BranchView is the git branch a request ran on
+type BranchView struct {
+	Name   string
+	Status string
+	Target string
+	Error  string
+	// Open offers merging and discarding
+	Open bool
+}
+
+func branchView(b api.RequestBranch, ok bool) *BranchView {
+	if !ok {
+		return nil
+	}
+	view := &BranchView{Name: b.Branch, Target: b.Target, Error: b.Error, Open: b.State == api.BranchOpen}
+	switch b.State {
+	case api.BranchRunning:
+		view.Status = "codex is working on it"
+	case api.BranchOpen:
+		view.Status = "committed " + shortSHA(b.CommitSHA) + ", ready to merge"
+	case api.BranchEmpty:
+		view.Status = "no changes, branch deleted"
+	case api.BranchMerged:
+		view.Status = "merged into " + b.Target + " as " + shortSHA(b.MergeSHA)
+	case api.BranchDiscarded:
+		view.Status = "discarded " + shortSHA(b.CommitSHA)
+	}
+	return view
+}
+
+// SnapshotView is the workdir snapshot taken before a request ran
+type SnapshotView struct {
+	Summary  string
+	Restored string
+}
+
+func snapshotView(snap api.RequestSnapshot, ok bool) *SnapshotView {
+	if !ok {
+		return nil
+	}
+	view := &SnapshotView{
+		Summary: fmt.Sprintf("%s, %d files, %s", snap.Dir, snap.Files, formatSize(snap.Size)),
+	}
+	if snap.RestoredAt != "" {
+		view.Restored = "last rolled back " + formatTimestamp(snap.RestoredAt)
+	}
+	return view
+}
+
+// HistoryRow is an entry of a request's history
+type HistoryRow struct {
+	Time    string
+	Message string
+}
+
+func historyRows(events []api.RequestEvent) []HistoryRow {
+	var rows []HistoryRow
+	for _, e := range events {
+		rows = append(rows, HistoryRow{Time: formatTimestamp(e.CreatedAt), Message: e.Message})
+	}
+	return rows
+}
+
+// formatTimestamp shows a stored RFC 3339 time to the minute
+func formatTimestamp(ts string) string {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return ts
+	}
+	return t.UTC().Format("2006-01-02 15:04 UTC")
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 10 {
+		return sha[:10]
+	}
+	return sha
+}
+
+// PlanView is the latest todo list of a run with its progress
+type PlanView struct {
+	Items []api.TodoItem
+	Done  int
+	Total int
+}
+
+func planView(items []api.TodoItem) *PlanView {
+	if len(items) == 0 {
+		return nil
+	}
+	view := &PlanView{Items: items, Total: len(items)}
+	for _, item := range items {
+		if item.Completed {
+			view.Done++
+		}
+	}
+	return view
+}
+
+// FailureView is the failure record shown on the response page
+type FailureView struct {
+	Label      string
+	Message    string
+	Exit       string
+	CodexError string
+	Stderr     string
+	Warnings   []string
+}
+
+// failureLabels describe each failure kind for people
+var failureLabels = map[api.FailureKind]string{
+	api.FailureSpawn:         "Codex could not be started",
+	api.FailureExit:          "Codex exited with an error",
+	api.FailureTimeout:       "Run timed out",
+	api.FailureCancelled:     "Run was stopped",
+	api.FailureCodexError:    "Codex reported an error",
+	api.FailureStreamCorrupt: "Codex output could not be read",
+	api.FailureWorkspace:     "Workdir could not be prepared",
+	"":                       "Completed with warnings",
+}
+
+func failureView(f *api.Failure) *FailureView {
+	if f == nil {
+		return nil
+	}
+	view := &FailureView{
+		Label:      failureLabels[f.Kind],
+		Message:    f.Message,
+		CodexError: f.CodexError,
+		Stderr:     strings.Join(f.StderrTail, "\n"),
+		Warnings:   f.Warnings,
+	}
+	if view.Label == "" {
+		view.Label = string(f.Kind)
+	}
+	var exit []string
+	if f.ExitCode != nil {
+		exit = append(exit, "exit code "+strconv.Itoa(*f.ExitCode))
+	}
+	if f.Signal != "" {
+		exit = append(exit, "signal "+f.Signal)
+	}
+	view.Exit = strings.Join(exit, ", ")
+	if view.CodexError == view.Message {
+		view.CodexError = ""
+	}
+	return view
+}
+
 func NewServer(svc *api.Service) (*Server, error) {
 	tmpl, err := template.ParseFS(templatesFS, "templates/*.tmpl")
 	if err != nil {
@@ -94,6 +327,34 @@ func (s *Server) HandleRequests(w http.ResponseWriter, r *http.Request) {
 			s.HandleImage(w, r)
 			return
 		}
+		if strings.HasSuffix(r.URL.Path, "/transcript") || strings.HasSuffix(r.URL.Path, "/transcript/") {
+			s.HandleTranscript(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/diff") || strings.HasSuffix(r.URL.Path, "/diff/") || strings.HasSuffix(r.URL.Path, "/diff.patch") {
+			s.HandleDiff(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/branch/merge") || strings.HasSuffix(r.URL.Path, "/branch/discard") {
+			s.HandleBranch(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/thread") || strings.HasSuffix(r.URL.Path, "/thread/") {
+			s.HandleThread(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/follow-up") {
+			s.HandleFollowUp(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/rollback") {
+			s.HandleRollback(w, r)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/lines/") {
+			s.HandleFullOutput(w, r)
+			return
+		}
 		s.HandleResponse(w, r)
 		return
 	}
@@ -105,8 +366,9 @@ func (s *Server) HandleList(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
+	query := api.ParseListQuery(r.URL.Query())
 	page := parseInt(r.URL.Query().Get("page"), 1)
-	result, err := s.svc.ListRequests(r.Context(), page, s.pageSize)
+	result, err := s.svc.ListRequests(r.Context(), query, api.ParseCursor(r.URL.Query()), page, s.pageSize)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -117,20 +379,47 @@ func (s *Server) HandleList(w http.ResponseWriter, r *http.Request) {
 		rows = append(rows, RequestRow{
 			ID:         req.ID,
 			Display:    req.Prompt,
+			Meta:       requestMeta(req),
 			URL:        url,
 			ShowSpacer: i < len(result.Requests)-1,
 		})
 	}
-	pageNumbers := make([]PageNumber, 0, 5)
-	for i := 1; i <= 5; i++ {
-		pageNumbers = append(pageNumbers, PageNumber{Value: i, HasSpacer: i < 5})
+	// every page link carries a cursor; the row keeps its width with
+	// placeholders when there are fewer pages
+	pageNumbers := make([]PageNumber, 0, pageLinks)
+	for _, link := range result.Links {
+		num := PageNumber{Value: link.Page, URL: r.URL.RequestURI()}
+		switch {
+		case link.After != 0:
+			num.URL = listURL(query, link.Page, "after", link.After)
+		case link.Before != 0:
+			num.URL = listURL(query, link.Page, "before", link.Before)
+		case link.Page == 1:
+			num.URL = listURL(query, 1, "", 0)
+		}
+		pageNumbers = append(pageNumbers, num)
+	}
+	for len(pageNumbers) < pageLinks {
+		pageNumbers = append(pageNumbers, PageNumber{Value: result.Page + len(pageNumbers)})
+	}
+	for i := range pageNumbers {
+		pageNumbers[i].HasSpacer = i < len(pageNumbers)-1
 	}
 	data := ListView{
-		CSS:         s.css,
-		Requests:    rows,
-		PageNumbers: pageNumbers,
-		Page:        result.Page,
-		Pages:       result.Pages,
+		CSS:           s.css,
+		Requests:      rows,
+		PageNumbers:   pageNumbers,
+		Page:          result.Page,
+		Query:         query,
+		PrevURL:       listURL(query, result.Page-1, "before", result.Prev),
+		NextURL:       listURL(query, result.Page+1, "after", result.Next),
+		Filtered:      query.Filtered(),
+		StatusOptions: options(statusFilters, query.Status),
+		SortOptions:   options(sortKeys, query.Sort),
+		OrderOptions:  options(sortOrders, "desc"),
+	}
+	if query.Asc {
+		data.OrderOptions = options(sortOrders, "asc")
 	}
 	if err := s.templates.ExecuteTemplate(w, "request_list", data); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -146,8 +435,12 @@ func (s *Server) HandleCreate(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	prompt := r.FormValue("request")
-	_, err := s.svc.CreateRequest(r.Context(), prompt)
+	_, err := s.svc.CreateRequest(r.Context(), api.NewRequest{
+		Prompt:  r.FormValue("request"),
+		Project: strings.TrimSpace(r.FormValue("project")),
+		Model:   strings.TrimSpace(r.FormValue("model")),
+		Tags:    api.SplitTags(r.FormValue("tags")),
+	})
 	if err != nil {
 		log.Printf("CreateRequest failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -156,6 +449,228 @@ func (s *Server) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/requests/", http.StatusSeeOther)
 }
 
+// listURL links to a page of the filtered list, through a cursor when one
+// is given. It returns "" for a missing cursor so the link can be disabled.
+func listURL(query api.ListQuery, page int, cursorParam string, cursor int64) string {
+	if cursorParam != "" && cursor == 0 {
+		return ""
+	}
+	values := query.Values()
+	if page > 1 {
+		values.Set("page", strconv.Itoa(page))
+	}
+	if cursorParam != "" {
+		values.Set(cursorParam, strconv.FormatInt(cursor, 10))
+	}
+	if len(values) == 0 {
+		return "/requests/"
+	}
+	return "/requests/?" + values.Encode()
+}
+
+// filter and sort choices on the list page; an empty value means any
+var (
+	statusFilters = []Option{
+		{Value: "", Label: "Any status"},
+		{Value: string(api.StatusPending), Label: "Pending"},
+		{Value: string(api.StatusProcessing), Label: "Processing"},
+		{Value: string(api.StatusProcessed), Label: "Processed"},
+		{Value: string(api.StatusError), Label: "Error"},
+		{Value: string(api.StatusCancelled), Label: "Cancelled"},
+		{Value: string(api.StatusSkipped), Label: "Skipped"},
+	}
+	sortKeys = []Option{
+		{Value: api.SortCreated, Label: "Created"},
+		{Value: api.SortDuration, Label: "Duration"},
+		{Value: api.SortTokens, Label: "Tokens"},
+	}
+	sortOrders = []Option{
+		{Value: "desc", Label: "Descending"},
+		{Value: "asc", Label: "Ascending"},
+	}
+)
+
+// options copies choices with the one matching selected marked
+func options(choices []Option, selected string) []Option {
+	out := make([]Option, len(choices))
+	for i, opt := range choices {
+		opt.Selected = opt.Value == selected
+		out[i] = opt
+	}
+	return out
+}
+
+// requestMeta summarises a request's labels and run metrics in one line
+func requestMeta(req api.Request) string {
+	parts := []string{string(req.Status)}
+	if req.ParentID != 0 {
+		parts = append(parts, "follow-up of "+strconv.FormatInt(req.ParentID, 10))
+	}
+	if req.PipelineID != 0 {
+		parts = append(parts, "step "+req.Step+" of pipeline "+strconv.FormatInt(req.PipelineID, 10))
+	}
+	if req.ScheduleID != 0 {
+		parts = append(parts, "run of schedule "+strconv.FormatInt(req.ScheduleID, 10))
+	}
+	if req.Project != "" {
+		parts = append(parts, req.Project)
+	}
+	if req.Model != "" {
+		parts = append(parts, req.Model)
+	}
+	if d := req.Duration(); d > 0 {
+		parts = append(parts, formatDuration(d))
+	}
+	if tokens := req.Tokens(); tokens > 0 {
+		parts = append(parts, strconv.FormatInt(tokens, 10)+" tokens")
+	}
+	for _, tag := range req.Tags {
+		parts = append(parts, "#"+tag)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// requestTiming describes how long a request waited in the queue and ran,
+// counting up to now while it is still pending or processing
+func requestTiming(req api.Request) string {
+	now := time.Now().UnixMilli()
+	since := func(ms int64) time.Duration {
+		return time.Duration(max(0, now-ms)) * time.Millisecond
+	}
+	var parts []string
+	switch {
+	case req.Status == api.StatusPending && req.QueuedAtMs > 0:
+		parts = append(parts, "queued for "+formatDuration(since(req.QueuedAtMs)))
+	case req.QueueWait() > 0:
+		parts = append(parts, "waited "+formatDuration(req.QueueWait()))
+	}
+	switch {
+	case req.Status == api.StatusProcessing && req.StartedAtMs > 0:
+		parts = append(parts, "running for "+formatDuration(since(req.StartedAtMs)))
+	case req.Duration() > 0:
+		parts = append(parts, "ran "+formatDuration(req.Duration()))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// formatDuration rounds to a readable precision: milliseconds under a
+// second, seconds otherwise
+func formatDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// formatSize renders a byte count in the largest whole unit
+func formatSize(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// searchPageSize is the number of hits per search results page
+const searchPageSize = 20
+
+// HandleSearch shows prompts and output lines matching ?q=
+func (s *Server) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	data := SearchView{CSS: s.css, Query: query, Page: 1}
+	if query != "" {
+		result, err := s.svc.Search(r.Context(), query, parseInt(r.URL.Query().Get("page"), 1), searchPageSize)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for i, hit := range result.Hits {
+			title := "#" + strconv.FormatInt(hit.RequestID, 10) + " prompt"
+			if hit.LineNum > 0 {
+				title = "#" + strconv.FormatInt(hit.RequestID, 10) + " line " + strconv.Itoa(hit.LineNum) + " " + hit.LineType
+			}
+			data.Hits = append(data.Hits, SearchRow{
+				Title: title,
+				URL:   hit.URL,
+				// snippets are escaped by the store apart from <mark> tags
+				Snippet:    template.HTML(hit.Snippet),
+				ShowSpacer: i < len(result.Hits)-1,
+			})
+		}
+		data.Page = result.Page
+		pageURL := func(page int) string {
+			return "/search?" + url.Values{"q": {query}, "page": {strconv.Itoa(page)}}.Encode()
+		}
+		if result.Page > 1 {
+			data.PrevURL = pageURL(result.Page - 1)
+		}
+		if result.More {
+			data.NextURL = pageURL(result.Page + 1)
+		}
+	}
+	if err := s.templates.ExecuteTemplate(w, "search", data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// HandleFiles lists the requests that changed ?path=, newest first
+func (s *Server) HandleFiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimSpace(r.URL.Query().Get("path"))
+	data := FilesView{CSS: s.css, Path: path, Page: 1}
+	if path != "" {
+		result, err := s.svc.FilesTouched(r.Context(), path, parseInt(r.URL.Query().Get("page"), 1), searchPageSize)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		for i, f := range result.Files {
+			data.Files = append(data.Files, FileRow{
+				Title:      "#" + strconv.FormatInt(f.RequestID, 10) + " " + string(f.Status),
+				URL:        "/requests/" + strconv.FormatInt(f.RequestID, 10) + "/",
+				Prompt:     f.Prompt,
+				Path:       f.Path,
+				Change:     fileChange(f.RequestFile),
+				ShowPath:   f.Path != path,
+				ShowSpacer: i < len(result.Files)-1,
+			})
+		}
+		data.Page = result.Page
+		pageURL := func(page int) string {
+			return "/files?" + url.Values{"path": {path}, "page": {strconv.Itoa(page)}}.Encode()
+		}
+		if result.Page > 1 {
+			data.PrevURL = pageURL(result.Page - 1)
+		}
+		if result.More {
+			data.NextURL = pageURL(result.Page + 1)
+		}
+	}
+	if err := s.templates.ExecuteTemplate(w, "files", data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// fileChange describes a file's change kind and line counts
+func fileChange(f api.RequestFile) string {
+	change := f.Kind
+	if f.Added > 0 || f.Removed > 0 {
+		change += " +" + strconv.Itoa(f.Added) + " -" + strconv.Itoa(f.Removed)
+	}
+	return change
+}
+
 func (s *Server) HandleResponse(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -182,24 +697,64 @@ func (s *Server) HandleResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	lines, _, err := s.svc.GetOutputLines(r.Context(), id, 1000, 0)
+	// the plan codex keeps during a run shows progress better than the
+	// latest reasoning line, which is the fallback
+	plan, err := s.svc.GetPlan(r.Context(), id)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	files, err := s.svc.GetRequestFiles(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var fileRows []FileRow
+	for _, f := range files {
+		fileRows = append(fileRows, FileRow{
+			URL:    "/files?" + url.Values{"path": {f.Path}}.Encode(),
+			Path:   f.Path,
+			Change: fileChange(f),
+		})
+	}
 
-	// get latest status (reasoning only) for display while processing
-	// lines are ordered DESC (newest first)
-	var latestStatus string
-	for _, line := range lines {
-		if line.LineType == "reasoning" {
-			latestStatus = line.Content
-			break
-		}
+	artifacts, err := s.svc.ListArtifacts(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
 	}
+	hasDiff := slices.ContainsFunc(artifacts, func(a api.Artifact) bool { return a.Name == api.ArtifactDiff })
+	branch, hasBranch, err := s.svc.GetBranch(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	snap, hasSnapshot, err := s.svc.GetSnapshot(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	events, err := s.svc.ListEvents(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	thread, _, err := s.svc.GetThread(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	var statusRows []OutputRow
-	if latestStatus != "" {
-		statusRows = append(statusRows, OutputRow{Content: latestStatus})
+	if plan == nil {
+		reasoning, ok, err := s.svc.GetLatestOutputLine(r.Context(), id, "reasoning")
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			statusRows = append(statusRows, OutputRow{Content: reasoning.Content})
+		}
 	}
 
 	data := ResponseView{
@@ -207,13 +762,483 @@ func (s *Server) HandleResponse(w http.ResponseWriter, r *http.Request) {
 		RequestID: req.ID,
 		Prompt:    req.Prompt,
 		Status:    req.Status,
+		Timing:    requestTiming(req),
+		Failure:   failureView(req.Failure),
+		Plan:      planView(plan),
+		Files:     fileRows,
+		HasDiff:   hasDiff,
+		Branch:    branchView(branch, hasBranch),
+		Snapshot:  snapshotView(snap, hasSnapshot),
+		History:   historyRows(events),
+		Turn:      slices.IndexFunc(thread, func(t api.Request) bool { return t.ID == req.ID }) + 1,
+		Turns:     len(thread),
+		FollowUp:  api.CheckFollowUp(req, thread) == nil,
 		Lines:     statusRows,
 	}
+	if req.PipelineID != 0 {
+		p, ok, err := s.svc.GetPipeline(r.Context(), req.PipelineID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if step, found := p.Step(req.Step); ok && found {
+			data.Pipeline = &PipelineRow{
+				Title: pipelineTitle(p) + " · step " + step.Name,
+				URL:   "/pipelines/" + strconv.FormatInt(p.ID, 10),
+			}
+			if waiting := step.Waiting(p); req.Status == api.StatusPending && len(waiting) > 0 {
+				data.Waiting = "waiting on " + strings.Join(waiting, ", ")
+			}
+		}
+	}
+	if req.ScheduleID != 0 {
+		sched, ok, err := s.svc.GetSchedule(r.Context(), req.ScheduleID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if ok {
+			data.Schedule = &ScheduleRow{
+				Title: scheduleTitle(sched),
+				URL:   scheduleURL(sched.ID),
+				Meta:  "run for " + formatSlot(req.ScheduledForMs, sched.Location()),
+			}
+		}
+	}
 	if err := s.templates.ExecuteTemplate(w, "response", data); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 	}
 }
 
+// transcriptPageSize is the number of output lines per transcript page
+const transcriptPageSize = 50
+
+// HandleTranscript shows every stored output line, oldest first
+func (s *Server) HandleTranscript(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, _, ok := parseRequestPath(r.URL.Path)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	req, ok, err := s.svc.GetRequest(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	total, err := s.svc.CountOutputLines(r.Context(), id, 0)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	pages := (total + transcriptPageSize - 1) / transcriptPageSize
+	if pages < 1 {
+		pages = 1
+	}
+	page := parseInt(r.URL.Query().Get("page"), 1)
+	if line := parseInt(r.URL.Query().Get("line"), 0); line > 0 {
+		// retention leaves gaps in the line numbers, so find the page by
+		// how many lines come before this one
+		earlier, err := s.svc.CountOutputLines(r.Context(), id, line)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		page = earlier/transcriptPageSize + 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > pages {
+		page = pages
+	}
+	// pages count from the oldest line, lines are fetched from the newest
+	offset, limit := total-page*transcriptPageSize, transcriptPageSize
+	if offset < 0 {
+		offset, limit = 0, limit+offset
+	}
+	lines, err := s.svc.GetOutputLines(r.Context(), id, limit, offset)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	slices.Reverse(lines)
+
+	rows := outputRows(id, lines)
+	data := ResponseView{
+		CSS:         s.css,
+		RequestID:   req.ID,
+		Prompt:      req.Prompt,
+		Status:      req.Status,
+		Lines:       rows,
+		PageNumbers: pageWindow(page, pages),
+		Page:        page,
+		Pages:       pages,
+	}
+	if err := s.templates.ExecuteTemplate(w, "transcript", data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// ThreadView is a conversation of follow-ups shown turn by turn
+type ThreadView struct {
+	CSS       template.CSS
+	RequestID int64
+	Turns     []ThreadTurn
+	// Live refreshes the page while a turn is pending or running
+	Live bool
+	// FollowUpID is the request the next turn follows, 0 when the thread
+	// cannot be continued yet
+	FollowUpID int64
+}
+
+// ThreadTurn is one request of a thread with the end of its transcript
+type ThreadTurn struct {
+	RequestID int64
+	Title     string
+	Prompt    string
+	Meta      string
+	Lines     []OutputRow
+	// Earlier is the number of lines before those shown
+	Earlier int
+}
+
+// threadTurnLines is how many trailing transcript lines a turn shows
+const threadTurnLines = 100
+
+// HandleThread shows the thread a request belongs to as a conversation
+func (s *Server) HandleThread(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, _, ok := parseRequestPath(r.URL.Path)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	thread, ok, err := s.svc.GetThread(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	data := ThreadView{CSS: s.css, RequestID: id}
+	for i, req := range thread {
+		lines, err := s.svc.GetOutputLines(r.Context(), req.ID, threadTurnLines, 0)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		slices.Reverse(lines)
+		earlier := 0
+		if len(lines) == threadTurnLines {
+			earlier, err = s.svc.CountOutputLines(r.Context(), req.ID, lines[0].LineNum)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		meta := []string{string(req.Status)}
+		if timing := requestTiming(req); timing != "" {
+			meta = append(meta, timing)
+		}
+		if f := failureView(req.Failure); f != nil {
+			meta = append(meta, f.Label)
+		}
+		data.Turns = append(data.Turns, ThreadTurn{
+			RequestID: req.ID,
+			Title:     "Turn " + strconv.Itoa(i+1) + " · #" + strconv.FormatInt(req.ID, 10),
+			Prompt:    req.Prompt,
+			Meta:      strings.Join(meta, " · "),
+			Lines:     outputRows(req.ID, lines),
+			Earlier:   earlier,
+		})
+		if !req.Finished() {
+			data.Live = true
+		}
+	}
+	if tip := thread[len(thread)-1]; api.CheckFollowUp(tip, thread) == nil {
+		data.FollowUpID = tip.ID
+	}
+	if err := s.templates.ExecuteTemplate(w, "thread", data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// HandleFollowUp enqueues the next turn of a thread and shows the thread
+func (s *Server) HandleFollowUp(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, _, ok := parseRequestPath(r.URL.Path)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	prompt := r.FormValue("request")
+	if strings.TrimSpace(prompt) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req, err := s.svc.FollowUp(r.Context(), id, api.NewRequest{
+		Prompt: prompt,
+		Model:  strings.TrimSpace(r.FormValue("model")),
+	})
+	switch {
+	case errors.Is(err, api.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, api.ErrNotFinished), errors.Is(err, api.ErrNoSession), errors.Is(err, api.ErrHasFollowUp):
+		w.WriteHeader(http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("FollowUp failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/requests/"+strconv.FormatInt(req.ID, 10)+"/thread", http.StatusSeeOther)
+}
+
+// outputRows prepares transcript lines for display, parsing the content
+// of structured lines
+func outputRows(id int64, lines []api.OutputLine) []OutputRow {
+	rows := make([]OutputRow, 0, len(lines))
+	for i, line := range lines {
+		row := OutputRow{
+			LineNum:    line.LineNum,
+			LineType:   line.LineType,
+			Content:    line.Content,
+			ShowSpacer: i < len(lines)-1,
+		}
+		if line.Truncated() {
+			row.FullURL = "/requests/" + strconv.FormatInt(id, 10) + "/lines/" + strconv.Itoa(line.LineNum) + "/full"
+			row.FullSize = line.FullSize
+		}
+		switch line.LineType {
+		case api.LineFileChange:
+			row.Files = api.ParseFileChanges(line.Content)
+		case api.LineTodoList:
+			row.Todos = api.ParseTodoList(line.Content)
+		case api.LineToolCall:
+			call := api.ParseToolCall(line.Content)
+			row.Tool = &call
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// HandleBranch merges or discards a request's branch from the response
+// page. A merge git refuses is shown there through the branch's error.
+func (s *Server) HandleBranch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, rest, ok := parseRequestPath(r.URL.Path)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	var err error
+	if rest == "branch/merge" {
+		_, err = s.svc.MergeBranch(r.Context(), id, strings.TrimSpace(r.FormValue("target")))
+	} else {
+		_, err = s.svc.DiscardBranch(r.Context(), id)
+	}
+	switch {
+	case errors.Is(err, api.ErrNoMergeTarget):
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	case errors.Is(err, api.ErrBranchNotOpen):
+		w.WriteHeader(http.StatusConflict)
+		return
+	case err != nil && !errors.Is(err, api.ErrBranchGit):
+		log.Printf("branch update failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/requests/"+strconv.FormatInt(id, 10)+"/", http.StatusSeeOther)
+}
+
+// HandleRollback restores the workdir to the snapshot taken before a
+// request from the response page. A failed restore is shown there through
+// the request's history.
+func (s *Server) HandleRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, _, ok := parseRequestPath(r.URL.Path)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	_, err := s.svc.Rollback(r.Context(), id)
+	switch {
+	case errors.Is(err, api.ErrNoSnapshot):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, api.ErrWorkdirBusy):
+		w.WriteHeader(http.StatusConflict)
+		return
+	case err != nil && !errors.Is(err, api.ErrRestore):
+		log.Printf("rollback failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/requests/"+strconv.FormatInt(id, 10)+"/", http.StatusSeeOther)
+}
+
+// DiffView is the workspace diff of a run split into files
+type DiffView struct {
+	CSS       template.CSS
+	RequestID int64
+	Prompt    string
+	Files     []DiffFile
+	Added     int
+	Removed   int
+	Truncated bool
+}
+
+// HandleDiff shows the workspace diff of a run, or downloads it as a
+// patch from /requests/{id}/diff.patch
+func (s *Server) HandleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	id, rest, ok := parseRequestPath(r.URL.Path)
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	req, ok, err := s.svc.GetRequest(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	diff, patch, ok, err := s.svc.GetDiff(r.Context(), id)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if rest == "diff.patch" {
+		filename := "request-" + strconv.FormatInt(id, 10) + ".patch"
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		_, _ = w.Write([]byte(patch))
+		return
+	}
+
+	data := DiffView{
+		CSS:       s.css,
+		RequestID: req.ID,
+		Prompt:    req.Prompt,
+		Files:     parseDiff(patch),
+		Truncated: diff.Truncated,
+	}
+	for _, f := range data.Files {
+		data.Added += f.Added
+		data.Removed += f.Removed
+	}
+	if err := s.templates.ExecuteTemplate(w, "diff", data); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// HandleFullOutput downloads the complete content of one output line
+func (s *Server) HandleFullOutput(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	// /requests/{id}/lines/{num}/full
+	id, rest, ok := parseRequestPath(r.URL.Path)
+	numStr, found := strings.CutPrefix(rest, "lines/")
+	numStr, suffixed := strings.CutSuffix(strings.TrimSuffix(numStr, "/"), "/full")
+	lineNum, err := strconv.Atoi(numStr)
+	if !ok || !found || !suffixed || err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	content, ok, err := s.svc.GetFullOutput(r.Context(), id, lineNum)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	filename := "request-" + strconv.FormatInt(id, 10) + "-line-" + strconv.Itoa(lineNum) + ".txt"
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	_, _ = w.Write([]byte(content))
+}
+
+// parseRequestPath splits /requests/{id}/rest into the ID and the rest
+func parseRequestPath(path string) (int64, string, bool) {
+	path = strings.TrimPrefix(path, "/requests/")
+	idStr, rest, _ := strings.Cut(path, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return id, rest, true
+}
+
+// pageLinks is the number of page links on the request list
+const pageLinks = 5
+
+// pageWindow returns five page numbers centred on page where possible.
+// Numbers beyond pages render as disabled placeholders.
+func pageWindow(page, pages int) []PageNumber {
+	const width = 5
+	start := page - width/2
+	if start > pages-width+1 {
+		start = pages - width + 1
+	}
+	if start < 1 {
+		start = 1
+	}
+	numbers := make([]PageNumber, 0, width)
+	for i := 0; i < width; i++ {
+		numbers = append(numbers, PageNumber{Value: start + i, HasSpacer: i < width-1})
+	}
+	return numbers
+}
+
 func parseInt(val string, fallback int) int {
 	if val == "" {
 		return fallback
@@ -268,7 +1293,7 @@ func (s *Server) HandleImage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// get all output lines
-	lines, _, err := s.svc.GetOutputLines(r.Context(), id, 1000, 0)
+	lines, err := s.svc.GetOutputLines(r.Context(), id, 1000, 0)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		return